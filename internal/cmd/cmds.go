@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/rapidmidiex/rmx/internal/cmd/internal/config"
@@ -29,6 +30,34 @@ var Flags = []cli.Flag{
 		Name:    "load",
 		Aliases: []string{"l"},
 	},
+	&cli.IntFlag{
+		Name:    "compression-level",
+		Usage:   "Level of the permessage-deflate compression of jam websockets, from -2 to 9, 0 keeps the default",
+		EnvVars: []string{"COMPRESSION_LEVEL"},
+	},
+	&cli.BoolFlag{
+		Name:    "compression-context-takeover",
+		Usage:   "Keeps the compression context of jam websockets from one message to the next",
+		EnvVars: []string{"COMPRESSION_CONTEXT_TAKEOVER"},
+	},
+	&cli.IntFlag{
+		Name:    "compression-threshold",
+		Usage:   "Size in bytes of the smallest message compressed on jam websockets",
+		EnvVars: []string{"COMPRESSION_THRESHOLD"},
+	},
+}
+
+// setCompression sets the compression of the config from the flags given.
+func setCompression(cCtx *cli.Context, c *config.Config) {
+	if cCtx.IsSet("compression-level") {
+		c.CompressionLevel = cCtx.Int("compression-level")
+	}
+	if cCtx.IsSet("compression-context-takeover") {
+		c.CompressionContextTakeover = cCtx.Bool("compression-context-takeover")
+	}
+	if cCtx.IsSet("compression-threshold") {
+		c.CompressionThreshold = cCtx.Int("compression-threshold")
+	}
 }
 
 var Commands = []*cli.Command{
@@ -48,6 +77,13 @@ var Commands = []*cli.Command{
 		Action:      run(true), // enable dev mode
 		Flags:       Flags,
 	},
+	{
+		Name:        "schema",
+		Category:    "protocol",
+		Description: "Prints the JSON Schema or TypeScript definitions of the messages of jams.",
+		Action:      schema,
+		Flags:       schemaFlags,
+	},
 }
 
 // shouldn't be here
@@ -61,6 +97,8 @@ func GetVersion(cCtx *cli.Context) error {
 // LoadConfigFromEnv creates a Config from environment variables.
 func LoadConfigFromEnv(dev bool) (*config.Config, error) {
 	serverPort := os.Getenv("PORT")
+	oscPort := os.Getenv("OSC_PORT")
+	rtpMIDIHost := os.Getenv("RTPMIDI_HOST")
 
 	pgURL := os.Getenv("POSTGRES_URL")
 	if pgURL == "" {
@@ -87,8 +125,31 @@ func LoadConfigFromEnv(dev bool) (*config.Config, error) {
 	redisPort := os.Getenv("REDIS_PORT")
 	redisPassword := os.Getenv("REDIS_PASSWORD")
 
+	inviteSecret := os.Getenv("INVITE_SECRET")
+
+	var compressionLevel, compressionThreshold int
+	if v := os.Getenv("COMPRESSION_LEVEL"); v != "" {
+		if compressionLevel, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid COMPRESSION_LEVEL env var: %q: %w", v, err)
+		}
+	}
+	if v := os.Getenv("COMPRESSION_THRESHOLD"); v != "" {
+		if compressionThreshold, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid COMPRESSION_THRESHOLD env var: %q: %w", v, err)
+		}
+	}
+
+	var compressionContextTakeover bool
+	if v := os.Getenv("COMPRESSION_CONTEXT_TAKEOVER"); v != "" {
+		if compressionContextTakeover, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid COMPRESSION_CONTEXT_TAKEOVER env var: %q: %w", v, err)
+		}
+	}
+
 	return &config.Config{
 		ServerPort:    serverPort,
+		OSCPort:       oscPort,
+		RTPMIDIHost:   rtpMIDIHost,
 		DBURL:         pgURL,
 		DBHost:        pgHost,
 		DBPort:        pgPort,
@@ -98,6 +159,11 @@ func LoadConfigFromEnv(dev bool) (*config.Config, error) {
 		RedisHost:     redisHost,
 		RedisPort:     redisPort,
 		RedisPassword: redisPassword,
-		Dev:           dev,
+		InviteSecret:  inviteSecret,
+		// websocket compression
+		CompressionLevel:           compressionLevel,
+		CompressionContextTakeover: compressionContextTakeover,
+		CompressionThreshold:       compressionThreshold,
+		Dev:                        dev,
 	}, nil
 }
@@ -8,7 +8,11 @@ import (
 )
 
 type Config struct {
-	ServerPort    string `json:"serverPort"`
+	ServerPort string `json:"serverPort"`
+	// UDP port of the OSC bridge, disabled if empty.
+	OSCPort string `json:"oscPort"`
+	// Host the RTP-MIDI sessions of jams listen on, disabled if empty.
+	RTPMIDIHost   string `json:"rtpMidiHost"`
 	DBURL         string `json:"dbUrl"`
 	DBHost        string `json:"dbHost"`
 	DBPort        string `json:"dbPort"`
@@ -18,7 +22,14 @@ type Config struct {
 	RedisHost     string `json:"redisHost"`
 	RedisPort     string `json:"redisPort"`
 	RedisPassword string `json:"redisPassword"`
-	Dev           bool   `json:"dev"`
+	InviteSecret  string `json:"inviteSecret"`
+	// permessage-deflate negotiated on jam websockets, see websocket.Compression.
+	// The defaults of jam.DefaultCompression are kept for the fields left
+	// empty, so a level of 0 is the default level rather than flate.NoCompression.
+	CompressionLevel           int  `json:"compressionLevel"`
+	CompressionContextTakeover bool `json:"compressionContextTakeover"`
+	CompressionThreshold       int  `json:"compressionThreshold"`
+	Dev                        bool `json:"dev"`
 }
 
 const (
@@ -1,11 +1,22 @@
 package config
 
 import (
+	"os"
 	"reflect"
 	"testing"
 )
 
 func TestConfig(t *testing.T) {
+	// the config file is written to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
 	// Write config to file
 	i := &Config{
 		ServerPort:    "8000",
@@ -17,7 +28,11 @@ func TestConfig(t *testing.T) {
 		RedisHost:     "localhost",
 		RedisPort:     "6379",
 		RedisPassword: "password",
-		Dev:           true,
+		// compress everything bigger than a note, keeping the context
+		CompressionLevel:           9,
+		CompressionContextTakeover: true,
+		CompressionThreshold:       16,
+		Dev:                        true,
 	}
 
 	if err := i.WriteToFile(); err != nil {
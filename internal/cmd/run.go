@@ -17,8 +17,11 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/manifoldco/promptui"
 	"github.com/rapidmidiex/rmx/internal/cmd/internal/config"
+	"github.com/rapidmidiex/rmx/internal/jam"
 	jamHTTP "github.com/rapidmidiex/rmx/internal/jam/http"
+	oscBridge "github.com/rapidmidiex/rmx/internal/jam/osc"
 	jamDB "github.com/rapidmidiex/rmx/internal/jam/postgres"
+	"github.com/rapidmidiex/rmx/pkg/websocket"
 
 	"github.com/rs/cors"
 	"github.com/urfave/cli/v2"
@@ -81,6 +84,7 @@ func run(dev bool) func(cCtx *cli.Context) error {
 			}
 
 			if strings.ToLower(result) == "y" {
+				setCompression(cCtx, c)
 				return serve(c)
 			}
 		}
@@ -207,6 +211,7 @@ func run(dev bool) func(cCtx *cli.Context) error {
 			RedisPassword: redisPassword,
 			Dev:           dev,
 		}
+		setCompression(cCtx, c)
 
 		// prompt to save the config to a file
 		configPrompt := promptui.Prompt{
@@ -258,7 +263,7 @@ func serve(cfg *config.Config) error {
 	c := cors.Options{
 		AllowedOrigins:   []string{"*"}, // ? band-aid, needs to change to a flag
 		AllowCredentials: true,
-		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
 		AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		ExposedHeaders:   []string{"Location"},
 		Debug:            cfg.Dev,
@@ -279,11 +284,15 @@ func serve(cfg *config.Config) error {
 		dbURL = cfg.DBURL
 	}
 
+	if err := compression(cfg).Validate(); err != nil {
+		return err
+	}
+
 	conn, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		return err
 	}
-	jamHTTP := newJamService(sCtx, conn)
+	jamHTTP := newJamService(sCtx, conn, cfg)
 
 	/* START SERVICES BLOCK */
 	srv := http.Server{
@@ -312,6 +321,18 @@ func serve(cfg *config.Config) error {
 		return srv.Shutdown(context.Background())
 	})
 
+	if cfg.OSCPort != "" {
+		oscConn, err := net.ListenPacket("udp", ":"+cfg.OSCPort)
+		if err != nil {
+			return err
+		}
+
+		g.Go(func() error {
+			srv.ErrorLog.Printf("OSC bridge starting on %s", oscConn.LocalAddr())
+			return oscBridge.New(oscConn, jamHTTP.LiveJam).Serve(gCtx)
+		})
+	}
+
 	// if err := g.Wait(); err != nil {
 	// 	log.Printf("exit reason: %s \n", err)
 	// }
@@ -324,8 +345,39 @@ func StartServer(cfg *config.Config) error {
 	return serve(cfg)
 }
 
-func newJamService(ctx context.Context, conn *sql.DB) *jamHTTP.Service {
+func newJamService(ctx context.Context, conn *sql.DB, cfg *config.Config) *jamHTTP.Service {
+	var opts []jamHTTP.Option
+	if cfg.InviteSecret != "" {
+		opts = append(opts, jamHTTP.WithInviteKey([]byte(cfg.InviteSecret)))
+	}
+
+	if cfg.RTPMIDIHost != "" {
+		opts = append(opts, jamHTTP.WithRTPMIDI(cfg.RTPMIDIHost))
+	}
+
+	opts = append(opts, jamHTTP.WithRecordings(jamDB.NewRecordingRepo(conn)))
+
+	if cfg.CompressionLevel != 0 || cfg.CompressionContextTakeover || cfg.CompressionThreshold != 0 {
+		opts = append(opts, jamHTTP.WithCompression(compression(cfg)))
+	}
+
 	jamDB := jamDB.New(conn)
-	jamHTTP := jamHTTP.New(ctx, jamDB)
+	jamHTTP := jamHTTP.New(ctx, jamDB, opts...)
 	return jamHTTP
 }
+
+// compression returns the compression of jam websockets set in the config,
+// jam.DefaultCompression for what is not.
+func compression(cfg *config.Config) websocket.Compression {
+	c := jam.DefaultCompression
+	if cfg.CompressionLevel != 0 {
+		c.Level = cfg.CompressionLevel
+	}
+	if cfg.CompressionContextTakeover {
+		c.ContextTakeover = true
+	}
+	if cfg.CompressionThreshold != 0 {
+		c.Threshold = cfg.CompressionThreshold
+	}
+	return c
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/urfave/cli/v2"
+)
+
+var schemaFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "format",
+		Value:   "json",
+		Usage:   `"json" for the JSON Schema, "ts" for the TypeScript definitions`,
+		Aliases: []string{"f"},
+	},
+	&cli.StringFlag{
+		Name:    "output",
+		Usage:   "File to write the definitions to, stdout if not set",
+		Aliases: []string{"o"},
+	},
+}
+
+// schema prints the JSON Schema or TypeScript definitions of the messages of jams.
+func schema(cCtx *cli.Context) error {
+	var (
+		p   []byte
+		err error
+	)
+	switch f := cCtx.String("format"); f {
+	case "json":
+		p, err = msg.JSONSchema()
+	case "ts":
+		p = msg.TypeScript()
+	default:
+		return fmt.Errorf("unknown format %q", f)
+	}
+	if err != nil {
+		return err
+	}
+
+	if out := cCtx.String("output"); out != "" {
+		return os.WriteFile(out, p, 0644)
+	}
+	_, err = cCtx.App.Writer.Write(p)
+	return err
+}
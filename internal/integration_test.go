@@ -145,7 +145,7 @@ func TestJamFlowAcceptance(t *testing.T) {
 	roomID := jamsList.Rooms[0].ID
 	jamWSurl := fmt.Sprintf("%s/jams/%s/ws", wsBase, roomID)
 	// Intentionally external ws client (not rmx) because this client represent a client external to this system. (JS Frontend, TUI frontend)
-	wsConnA, _, err := websocket.DefaultDialer.Dial(jamWSurl, nil)
+	wsConnA, _, err := websocket.DefaultDialer.Dial(jamWSurl+"?token="+newUserToken(t, restBase), nil)
 	// TODO: Fails. We should be able to join a Jam with the Jam ID. The service should figure out the rest
 	require.NoErrorf(t, err, "client Alpha could not join Jam room: %q (%s)", newJam.Name, newJam.ID)
 	defer func() {
@@ -156,18 +156,18 @@ func TestJamFlowAcceptance(t *testing.T) {
 	}()
 
 	// Get user ID from Connection Message
-	// var envelope msg.Envelope
-	// var aConMsg msg.ConnectMsg
-	// err = wsConnA.ReadJSON(&envelope)
-	// require.NoError(t, err)
+	var aConnEnv msg.Envelope
+	var aConMsg msg.ConnectMsg
+	err = wsConnA.ReadJSON(&aConnEnv)
+	require.NoError(t, err)
 
-	// err = json.Unmarshal(envelope.Payload, &aConMsg)
-	// require.NoError(t, err)
-	// userIDA := aConMsg.UserID
+	err = json.Unmarshal(aConnEnv.Payload, &aConMsg)
+	require.NoError(t, err)
+	userIDA := aConMsg.UserID
 
 	// **** Client B joins Jam **** //
 	var envelope msg.Envelope
-	wsConnB, _, err := websocket.DefaultDialer.Dial(jamWSurl, nil)
+	wsConnB, _, err := websocket.DefaultDialer.Dial(jamWSurl+"?token="+newUserToken(t, restBase), nil)
 	require.NoErrorf(t, err, "client Bravo could not join Jam room: %q (%s)", newJam.Name, newJam.ID)
 	defer func() {
 		err := wsConnB.WriteMessage(int(ws.OpClose), nil)
@@ -188,14 +188,14 @@ func TestJamFlowAcceptance(t *testing.T) {
 	require.Equal(t, 2, gotRooms.Rooms[0].PlayerCount, `"playerCount" field should be 2 since there are two active connections`)
 
 	// Get user ID B from Connection Message
-	// var bConMsg msg.ConnectMsg
-	// err = wsConnB.ReadJSON(&envelope)
-	// require.NoError(t, err)
-	// require.Equal(t, msg.CONNECT, envelope.Typ, "should be a Connect message")
-	// err = json.Unmarshal(envelope.Payload, &bConMsg)
-	// require.NoError(t, err)
-	// userIDB := bConMsg.UserID
-	// require.NotEmpty(t, userIDB, "User B should have received a connect message containing their user ID")
+	var bConMsg msg.ConnectMsg
+	err = wsConnB.ReadJSON(&envelope)
+	require.NoError(t, err)
+	require.Equal(t, msg.CONNECT, envelope.Typ, "should be a Connect message")
+	err = json.Unmarshal(envelope.Payload, &bConMsg)
+	require.NoError(t, err)
+	userIDB := bConMsg.UserID
+	require.NotEmpty(t, userIDB, "User B should have received a connect message containing their user ID")
 
 	// Alpha sends a MIDI message
 	// **** Client A broadcasts a MIDI message **** //
@@ -204,8 +204,8 @@ func TestJamFlowAcceptance(t *testing.T) {
 		Number: 60,
 	}
 	yasiinEnv := msg.Envelope{
-		// UserID: userIDA,
-		Typ: msg.MIDI,
+		UserID: userIDA,
+		Typ:    msg.MIDI,
 	}
 	err = yasiinEnv.SetPayload(yasiinSend)
 	require.NoError(t, err)
@@ -224,6 +224,22 @@ func TestJamFlowAcceptance(t *testing.T) {
 	require.Equal(t, yasiinSend, talibRecv, "Talib received MIDI message does not match what Yasiin sent")
 }
 
+// newUserToken creates a new participant and returns the token they join Jams with.
+func newUserToken(t *testing.T, restBase string) string {
+	t.Helper()
+	resp, err := http.Post(restBase+"/users", "application/json", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var user struct {
+		Token string `json:"token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&user)
+	require.NoError(t, err)
+	return user.Token
+}
+
 // newPostJamReq creates a POST /jams request to REST API to create a new Jam.
 func newPostJamReq(t *testing.T, jamBody io.Reader) *http.Request {
 	t.Helper()
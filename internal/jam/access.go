@@ -0,0 +1,153 @@
+package jam
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultInviteTTL     = 24 * time.Hour
+	defaultInviteMaxUses = 1
+)
+
+var (
+	ErrInvalidVisibility = errors.New("visibility must be one of: public, unlisted, private")
+	ErrInvalidInvite     = errors.New("invalid invite token")
+	ErrExpiredInvite     = errors.New("invite token has expired")
+	ErrPrivateJam        = errors.New("private jams can only be joined with a passcode or an invite")
+)
+
+// Visibility controls who can find and join a jam.
+type Visibility string
+
+const (
+	// Public jams are listed in the lobby and anyone can join.
+	Public Visibility = "public"
+	// Unlisted jams are not listed but anyone with the jam id can join.
+	Unlisted Visibility = "unlisted"
+	// Private jams are not listed and require a passcode or an invite to join.
+	Private Visibility = "private"
+)
+
+func (v Visibility) Valid() bool {
+	switch v {
+	case Public, Unlisted, Private:
+		return true
+	}
+	return false
+}
+
+// SetPasscode hashes p into PasscodeHash and clears Passcode.
+func (j *Jam) SetPasscode(p string) error {
+	h, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	j.PasscodeHash, j.Passcode = h, ""
+	return nil
+}
+
+// CheckPasscode reports whether p matches the jam's passcode.
+// It is always false for jams without a passcode.
+func (j *Jam) CheckPasscode(p string) bool {
+	if len(j.PasscodeHash) == 0 {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword(j.PasscodeHash, []byte(p)) == nil
+}
+
+// Invite lets its holders join a private jam until it expires
+// or has been used MaxUses times.
+type Invite struct {
+	ID        uuid.UUID `json:"id"`
+	JamID     uuid.UUID `json:"jamId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	MaxUses   uint      `json:"maxUses"`
+	Uses      uint      `json:"uses"`
+	// Signed token handed out to invitees, see InviteSigner.
+	Token string `json:"token,omitempty"`
+}
+
+// SetDefaults sets a default expiry and a single use.
+func (i *Invite) SetDefaults() {
+	if i.ExpiresAt.IsZero() {
+		i.ExpiresAt = time.Now().Add(defaultInviteTTL)
+	}
+	if i.MaxUses == 0 {
+		i.MaxUses = defaultInviteMaxUses
+	}
+}
+
+// InviteSigner signs invite tokens so they can be checked for tampering and
+// expiry before the invite is looked up in the database.
+type InviteSigner struct {
+	key []byte
+}
+
+func NewInviteSigner(key []byte) *InviteSigner {
+	return &InviteSigner{key: key}
+}
+
+// Sign returns the token for the invite.
+// The token is made of the jam id, invite id and expiry followed by their signature.
+func (s *InviteSigner) Sign(i Invite) string {
+	p := invitePayload(i.JamID, i.ID, i.ExpiresAt)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(p) + "." + enc.EncodeToString(s.sum(p))
+}
+
+// Verify checks the token was signed for the given jam and has not expired.
+// It returns the id of the invite.
+func (s *InviteSigner) Verify(jamID uuid.UUID, token string) (uuid.UUID, error) {
+	enc := base64.RawURLEncoding
+
+	p64, sig64, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, ErrInvalidInvite
+	}
+
+	p, err := enc.DecodeString(p64)
+	if err != nil || len(p) != 40 {
+		return uuid.Nil, ErrInvalidInvite
+	}
+
+	sig, err := enc.DecodeString(sig64)
+	if err != nil || !hmac.Equal(sig, s.sum(p)) {
+		return uuid.Nil, ErrInvalidInvite
+	}
+
+	if !hmac.Equal(p[:16], jamID[:]) {
+		return uuid.Nil, fmt.Errorf("%w: wrong jam", ErrInvalidInvite)
+	}
+
+	if exp := time.Unix(int64(binary.BigEndian.Uint64(p[32:])), 0); time.Now().After(exp) {
+		return uuid.Nil, ErrExpiredInvite
+	}
+
+	return uuid.FromBytes(p[16:32])
+}
+
+func (s *InviteSigner) sum(p []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(p)
+	return mac.Sum(nil)
+}
+
+func invitePayload(jamID, inviteID uuid.UUID, exp time.Time) []byte {
+	p := make([]byte, 0, 40)
+	p = append(p, jamID[:]...)
+	p = append(p, inviteID[:]...)
+	return binary.BigEndian.AppendUint64(p, uint64(exp.Unix()))
+}
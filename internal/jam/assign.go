@@ -0,0 +1,112 @@
+package jam
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+// maxInstrumentLength is the length of the longest instrument label.
+const maxInstrumentLength = 64
+
+var (
+	ErrChannelTaken      = errors.New("channel is assigned to another participant")
+	ErrInvalidAssignment = errors.New("invalid channel, program or instrument")
+)
+
+// Assign sets the MIDI channel and instrument of a participant, or removes
+// them if a.Unassign is set. The returned assignment is labelled after its
+// General MIDI program if it has no instrument.
+func (j *Jam) Assign(a msg.AssignMsg) (msg.AssignMsg, error) {
+	if a.Channel < 0 || a.Channel > 15 || len(a.Instrument) > maxInstrumentLength ||
+		(a.Program != nil && GMProgramName(*a.Program) == "") {
+		return a, ErrInvalidAssignment
+	}
+
+	if a.Instrument == "" && a.Program != nil {
+		a.Instrument = GMProgramName(*a.Program)
+	}
+
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+
+	if a.Unassign {
+		delete(j.room.assignments, a.UserID)
+		return a, nil
+	}
+
+	for id, other := range j.room.assignments {
+		if id != a.UserID && other.Channel == a.Channel {
+			return a, ErrChannelTaken
+		}
+	}
+	if j.room.takenByZone(a.UserID, a.Channel) {
+		return a, ErrChannelTaken
+	}
+	j.room.assignments[a.UserID] = a
+
+	return a, nil
+}
+
+// unassign frees the channel of a participant who left the jam.
+func (j *Jam) unassign(id uuid.UUID) {
+	j.Client()
+
+	j.room.mu.Lock()
+	_, ok := j.room.assignments[id]
+	delete(j.room.assignments, id)
+	j.room.mu.Unlock()
+
+	if ok {
+		j.Broadcast(msg.ASSIGN, msg.AssignMsg{UserID: id, Unassign: true})
+	}
+}
+
+// Assignments returns the channel and instrument of every participant who
+// has one, by channel.
+func (j *Jam) Assignments() []msg.AssignMsg {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.assigned()
+}
+
+// assigned must be called with the lock held.
+func (r *room) assigned() []msg.AssignMsg {
+	as := make([]msg.AssignMsg, 0, len(r.assignments))
+	for _, a := range r.assignments {
+		as = append(as, a)
+	}
+	sort.Slice(as, func(i, j int) bool { return as[i].Channel < as[j].Channel })
+	return as
+}
+
+func (j *Jam) handleAssign(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	var a msg.AssignMsg
+	if err := e.Unwrap(&a); err != nil {
+		return nil, err
+	}
+
+	if a.UserID == uuid.Nil {
+		a.UserID = from
+	}
+	if a.UserID != from && !j.IsHost(from) {
+		return nil, ErrNotHost
+	}
+
+	a, err := j.Assign(a)
+	if err != nil {
+		return nil, err
+	}
+
+	// relayed so that everyone knows which sound to play for whom
+	if err := e.SetPayload(a); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,116 @@
+package jam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/smf"
+)
+
+var ErrNoNotes = errors.New("MIDI file has no notes")
+
+// BackingTrack is a Standard MIDI File uploaded to a jam to play along with.
+type BackingTrack struct {
+	ID    uuid.UUID `json:"id"`
+	JamID uuid.UUID `json:"jamId"`
+	Name  string    `json:"name"`
+	// Names of the tracks of the file that have notes, see Sequence.
+	Tracks    []string  `json:"tracks,omitempty"`
+	Data      []byte    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Sequence parses the file into a sequence. Beats are counted in quarter
+// notes so that the sequence follows the transport of the jam rather than
+// the tempo map of the file. Tracks without notes are left out.
+func (b BackingTrack) Sequence() (Sequence, error) {
+	f, err := smf.ReadFile(bytes.NewReader(b.Data))
+	if err != nil {
+		return Sequence{}, err
+	}
+
+	if f.Division == 0 {
+		return Sequence{}, errors.New("smf: division must not be 0")
+	}
+	division := float64(f.Division)
+
+	var s Sequence
+	for _, t := range f.Tracks {
+		track := len(s.Tracks)
+
+		var (
+			cues  []Cue
+			notes bool
+		)
+		for _, e := range t {
+			ch, ok := e.Channel()
+			if !ok || len(e.Data) == 0 {
+				continue
+			}
+
+			m, ok := smfMessage(e.Status&0xF0, e.Data)
+			if !ok {
+				continue
+			}
+			m.Channel = int(ch)
+
+			cues = append(cues, Cue{RecordedMsg: RecordedMsg{MIDIMsg: m}, Beat: float64(e.Tick) / division, Track: track})
+			notes = notes || m.IsNote()
+		}
+
+		if !notes {
+			continue
+		}
+		s.Cues = append(s.Cues, cues...)
+
+		name := t.Name()
+		if name == "" {
+			name = fmt.Sprintf("Track %d", track+1)
+		}
+		s.Tracks = append(s.Tracks, name)
+
+		if end := float64(t.End()) / division; end > s.Length {
+			s.Length = end
+		}
+	}
+
+	if len(s.Cues) == 0 {
+		return Sequence{}, ErrNoNotes
+	}
+
+	// tracks play at the same time
+	sort.SliceStable(s.Cues, func(i, j int) bool { return s.Cues[i].Beat < s.Cues[j].Beat })
+	return s, nil
+}
+
+// smfMessage returns the message of a channel event of a Standard MIDI File
+// with the given status, without its channel.
+func smfMessage(status byte, data []byte) (msg.MIDIMsg, bool) {
+	if status == smf.ChannelPressure {
+		return msg.MIDIMsg{State: msg.CHANNEL_PRESSURE, Value: int(data[0])}, true
+	}
+	if len(data) != 2 {
+		return msg.MIDIMsg{}, false
+	}
+
+	switch status {
+	case smf.NoteOn:
+		m := msg.MIDIMsg{Number: int(data[0]), Velocity: int(data[1])}
+		if m.Velocity > 0 {
+			m.State = msg.NOTE_ON
+		}
+		return m, true
+	case smf.NoteOff:
+		return msg.MIDIMsg{State: msg.NOTE_OFF, Number: int(data[0]), Velocity: int(data[1])}, true
+	case smf.ControlChange:
+		return msg.MIDIMsg{State: msg.CONTROL_CHANGE, Number: int(data[0]), Value: int(data[1])}, true
+	case smf.PitchBend:
+		return msg.MIDIMsg{State: msg.PITCH_BEND, Value: int(data[1])<<7 | int(data[0])}, true
+	}
+	return msg.MIDIMsg{}, false
+}
@@ -0,0 +1,99 @@
+package jam
+
+import (
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/smf"
+)
+
+// MIDIFile renders a recording into a Type 1 Standard MIDI File.
+// The first track holds the tempo map and the markers, followed by one track
+// per participant in the order they first played. ms and markers must be in
+// the order they were received.
+func (r Recording) MIDIFile(ms []RecordedMsg, markers []Marker) *smf.File {
+	const division = smf.DefaultDivision
+
+	bpm := r.BPM
+	if bpm == 0 && len(ms) > 0 {
+		bpm = ms[0].BPM
+	}
+	if bpm == 0 {
+		bpm = defaultBPM
+	}
+
+	seq := r.Sequence(ms)
+
+	f := &smf.File{Format: smf.MultiTrack, Division: division}
+	f.Tracks = append(f.Tracks, smf.Track{smf.NewTrackName("Tempo"), smf.NewTempo(0, float64(bpm))})
+	for i, beat := range r.markerBeats(ms, markers) {
+		f.Tracks[0] = append(f.Tracks[0], smf.NewMarker(uint32(beat*division), markers[i].Text))
+	}
+	for _, name := range seq.Tracks {
+		f.Tracks = append(f.Tracks, smf.Track{smf.NewTrackName(name)})
+	}
+
+	for _, c := range seq.Cues {
+		tick := uint32(c.Beat * division)
+
+		if c.BPM != 0 && c.BPM != bpm {
+			bpm = c.BPM
+			f.Tracks[0] = append(f.Tracks[0], smf.NewTempo(tick, float64(bpm)))
+		}
+
+		f.Tracks[c.Track+1] = append(f.Tracks[c.Track+1], smfEvent(tick, c.MIDIMsg))
+	}
+
+	return f
+}
+
+// smfEvent returns the event of a message in a Standard MIDI File.
+func smfEvent(tick uint32, m msg.MIDIMsg) smf.Event {
+	ch := uint8(m.Channel)
+	switch m.State {
+	case msg.NOTE_ON:
+		return smf.NewNoteOn(tick, ch, uint8(m.Number), uint8(m.Velocity))
+	case msg.CONTROL_CHANGE:
+		return smf.NewControlChange(tick, ch, uint8(m.Number), uint8(m.Value))
+	case msg.CHANNEL_PRESSURE:
+		return smf.NewChannelPressure(tick, ch, uint8(m.Value))
+	case msg.PITCH_BEND:
+		return smf.NewPitchBend(tick, ch, uint16(m.Value))
+	}
+	return smf.NewNoteOff(tick, ch, uint8(m.Number), uint8(m.Velocity))
+}
+
+// markerBeats returns the position of each marker from the start of the
+// recording in beats, following the tempo changes of the messages as
+// Sequence does.
+func (r Recording) markerBeats(ms []RecordedMsg, markers []Marker) []float64 {
+	bpm := r.BPM
+	if bpm == 0 && len(ms) > 0 {
+		bpm = ms[0].BPM
+	}
+	if bpm == 0 {
+		bpm = defaultBPM
+	}
+
+	var (
+		beats = make([]float64, len(markers))
+		beat  float64
+		last  = r.StartedAt
+		i     int
+	)
+	for k, mk := range markers {
+		for ; i < len(ms) && !ms[i].At.After(mk.At); i++ {
+			if d := ms[i].At.Sub(last); d > 0 {
+				beat += d.Seconds() * float64(bpm) / 60
+				last = ms[i].At
+			}
+			if ms[i].BPM != 0 {
+				bpm = ms[i].BPM
+			}
+		}
+
+		beats[k] = beat
+		if d := mk.At.Sub(last); d > 0 {
+			beats[k] += d.Seconds() * float64(bpm) / 60
+		}
+	}
+	return beats
+}
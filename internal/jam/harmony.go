@@ -0,0 +1,217 @@
+package jam
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+// noteNames are the names of the pitch classes, C being 0.
+var noteNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// chordShape is a chord quality, as the intervals of its notes from the root.
+type chordShape struct {
+	suffix    string
+	intervals []int
+}
+
+// chordShapes are tried in order, so that the most common reading of a set
+// of notes wins.
+var chordShapes = []chordShape{
+	{"", []int{0, 4, 7}},
+	{"m", []int{0, 3, 7}},
+	{"7", []int{0, 4, 7, 10}},
+	{"maj7", []int{0, 4, 7, 11}},
+	{"m7", []int{0, 3, 7, 10}},
+	{"6", []int{0, 4, 7, 9}},
+	{"m6", []int{0, 3, 7, 9}},
+	{"dim", []int{0, 3, 6}},
+	{"dim7", []int{0, 3, 6, 9}},
+	{"m7b5", []int{0, 3, 6, 10}},
+	{"aug", []int{0, 4, 8}},
+	{"sus2", []int{0, 2, 7}},
+	{"sus4", []int{0, 5, 7}},
+	{"7sus4", []int{0, 5, 7, 10}},
+	{"add9", []int{0, 2, 4, 7}},
+	{"madd9", []int{0, 2, 3, 7}},
+	{"9", []int{0, 2, 4, 7, 10}},
+	{"maj9", []int{0, 2, 4, 7, 11}},
+	{"m9", []int{0, 2, 3, 7, 10}},
+	{"mMaj7", []int{0, 3, 7, 11}},
+	// sevenths are often voiced without their fifth
+	{"7", []int{0, 4, 10}},
+	{"maj7", []int{0, 4, 11}},
+	{"m7", []int{0, 3, 10}},
+	{"5", []int{0, 7}},
+}
+
+// DetectChord names the chord made by a set of MIDI note numbers, in any
+// order. A reading rooted on the lowest note is preferred, other readings
+// are named over their bass, such as "C/E". The chord is empty if the notes
+// do not make one.
+func DetectChord(numbers []int) msg.ChordMsg {
+	if len(numbers) == 0 {
+		return msg.ChordMsg{}
+	}
+
+	var set uint16
+	bass := numbers[0]
+	for _, n := range numbers {
+		set |= 1 << ((n%12 + 12) % 12)
+		if n < bass {
+			bass = n
+		}
+	}
+	bassClass := (bass%12 + 12) % 12
+
+	if shape, ok := matchChord(set, bassClass); ok {
+		name := noteNames[bassClass]
+		return msg.ChordMsg{Name: name + shape.suffix, Root: name, Bass: name}
+	}
+
+	// otherwise the most common shape of any inversion
+	for _, shape := range chordShapes {
+		for root := 0; root < 12; root++ {
+			if shapeSet(root, shape.intervals) == set {
+				c := msg.ChordMsg{Root: noteNames[root], Bass: noteNames[bassClass]}
+				c.Name = c.Root + shape.suffix + "/" + c.Bass
+				return c
+			}
+		}
+	}
+
+	return msg.ChordMsg{}
+}
+
+// matchChord returns the first shape rooted on root that makes the set of pitch classes.
+func matchChord(set uint16, root int) (chordShape, bool) {
+	for _, shape := range chordShapes {
+		if shapeSet(root, shape.intervals) == set {
+			return shape, true
+		}
+	}
+	return chordShape{}, false
+}
+
+// shapeSet returns the set of pitch classes of a shape rooted on root.
+func shapeSet(root int, intervals []int) uint16 {
+	var set uint16
+	for _, i := range intervals {
+		set |= 1 << ((root + i) % 12)
+	}
+	return set
+}
+
+// Chord returns the chord being played in a live jam, empty if the notes
+// held do not make one.
+func (j *Jam) Chord() msg.ChordMsg {
+	j.Client()
+
+	j.room.harmonyMu.Lock()
+	defer j.room.harmonyMu.Unlock()
+	return j.room.chord
+}
+
+// analyze follows the notes sounding across the jam as a message is relayed.
+// It returns the chord they make if it changed, for the caller to announce
+// once the message itself is relayed. The change is marked in the recording
+// of the jam, if any.
+func (j *Jam) analyze(from uuid.UUID, m msg.MIDIMsg, at time.Time) *msg.ChordMsg {
+	if m.Channel == percussionChannel || !m.IsNote() {
+		return nil
+	}
+
+	j.Client()
+
+	r := j.room
+	r.harmonyMu.Lock()
+	n := participantNote{from, m.Channel, m.Number}
+	if m.State == msg.NOTE_ON && m.Velocity > 0 {
+		r.sounding[n] = true
+	} else {
+		delete(r.sounding, n)
+	}
+
+	c, changed := j.rechord(at)
+	r.harmonyMu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return &c
+}
+
+// announce tells the jam the chords that changed as a message was relayed.
+// It is called once the message is, so that no chord is heard of before
+// the notes that make it.
+func (j *Jam) announce(chords ...*msg.ChordMsg) {
+	for _, c := range chords {
+		if c != nil {
+			j.Broadcast(msg.CHORD, *c)
+		}
+	}
+}
+
+// relayAnnounced returns e for its handler to return, or relays it then
+// announces chords if any changed as e was handled.
+func (j *Jam) relayAnnounced(e *msg.Envelope, chords ...*msg.ChordMsg) (*msg.Envelope, error) {
+	for _, c := range chords {
+		if c != nil {
+			if err := j.broadcastEnvelope(e); err != nil {
+				return nil, err
+			}
+			j.announce(chords...)
+			return nil, nil
+		}
+	}
+	return e, nil
+}
+
+// silence drops the notes held by a participant who left the jam, and tells
+// the jam if the chord changes.
+func (j *Jam) silence(id uuid.UUID) {
+	j.Client()
+
+	r := j.room
+	r.harmonyMu.Lock()
+	for n := range r.sounding {
+		if n.userID == id {
+			delete(r.sounding, n)
+		}
+	}
+
+	c, changed := j.rechord(time.Now())
+	r.harmonyMu.Unlock()
+
+	if changed {
+		j.Broadcast(msg.CHORD, c)
+	}
+}
+
+// rechord names the chord of the notes sounding, and reports whether it
+// changed. A new chord is marked in the recording of the jam, if any.
+// It must be called with harmonyMu held.
+func (j *Jam) rechord(at time.Time) (msg.ChordMsg, bool) {
+	r := j.room
+
+	numbers := make([]int, 0, len(r.sounding))
+	for n := range r.sounding {
+		numbers = append(numbers, n.number)
+	}
+
+	c := DetectChord(numbers)
+	if c == r.chord {
+		return c, false
+	}
+	r.chord = c
+
+	if c.Name != "" {
+		r.mu.RLock()
+		if r.recorder != nil {
+			r.recorder.Mark(Marker{Text: c.Name, BPM: j.BPM, At: at})
+		}
+		r.mu.RUnlock()
+	}
+	return c, true
+}
@@ -0,0 +1,31 @@
+package jam
+
+import (
+	"testing"
+
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectChord(t *testing.T) {
+	for _, tc := range []struct {
+		numbers []int
+		want    msg.ChordMsg
+	}{
+		{nil, msg.ChordMsg{}},
+		{[]int{60}, msg.ChordMsg{}},
+		{[]int{60, 61, 62}, msg.ChordMsg{}},
+		{[]int{60, 64, 67}, msg.ChordMsg{Name: "C", Root: "C", Bass: "C"}},
+		{[]int{67, 60, 64}, msg.ChordMsg{Name: "C", Root: "C", Bass: "C"}},
+		{[]int{57, 60, 64}, msg.ChordMsg{Name: "Am", Root: "A", Bass: "A"}},
+		{[]int{55, 59, 62, 65}, msg.ChordMsg{Name: "G7", Root: "G", Bass: "G"}},
+		{[]int{62, 65, 69, 72}, msg.ChordMsg{Name: "Dm7", Root: "D", Bass: "D"}},
+		{[]int{59, 62, 65}, msg.ChordMsg{Name: "Bdim", Root: "B", Bass: "B"}},
+		{[]int{60, 64, 70}, msg.ChordMsg{Name: "C7", Root: "C", Bass: "C"}},
+		{[]int{48, 55}, msg.ChordMsg{Name: "C5", Root: "C", Bass: "C"}},
+		{[]int{64, 67, 72}, msg.ChordMsg{Name: "C/E", Root: "C", Bass: "E"}},
+		{[]int{43, 60, 64, 72}, msg.ChordMsg{Name: "C/G", Root: "C", Bass: "G"}},
+	} {
+		require.Equal(t, tc.want, DetectChord(tc.numbers), "%v", tc.numbers)
+	}
+}
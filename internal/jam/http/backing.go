@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/jam"
+)
+
+// maxBackingTrackSize is the largest MIDI file accepted as a backing track.
+const maxBackingTrackSize = 1 << 20
+
+// handleUploadBackingTrack stores the Standard MIDI File in the body of the
+// request as a backing track of the jam. It is named after the "name"
+// query parameter.
+func (s *Service) handleUploadBackingTrack() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBackingTrackSize))
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		b := jam.BackingTrack{JamID: found.ID, Name: r.URL.Query().Get("name"), Data: data}
+		if b.Name == "" {
+			b.Name = "Backing track"
+		}
+
+		seq, err := b.Sequence()
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		created, err := s.repo.CreateBackingTrack(r.Context(), b)
+		if err != nil {
+			s.mux.Logf("createBackingTrack: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		created.Tracks = seq.Tracks
+		s.mux.Respond(w, r, created, http.StatusCreated)
+	}
+}
+
+func (s *Service) handleListBackingTracks() http.HandlerFunc {
+	type response struct {
+		Tracks []jam.BackingTrack `json:"tracks"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !s.canRead(r, found) {
+			s.mux.RespondText(w, r, http.StatusForbidden)
+			return
+		}
+
+		bs, err := s.repo.GetBackingTracks(r.Context(), jamID)
+		if err != nil {
+			s.mux.Logf("getBackingTracks: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.mux.Respond(w, r, response{Tracks: bs}, http.StatusOK)
+	}
+}
+
+// handleStartBacking starts playing a backing track on the next bar of the jam.
+// Every note is played on "channel" if it is set, otherwise on the channels of the file.
+func (s *Service) handleStartBacking() http.HandlerFunc {
+	type request struct {
+		TrackID uuid.UUID `json:"trackId"`
+		Loop    bool      `json:"loop"`
+		Channel *int      `json:"channel"`
+		Muted   []int     `json:"muted"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		var req request
+		if err := s.mux.Decode(w, r, &req); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if req.Channel != nil && (*req.Channel < 0 || *req.Channel > 15) {
+			s.mux.Respond(w, r, errors.New("channel must be between 0 and 15"), http.StatusBadRequest)
+			return
+		}
+
+		b, err := s.repo.GetBackingTrackByID(r.Context(), req.TrackID)
+		if err != nil || b.JamID != found.ID {
+			s.mux.RespondText(w, r, http.StatusNotFound)
+			return
+		}
+
+		seq, err := b.Sequence()
+		if err != nil {
+			s.mux.Logf("sequence: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if req.Channel != nil {
+			seq.SetChannel(*req.Channel)
+		}
+
+		p, err := s.loadJam(found).PlayBacking(b.ID, seq, req.Loop)
+		if errors.Is(err, jam.ErrPlaying) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("playBacking: %v\n", err)
+		}
+
+		if len(req.Muted) > 0 {
+			if err := p.SetMuted(req.Muted); err != nil {
+				s.mux.Logf("setMuted: %v\n", err)
+			}
+		}
+
+		s.mux.Respond(w, r, p.Status(), http.StatusCreated)
+	}
+}
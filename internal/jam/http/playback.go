@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/jam"
+)
+
+// hostJam returns the jam of the request if the user of the request is its host.
+// The error response has been written if ok is false.
+func (s *Service) hostJam(w http.ResponseWriter, r *http.Request) (found jam.Jam, ok bool) {
+	jamID, err := parseUUID(r)
+	if err != nil {
+		s.mux.Respond(w, r, err, http.StatusBadRequest)
+		return found, false
+	}
+
+	userID, err := s.identify(r)
+	if err != nil {
+		s.mux.Respond(w, r, err, http.StatusUnauthorized)
+		return found, false
+	}
+
+	found, err = s.repo.GetJamByID(r.Context(), jamID)
+	if err != nil {
+		s.mux.Respond(w, r, err, http.StatusNotFound)
+		return found, false
+	}
+
+	if !found.IsHost(userID) {
+		s.mux.Respond(w, r, jam.ErrNotHost, http.StatusForbidden)
+		return found, false
+	}
+
+	return found, true
+}
+
+func (s *Service) handleStartPlayback() http.HandlerFunc {
+	type request struct {
+		RecordingID uuid.UUID `json:"recordingId"`
+		Loop        bool      `json:"loop"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.recordings == nil {
+			s.mux.Respond(w, r, errNoRecordings, http.StatusNotImplemented)
+			return
+		}
+
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		var req request
+		if err := s.mux.Decode(w, r, &req); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		recording, err := s.recordings.GetRecordingByID(r.Context(), req.RecordingID)
+		if err != nil || recording.JamID != found.ID {
+			s.mux.RespondText(w, r, http.StatusNotFound)
+			return
+		}
+
+		ms, err := s.recordings.GetRecordedMsgs(r.Context(), recording.ID)
+		if err != nil {
+			s.mux.Logf("getRecordedMsgs: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		p, err := s.loadJam(found).Play(recording.ID, recording.Sequence(ms), req.Loop)
+		if errors.Is(err, jam.ErrPlaying) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("play: %v\n", err)
+		}
+
+		s.mux.Respond(w, r, p.Status(), http.StatusCreated)
+	}
+}
+
+// handleUpdatePlayback pauses, resumes, seeks, loops or mutes tracks of the
+// current playback of a recording, or of a backing track.
+// Fields left out of the request are unchanged.
+func (s *Service) handleUpdatePlayback(backing bool) http.HandlerFunc {
+	type request struct {
+		Paused *bool    `json:"paused"`
+		Loop   *bool    `json:"loop"`
+		Beat   *float64 `json:"beat"`
+		Muted  *[]int   `json:"muted"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		var req request
+		if err := s.mux.Decode(w, r, &req); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		p, ok := s.player(found.ID, backing)
+		if !ok {
+			s.mux.Respond(w, r, jam.ErrNotPlaying, http.StatusConflict)
+			return
+		}
+
+		// pausing first so a paused playback stays where it was moved to
+		var err error
+		if req.Paused != nil {
+			err = p.Pause(*req.Paused)
+		}
+		if req.Beat != nil && err == nil {
+			err = p.Seek(*req.Beat)
+		}
+		if req.Loop != nil && err == nil {
+			err = p.SetLoop(*req.Loop)
+		}
+		if req.Muted != nil && err == nil {
+			err = p.SetMuted(*req.Muted)
+		}
+
+		if errors.Is(err, jam.ErrNotPlaying) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("updatePlayback: %v\n", err)
+		}
+
+		s.mux.Respond(w, r, p.Status(), http.StatusOK)
+	}
+}
+
+func (s *Service) handleStopPlayback(backing bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		p, ok := s.player(found.ID, backing)
+		if !ok {
+			s.mux.Respond(w, r, jam.ErrNotPlaying, http.StatusConflict)
+			return
+		}
+
+		err := p.Stop()
+		if errors.Is(err, jam.ErrNotPlaying) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("stopPlayback: %v\n", err)
+		}
+
+		s.mux.Respond(w, r, p.Status(), http.StatusOK)
+	}
+}
+
+// player returns the current playback of a recording or of a backing track of a live jam.
+func (s *Service) player(jamID uuid.UUID, backing bool) (*jam.Player, bool) {
+	live, ok := s.wsb.Load(jamID)
+	if !ok {
+		return nil, false
+	}
+
+	if backing {
+		return live.Backing()
+	}
+	return live.Player()
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/jam"
+	jamDB "github.com/rapidmidiex/rmx/internal/jam/postgres"
+)
+
+// recordBuffer is the number of messages a recorder holds before it drops
+// new ones, rather than have the jam wait for them to be stored.
+const recordBuffer = 1024
+
+var errNoRecordings = errors.New("recordings are not enabled")
+
+// recorder writes the MIDI messages and markers of a live jam to the
+// recordings repo, off the connections of the participants.
+type recorder struct {
+	id   uuid.UUID
+	repo jamDB.RecordingRepo
+	logf func(format string, v ...any)
+
+	ch   chan recorded
+	done chan struct{}
+	// messages that did not fit in the buffer
+	dropped atomic.Uint64
+}
+
+// recorded is either a message or a marker, in the order they were received.
+type recorded struct {
+	msg    *jam.RecordedMsg
+	marker *jam.Marker
+}
+
+func (s *Service) newRecorder(id uuid.UUID) *recorder {
+	r := &recorder{
+		id:   id,
+		repo: s.recordings,
+		logf: s.mux.Logf,
+		ch:   make(chan recorded, recordBuffer),
+		done: make(chan struct{}),
+	}
+
+	go r.run()
+	return r
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+
+	for e := range r.ch {
+		if e.marker != nil {
+			if err := r.repo.AddMarker(context.Background(), r.id, *e.marker); err != nil {
+				r.logf("addMarker: %v\n", err)
+			}
+			continue
+		}
+
+		if err := r.repo.AddRecordedMsg(context.Background(), r.id, *e.msg); err != nil {
+			r.logf("addRecordedMsg: %v\n", err)
+		}
+	}
+}
+
+func (r *recorder) Record(m jam.RecordedMsg) { r.send(recorded{msg: &m}) }
+
+func (r *recorder) Mark(m jam.Marker) { r.send(recorded{marker: &m}) }
+
+// send never blocks as it is called with the jam locked.
+func (r *recorder) send(e recorded) {
+	select {
+	case r.ch <- e:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+func (r *recorder) Close() error {
+	close(r.ch)
+	<-r.done
+
+	if n := r.dropped.Load(); n > 0 {
+		r.logf("recording %s: dropped %d messages\n", r.id, n)
+	}
+	return nil
+}
+
+func (s *Service) handleStartRecording() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.recordings == nil {
+			s.mux.Respond(w, r, errNoRecordings, http.StatusNotImplemented)
+			return
+		}
+
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		userID, err := s.identify(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !found.IsHost(userID) {
+			s.mux.Respond(w, r, jam.ErrNotHost, http.StatusForbidden)
+			return
+		}
+
+		loaded := s.loadJam(found)
+		if _, ok := loaded.Recording(); ok {
+			s.mux.Respond(w, r, jam.ErrRecording, http.StatusConflict)
+			return
+		}
+
+		// stamped by the clock of the messages, see jam.RecordedMsg
+		created, err := s.recordings.CreateRecording(r.Context(), jam.Recording{JamID: jamID, BPM: found.BPM, StartedAt: time.Now()})
+		if err != nil {
+			s.mux.Logf("createRecording: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err := loaded.StartRecording(created.ID, s.newRecorder(created.ID)); err != nil {
+			// lost a race with another request
+			if err := s.recordings.DeleteRecording(context.Background(), created.ID); err != nil {
+				s.mux.Logf("deleteRecording: %v\n", err)
+			}
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+
+		s.mux.Respond(w, r, created, http.StatusCreated)
+	}
+}
+
+func (s *Service) handleStopRecording() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.recordings == nil {
+			s.mux.Respond(w, r, errNoRecordings, http.StatusNotImplemented)
+			return
+		}
+
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		userID, err := s.identify(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !found.IsHost(userID) {
+			s.mux.Respond(w, r, jam.ErrNotHost, http.StatusForbidden)
+			return
+		}
+
+		live, ok := s.wsb.Load(jamID)
+		if !ok {
+			s.mux.Respond(w, r, jam.ErrNotRecording, http.StatusConflict)
+			return
+		}
+
+		id, err := live.StopRecording()
+		if errors.Is(err, jam.ErrNotRecording) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("stopRecording: %v\n", err)
+		}
+
+		stopped, err := s.recordings.StopRecording(r.Context(), id, time.Now())
+		if err != nil {
+			s.mux.Logf("stopRecording: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.mux.Respond(w, r, stopped, http.StatusOK)
+	}
+}
+
+func (s *Service) handleListRecordings() http.HandlerFunc {
+	type response struct {
+		Recordings []jam.Recording `json:"recordings"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.recordings == nil {
+			s.mux.Respond(w, r, errNoRecordings, http.StatusNotImplemented)
+			return
+		}
+
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !s.canRead(r, found) {
+			s.mux.RespondText(w, r, http.StatusForbidden)
+			return
+		}
+
+		rs, err := s.recordings.GetRecordings(r.Context(), jamID)
+		if err != nil {
+			s.mux.Logf("getRecordings: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.mux.Respond(w, r, response{Recordings: rs}, http.StatusOK)
+	}
+}
+
+// handleExportRecording renders a recording into a Standard MIDI File.
+func (s *Service) handleExportRecording() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.recordings == nil {
+			s.mux.Respond(w, r, errNoRecordings, http.StatusNotImplemented)
+			return
+		}
+
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		recordingID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !s.canRead(r, found) {
+			s.mux.RespondText(w, r, http.StatusForbidden)
+			return
+		}
+
+		recording, err := s.recordings.GetRecordingByID(r.Context(), recordingID)
+		if err != nil || recording.JamID != jamID {
+			s.mux.RespondText(w, r, http.StatusNotFound)
+			return
+		}
+
+		ms, err := s.recordings.GetRecordedMsgs(r.Context(), recordingID)
+		if err != nil {
+			s.mux.Logf("getRecordedMsgs: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		markers, err := s.recordings.GetMarkers(r.Context(), recordingID)
+		if err != nil {
+			s.mux.Logf("getMarkers: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "audio/midi")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", recordingID.String()+".mid"))
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := recording.MIDIFile(ms, markers).WriteTo(w); err != nil {
+			s.mux.Logf("writeMIDIFile: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	session "github.com/rapidmidiex/rmx/internal/jam/rtpmidi"
+)
+
+var (
+	errNoRTPMIDI   = errors.New("RTP-MIDI sessions are not enabled")
+	errNoSession   = errors.New("jam has no RTP-MIDI session")
+	errSessionOpen = errors.New("jam already has an RTP-MIDI session")
+)
+
+// handleOpenSession starts the RTP-MIDI session of a jam, on any free pair
+// of ports of the host set with WithRTPMIDI.
+func (s *Service) handleOpenSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.rtpMIDIHost == "" {
+			s.mux.Respond(w, r, errNoRTPMIDI, http.StatusNotImplemented)
+			return
+		}
+
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		s.sessionsMu.Lock()
+		defer s.sessionsMu.Unlock()
+
+		if _, ok := s.sessions[found.ID]; ok {
+			s.mux.Respond(w, r, errSessionOpen, http.StatusConflict)
+			return
+		}
+
+		l, err := session.Listen(s.loadJam(found), net.JoinHostPort(s.rtpMIDIHost, "0"), session.WithLogger(s.mux.Logf))
+		if err != nil {
+			s.mux.Logf("listen: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		s.sessions[found.ID] = l
+
+		s.mux.Respond(w, r, l.Status(), http.StatusCreated)
+	}
+}
+
+func (s *Service) handleGetSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		s.sessionsMu.Lock()
+		l, ok := s.sessions[found.ID]
+		s.sessionsMu.Unlock()
+		if !ok {
+			s.mux.Respond(w, r, errNoSession, http.StatusConflict)
+			return
+		}
+
+		s.mux.Respond(w, r, l.Status(), http.StatusOK)
+	}
+}
+
+// handleCloseSession ends the sessions of the peers of a jam.
+func (s *Service) handleCloseSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		s.sessionsMu.Lock()
+		l, ok := s.sessions[found.ID]
+		delete(s.sessions, found.ID)
+		s.sessionsMu.Unlock()
+		if !ok {
+			s.mux.Respond(w, r, errNoSession, http.StatusConflict)
+			return
+		}
+
+		if err := l.Close(); err != nil {
+			s.mux.Logf("closeSession: %v\n", err)
+		}
+
+		s.mux.RespondText(w, r, http.StatusNoContent)
+	}
+}
+
+// closeSessions ends every RTP-MIDI session.
+func (s *Service) closeSessions() {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	for id, l := range s.sessions {
+		if err := l.Close(); err != nil {
+			s.mux.Logf("closeSession: %v\n", err)
+		}
+		delete(s.sessions, id)
+	}
+}
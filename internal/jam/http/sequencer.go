@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rapidmidiex/rmx/internal/jam"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+// handleSetSequencer lays out the step sequencer of the jam, replacing every step.
+// Participants toggle steps over the websocket.
+func (s *Service) handleSetSequencer() http.HandlerFunc {
+	type request struct {
+		Steps        int                  `json:"steps"`
+		StepsPerBeat int                  `json:"stepsPerBeat"`
+		Tracks       []msg.SequencerTrack `json:"tracks"`
+		Playing      *bool                `json:"playing"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		var req request
+		if err := s.mux.Decode(w, r, &req); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		live := s.loadJam(found)
+		seq, err := live.SetStepSequencer(req.Steps, req.StepsPerBeat, req.Tracks)
+		if errors.Is(err, jam.ErrInvalidSequencer) {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, jam.ErrNoSequencer) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("setStepSequencer: %v\n", err)
+		}
+
+		if req.Playing != nil {
+			if err := seq.SetPlaying(*req.Playing); err != nil {
+				s.mux.Logf("setPlaying: %v\n", err)
+			}
+		}
+
+		s.mux.Respond(w, r, seq.Status(), http.StatusOK)
+	}
+}
+
+func (s *Service) handleGetSequencer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !s.canRead(r, found) {
+			s.mux.RespondText(w, r, http.StatusForbidden)
+			return
+		}
+
+		seq, ok := s.sequencer(found)
+		if !ok {
+			s.mux.Respond(w, r, jam.ErrNoSequencer, http.StatusNotFound)
+			return
+		}
+
+		s.mux.Respond(w, r, seq.Status(), http.StatusOK)
+	}
+}
+
+// handleUpdateSequencer starts or stops playing the pattern of the step sequencer.
+func (s *Service) handleUpdateSequencer() http.HandlerFunc {
+	type request struct {
+		Playing bool `json:"playing"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		var req request
+		if err := s.mux.Decode(w, r, &req); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		seq, ok := s.sequencer(found)
+		if !ok {
+			s.mux.Respond(w, r, jam.ErrNoSequencer, http.StatusConflict)
+			return
+		}
+
+		err := seq.SetPlaying(req.Playing)
+		if errors.Is(err, jam.ErrNoSequencer) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("setPlaying: %v\n", err)
+		}
+
+		s.mux.Respond(w, r, seq.Status(), http.StatusOK)
+	}
+}
+
+func (s *Service) handleRemoveSequencer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, ok := s.hostJam(w, r)
+		if !ok {
+			return
+		}
+
+		live, ok := s.wsb.Load(found.ID)
+		if !ok {
+			s.mux.Respond(w, r, jam.ErrNoSequencer, http.StatusConflict)
+			return
+		}
+
+		err := live.RemoveStepSequencer()
+		if errors.Is(err, jam.ErrNoSequencer) {
+			s.mux.Respond(w, r, err, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.mux.Logf("removeStepSequencer: %v\n", err)
+		}
+
+		s.mux.Respond(w, r, msg.SequencerMsg{}, http.StatusOK)
+	}
+}
+
+// sequencer returns the step sequencer of a live jam.
+func (s *Service) sequencer(found jam.Jam) (*jam.StepSequencer, bool) {
+	live, ok := s.wsb.Load(found.ID)
+	if !ok {
+		return nil, false
+	}
+	return live.StepSequencer()
+}
@@ -2,31 +2,93 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/hyphengolang/prelude/types/suid"
 	service "github.com/rapidmidiex/rmx/internal/http"
 	"github.com/rapidmidiex/rmx/internal/jam"
 	jamDB "github.com/rapidmidiex/rmx/internal/jam/postgres"
+	session "github.com/rapidmidiex/rmx/internal/jam/rtpmidi"
+	"github.com/rapidmidiex/rmx/internal/msg"
 	"github.com/rapidmidiex/rmx/pkg/fp"
+	"github.com/rapidmidiex/rmx/pkg/websocket"
+)
+
+var (
+	errNoIdentity        = errors.New("missing identity token")
+	errTooManyIdentities = errors.New("too many identities created, try again later")
+)
+
+// identityBurst identities may be created at once from an address, then one
+// every identityInterval. Bans are per identity, this is what keeps a banned
+// participant from rejoining right away as someone new.
+const (
+	identityBurst    = 10
+	identityInterval = 6 * time.Second
 )
 
 type Service struct {
 	mux service.Service
 
-	wsb  jam.Broker
-	repo jamDB.Repo
+	wsb        jam.Broker
+	repo       jamDB.Repo
+	recordings jamDB.RecordingRepo
+	invites    *jam.InviteSigner
+	identities *jam.IdentitySigner
+	// identities created by remote address, see handleCreateUser
+	createdMu sync.Mutex
+	created   map[string]*identityBucket
+	// overrides jam.DefaultCompression if set
+	compression *websocket.Compression
+
+	// RTP-MIDI sessions listen on rtpMIDIHost, disabled if empty
+	rtpMIDIHost string
+	sessionsMu  sync.Mutex
+	sessions    map[uuid.UUID]*session.Listener
 }
 
 // NOTE broker should be a dependency
-func New(ctx context.Context, r jamDB.Repo) *Service {
+func New(ctx context.Context, r jamDB.Repo, opts ...Option) *Service {
 	s := Service{
-		mux:  service.New(),
-		repo: r,
-		wsb:  jam.NewBroker(),
+		mux:      service.New(),
+		repo:     r,
+		wsb:      jam.NewBroker(),
+		created:  make(map[string]*identityBucket),
+		sessions: make(map[uuid.UUID]*session.Listener),
+	}
+
+	for _, o := range opts {
+		o(&s)
+	}
+
+	if s.invites == nil {
+		// tokens will not survive a restart, see WithInviteKey
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		WithInviteKey(key)(&s)
 	}
+
+	if s.rtpMIDIHost != "" {
+		go func() {
+			<-ctx.Done()
+			s.closeSessions()
+		}()
+	}
+
 	s.routes()
 	return &s
 }
@@ -36,9 +98,33 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) routes() {
+	s.mux.Post("/v0/users", s.handleCreateUser())
+
 	s.mux.Post("/v0/jams", s.handleCreateJam())
 	s.mux.Get("/v0/jams", s.handleListJams())
 	s.mux.Get("/v0/jams/{uuid}", s.handleGetJam())
+	s.mux.Patch("/v0/jams/{uuid}", s.handleUpdateJam())
+	s.mux.Post("/v0/jams/{uuid}/invites", s.handleCreateInvite())
+	s.mux.Get("/v0/jams/{uuid}/messages", s.handleListMessages())
+	s.mux.Post("/v0/jams/{uuid}/recordings", s.handleStartRecording())
+	s.mux.Post("/v0/jams/{uuid}/recordings/stop", s.handleStopRecording())
+	s.mux.Get("/v0/jams/{uuid}/recordings", s.handleListRecordings())
+	s.mux.Get("/v0/jams/{uuid}/recordings/{id}.mid", s.handleExportRecording())
+	s.mux.Post("/v0/jams/{uuid}/playback", s.handleStartPlayback())
+	s.mux.Patch("/v0/jams/{uuid}/playback", s.handleUpdatePlayback(false))
+	s.mux.Delete("/v0/jams/{uuid}/playback", s.handleStopPlayback(false))
+	s.mux.Post("/v0/jams/{uuid}/tracks", s.handleUploadBackingTrack())
+	s.mux.Get("/v0/jams/{uuid}/tracks", s.handleListBackingTracks())
+	s.mux.Post("/v0/jams/{uuid}/backing", s.handleStartBacking())
+	s.mux.Patch("/v0/jams/{uuid}/backing", s.handleUpdatePlayback(true))
+	s.mux.Delete("/v0/jams/{uuid}/backing", s.handleStopPlayback(true))
+	s.mux.Put("/v0/jams/{uuid}/sequencer", s.handleSetSequencer())
+	s.mux.Get("/v0/jams/{uuid}/sequencer", s.handleGetSequencer())
+	s.mux.Patch("/v0/jams/{uuid}/sequencer", s.handleUpdateSequencer())
+	s.mux.Delete("/v0/jams/{uuid}/sequencer", s.handleRemoveSequencer())
+	s.mux.Post("/v0/jams/{uuid}/rtpmidi", s.handleOpenSession())
+	s.mux.Get("/v0/jams/{uuid}/rtpmidi", s.handleGetSession())
+	s.mux.Delete("/v0/jams/{uuid}/rtpmidi", s.handleCloseSession())
 
 	s.mux.Get("/v0/jams/{uuid}/ws", s.handleP2PConn())
 }
@@ -52,8 +138,52 @@ func (s *Service) handleCreateJam() http.HandlerFunc {
 			return
 		}
 
+		// the jam is owned by whoever creates it, if they are identified
+		switch ownerID, err := s.identify(r); {
+		case err == nil:
+			j.Owner = &jam.User{ID: suid.UUID{UUID: ownerID}}
+		case !errors.Is(err, errNoIdentity):
+			s.mux.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
 		j.SetDefaults()
 
+		if !j.Visibility.Valid() {
+			s.mux.Respond(w, r, jam.ErrInvalidVisibility, http.StatusBadRequest)
+			return
+		}
+
+		if !jam.ValidQuantize(j.Quantize, j.QuantizeStrength) {
+			s.mux.Respond(w, r, jam.ErrInvalidQuantize, http.StatusBadRequest)
+			return
+		}
+
+		if err := jam.ValidScale(j.Key, j.Scale, j.ScaleMode); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		manufacturers, err := jam.ParseManufacturers(j.SysExManufacturers)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+		j.SysExManufacturers = manufacturers
+
+		if err := jam.ValidSysEx(j.SysExMaxSize, j.SysExManufacturers); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if j.Passcode != "" {
+			if err := j.SetPasscode(j.Passcode); err != nil {
+				s.mux.Logf("setPasscode: %v\n", err)
+				s.mux.Respond(w, r, err, http.StatusBadRequest)
+				return
+			}
+		}
+
 		created, err := s.repo.CreateJam(r.Context(), j)
 		if err != nil {
 			s.mux.Logf("createJam: %v\n", err)
@@ -65,6 +195,70 @@ func (s *Service) handleCreateJam() http.HandlerFunc {
 	}
 }
 
+// handleCreateUser issues the id of a new participant with the token they are
+// identified by, see identify. Anyone may get one, so identities are only
+// rate limited by address: a ban holds until the banned participant gets a
+// new identity, from another address or after identityInterval.
+func (s *Service) handleCreateUser() http.HandlerFunc {
+	type response struct {
+		ID    uuid.UUID `json:"id"`
+		Token string    `json:"token"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if wait := s.takeIdentity(r.RemoteAddr, time.Now()); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			s.mux.Respond(w, r, errTooManyIdentities, http.StatusTooManyRequests)
+			return
+		}
+
+		id := uuid.New()
+		s.mux.Respond(w, r, response{ID: id, Token: s.identities.Sign(id)}, http.StatusCreated)
+	}
+}
+
+// identityBucket holds the identities created from an address, draining one
+// every identityInterval.
+type identityBucket struct {
+	level float64
+	last  time.Time
+}
+
+// takeIdentity counts a new identity created from addr. It returns how long
+// to wait for if addr already created identityBurst of them.
+func (s *Service) takeIdentity(addr string, now time.Time) time.Duration {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	s.createdMu.Lock()
+	defer s.createdMu.Unlock()
+
+	drain := func(b *identityBucket) {
+		b.level = math.Max(0, b.level-float64(now.Sub(b.last))/float64(identityInterval))
+		b.last = now
+	}
+
+	// the buckets of the other addresses are forgotten once empty
+	for a, b := range s.created {
+		if drain(b); b.level == 0 && a != addr {
+			delete(s.created, a)
+		}
+	}
+
+	b, ok := s.created[addr]
+	if !ok {
+		b = &identityBucket{last: now}
+		s.created[addr] = b
+	}
+
+	if b.level+1 > identityBurst {
+		return time.Duration((b.level + 1 - identityBurst) * float64(identityInterval))
+	}
+	b.level++
+	return 0
+}
+
 func (s *Service) handleGetJam() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// NOTE move to middleware
@@ -75,21 +269,237 @@ func (s *Service) handleGetJam() http.HandlerFunc {
 			return
 		}
 
-		jam, err := s.repo.GetJamByID(r.Context(), jamID)
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
 		if err != nil {
 			s.mux.Logf("getJamByID: %v\n", err)
 			s.mux.Respond(w, r, err, http.StatusNotFound)
 			return
 		}
 
-		s.mux.Respond(w, r, jam, http.StatusOK)
+		// private jams are only described to their members
+		if !s.canRead(r, found) {
+			found = jam.Jam{ID: found.ID, Visibility: found.Visibility}
+		}
+
+		s.mux.Respond(w, r, s.redact(r, found), http.StatusOK)
+	}
+}
+
+func (s *Service) handleUpdateJam() http.HandlerFunc {
+	type request struct {
+		BPM              uint         `json:"bpm"`
+		Capacity         uint         `json:"capacity"`
+		Quantize         jam.Quantize `json:"quantize"`
+		QuantizeStrength uint         `json:"quantizeStrength"`
+		// an empty key clears the scale, a missing one leaves it unchanged
+		Key          *string        `json:"key"`
+		Scale        *jam.Scale     `json:"scale"`
+		ScaleMode    *jam.ScaleMode `json:"scaleMode"`
+		SysExMaxSize uint           `json:"sysExMaxSize"`
+		// an empty list stops SysEx, a missing one leaves it unchanged
+		SysExManufacturers []msg.Manufacturer `json:"sysExManufacturers"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		userID, err := s.identify(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !found.IsHost(userID) {
+			s.mux.Respond(w, r, jam.ErrNotHost, http.StatusForbidden)
+			return
+		}
+
+		var req request
+		if err := s.mux.Decode(w, r, &req); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		// zero values are left unchanged
+		if req.BPM != 0 {
+			found.BPM = req.BPM
+		}
+		if req.Capacity != 0 {
+			found.Capacity = req.Capacity
+		}
+		if req.Quantize != "" {
+			found.Quantize = req.Quantize
+		}
+		if req.QuantizeStrength != 0 {
+			found.QuantizeStrength = req.QuantizeStrength
+		}
+
+		if req.Key != nil {
+			found.Key = *req.Key
+			// a jam without a key has no scale to enforce
+			if found.Key == "" {
+				found.Scale, found.ScaleMode = "", jam.ScaleOff
+			}
+		}
+		if req.Scale != nil {
+			found.Scale = *req.Scale
+		}
+		if req.ScaleMode != nil {
+			found.ScaleMode = *req.ScaleMode
+		}
+		if req.SysExMaxSize != 0 {
+			found.SysExMaxSize = req.SysExMaxSize
+		}
+		if req.SysExManufacturers != nil {
+			if found.SysExManufacturers, err = jam.ParseManufacturers(req.SysExManufacturers); err != nil {
+				s.mux.Respond(w, r, err, http.StatusBadRequest)
+				return
+			}
+		}
+		// a key set without a scale is major
+		found.SetDefaults()
+
+		if !jam.ValidQuantize(found.Quantize, found.QuantizeStrength) {
+			s.mux.Respond(w, r, jam.ErrInvalidQuantize, http.StatusBadRequest)
+			return
+		}
+
+		if err := jam.ValidScale(found.Key, found.Scale, found.ScaleMode); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := jam.ValidSysEx(found.SysExMaxSize, found.SysExManufacturers); err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		updated, err := s.repo.UpdateJam(r.Context(), found)
+		if err != nil {
+			s.mux.Logf("updateJam: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if live, ok := s.wsb.Load(jamID); ok {
+			live.SetBPM(updated.BPM)
+			live.SetCapacity(updated.Capacity)
+			live.SetQuantize(updated.Quantize, updated.QuantizeStrength)
+			live.SetSysEx(updated.SysExMaxSize, updated.SysExManufacturers)
+			if req.Key != nil || req.Scale != nil || req.ScaleMode != nil {
+				if err := live.SetScale(updated.Key, updated.Scale, updated.ScaleMode); err != nil {
+					s.mux.Logf("setScale: %v\n", err)
+				}
+			}
+		}
+
+		s.mux.Respond(w, r, updated, http.StatusOK)
+	}
+}
+
+func (s *Service) handleCreateInvite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		userID, err := s.identify(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !found.IsHost(userID) {
+			s.mux.Respond(w, r, jam.ErrNotHost, http.StatusForbidden)
+			return
+		}
+
+		var i jam.Invite
+		if err := s.mux.Decode(w, r, &i); err != nil && err != io.EOF {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		i.JamID = jamID
+		i.SetDefaults()
+
+		created, err := s.repo.CreateInvite(r.Context(), i)
+		if err != nil {
+			s.mux.Logf("createInvite: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		created.Token = s.invites.Sign(created)
+		s.mux.Respond(w, r, created, http.StatusCreated)
+	}
+}
+
+func (s *Service) handleListMessages() http.HandlerFunc {
+	const maxLimit = 100
+
+	type response struct {
+		Messages []msg.ChatMsg `json:"messages"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		jamID, err := parseUUID(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		limit, offset, err := parsePage(r, jam.HistorySize, maxLimit)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusNotFound)
+			return
+		}
+
+		if !s.canRead(r, found) {
+			s.mux.RespondText(w, r, http.StatusForbidden)
+			return
+		}
+
+		ms, err := s.repo.ListMessages(r.Context(), jamID, limit, offset)
+		if err != nil {
+			s.mux.Logf("listMessages: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.mux.Respond(w, r, response{Messages: ms}, http.StatusOK)
 	}
 }
 
 func (s *Service) handleListJams() http.HandlerFunc {
 	type room struct {
 		jam.Jam
-		PlayerCount int `json:"playerCount"`
+		PlayerCount  int `json:"playerCount"`
+		WaitingCount int `json:"waitingCount"`
 	}
 
 	type response struct {
@@ -105,8 +515,8 @@ func (s *Service) handleListJams() http.HandlerFunc {
 
 		resp := response{
 			Rooms: fp.FMap(jams, func(j jam.Jam) room {
-				loaded, _ := s.wsb.LoadOrStore(j.ID, &j)
-				return room{*loaded, loaded.Client().Len()}
+				loaded := s.loadJam(j)
+				return room{s.redact(r, j), loaded.Client().Len(), loaded.Client().Waiting()}
 			}),
 		}
 
@@ -123,17 +533,236 @@ func (s *Service) handleP2PConn() http.HandlerFunc {
 			return
 		}
 
-		// userID, err := parseQueryParams(r)
+		userID, err := s.identify(r)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
 
-		jam, err := s.repo.GetJamByID(r.Context(), jamID)
+		found, err := s.repo.GetJamByID(r.Context(), jamID)
 		if err != nil {
 			s.mux.Respond(w, r, err, http.StatusNotFound)
 			return
 		}
 
+		banned, err := s.repo.IsBanned(r.Context(), jamID, userID)
+		if err != nil {
+			s.mux.Logf("isBanned: %v\n", err)
+			s.mux.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if banned {
+			s.mux.RespondText(w, r, http.StatusForbidden)
+			return
+		}
+
+		admit, err := s.authorize(r, found, userID)
+		if err != nil {
+			s.mux.Respond(w, r, err, http.StatusForbidden)
+			return
+		}
+
+		encoding := jam.EncodingJSON
+		if e := r.URL.Query().Get("encoding"); e != "" {
+			encoding = jam.Encoding(e)
+		}
+		if !encoding.Valid() {
+			s.mux.Respond(w, r, jam.ErrInvalidEncoding, http.StatusBadRequest)
+			return
+		}
+
 		// get from websocket client
-		loaded, _ := s.wsb.LoadOrStore(jam.ID, &jam)
-		loaded.Client().ServeHTTP(w, r)
+		loaded := s.loadJam(found)
+
+		// waitlisted clients may ask to listen to the jam while they wait
+		var opts []websocket.ConnOption
+		if listen, _ := strconv.ParseBool(r.URL.Query().Get("listen")); listen {
+			opts = append(opts, websocket.AsListener())
+		}
+		opts = append(opts, websocket.WithEncoder(loaded.Encoder(encoding)))
+
+		user := jam.NewUser(r.URL.Query().Get("username"))
+		user.ID = suid.UUID{UUID: userID}
+
+		// the user is only known to the jam once admitted
+		opts = append(opts, websocket.WithAdmission(func() error {
+			if admit != nil {
+				if err := admit(); err != nil {
+					return err
+				}
+			}
+
+			loaded.AddUser(user)
+			return nil
+		}))
+		loaded.Client().Serve(w, r, userID, opts...)
+	}
+}
+
+// redact returns j without its owner unless r is from the host, who is the
+// only one to be told who owns the jam.
+func (s *Service) redact(r *http.Request, j jam.Jam) jam.Jam {
+	if userID, err := s.identify(r); err != nil || !j.IsHost(userID) {
+		j.Owner = nil
+	}
+	return j
+}
+
+// authorize checks a user may join the jam. Private jams can only be joined
+// by their host, or with either the "passcode" or an "invite" query parameter.
+// Joins with an invite are admitted once the connection is upgraded, by
+// redeeming one of its uses, see websocket.WithAdmission.
+func (s *Service) authorize(r *http.Request, j jam.Jam, userID uuid.UUID) (admit func() error, err error) {
+	if j.Visibility != jam.Private || j.IsHost(userID) {
+		return nil, nil
+	}
+
+	q := r.URL.Query()
+	if p := q.Get("passcode"); p != "" {
+		if !j.CheckPasscode(p) {
+			return nil, errors.New("wrong passcode")
+		}
+		return nil, nil
+	}
+
+	token := q.Get("invite")
+	if token == "" {
+		return nil, errors.New("private jam: passcode or invite required")
+	}
+
+	inviteID, err := s.invites.Verify(j.ID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	admit = func() error {
+		ok, err := s.repo.RedeemInvite(r.Context(), j.ID, inviteID)
+		if err != nil {
+			s.mux.Logf("redeemInvite: %v\n", err)
+			return errors.New("could not redeem invite")
+		}
+
+		if !ok {
+			return errors.New("invite is no longer valid")
+		}
+		return nil
+	}
+	return admit, nil
+}
+
+// canRead checks the participant of a request may read the history of a jam.
+// Invites are not accepted for private jams as reading would use them up.
+func (s *Service) canRead(r *http.Request, j jam.Jam) bool {
+	if j.Visibility != jam.Private {
+		return true
+	}
+
+	if userID, err := s.identify(r); err == nil && j.IsHost(userID) {
+		return true
+	}
+	return j.CheckPasscode(r.URL.Query().Get("passcode"))
+}
+
+// LiveJam returns the jam with the given id, made live if no one is in it,
+// for peers who cannot be authorized such as OSC controllers. Private jams
+// are refused.
+func (s *Service) LiveJam(ctx context.Context, id uuid.UUID) (*jam.Jam, error) {
+	found, err := s.repo.GetJamByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if found.Visibility == jam.Private {
+		return nil, jam.ErrPrivateJam
+	}
+
+	return s.loadJam(found), nil
+}
+
+// loadJam returns the live jam for j, setting it up the first time it is seen.
+// The capacity of an already live jam is kept in sync with j.
+func (s *Service) loadJam(j jam.Jam) *jam.Jam {
+	loaded, ok := s.wsb.LoadOrStore(j.ID, &j)
+	if !ok {
+		loaded.Handle(msg.BAN, s.handleBan(loaded))
+		loaded.Handle(msg.TEXT, s.handleText(loaded))
+		if s.compression != nil {
+			loaded.Client().SetCompression(*s.compression)
+		}
+
+		history, err := s.repo.ListMessages(context.Background(), j.ID, jam.HistorySize, 0)
+		if err != nil {
+			s.mux.Logf("listMessages: %v\n", err)
+		}
+		loaded.SetHistory(history)
+	} else if loaded.Client().Capacity() != j.Capacity {
+		loaded.SetCapacity(j.Capacity)
+	}
+
+	return loaded
+}
+
+func (s *Service) handleBan(j *jam.Jam) jam.HandlerFunc {
+	return func(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+		if !j.IsHost(from) {
+			return nil, jam.ErrNotHost
+		}
+
+		var b msg.BanMsg
+		if err := e.Unwrap(&b); err != nil {
+			return nil, err
+		}
+
+		if err := s.repo.BanUser(context.Background(), j.ID, b.UserID); err != nil {
+			s.mux.Logf("banUser: %v\n", err)
+			return nil, errors.New("could not ban user")
+		}
+
+		j.Client().Kick(b.UserID, "banned by host")
+		return e, nil
+	}
+}
+
+// handleText stores chat messages before relaying them.
+func (s *Service) handleText(j *jam.Jam) jam.HandlerFunc {
+	const maxBodyLen = 2000
+
+	return func(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+		var t msg.TextMsg
+		if err := e.Unwrap(&t); err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(t.Body) == "" {
+			return nil, errors.New("empty message")
+		}
+
+		if len(t.Body) > maxBodyLen {
+			return nil, fmt.Errorf("message is longer than %d bytes", maxBodyLen)
+		}
+
+		// the name is the one the sender joined with, not one they claim
+		t.DisplayName = ""
+		if u, ok := j.User(from); ok {
+			t.DisplayName = u.Username
+		}
+		if err := e.SetPayload(t); err != nil {
+			return nil, err
+		}
+
+		m := msg.ChatMsg{UserID: from, DisplayName: t.DisplayName, Body: t.Body, SentAt: time.Now()}
+
+		// the message is still relayed if it could not be stored
+		stored, err := s.repo.CreateMessage(context.Background(), j.ID, m)
+		if err != nil {
+			s.mux.Logf("createMessage: %v\n", err)
+			stored = m
+		}
+
+		e.ID = stored.ID
+		j.Remember(stored)
+		return e, nil
 	}
 }
 
@@ -142,6 +771,45 @@ func parseUUID(r *http.Request) (uuid.UUID, error) {
 	return uuid.Parse(p)
 }
 
+// parsePage returns the "limit" and "offset" query parameters.
+func parsePage(r *http.Request, defaultLimit, maxLimit int) (limit, offset int, err error) {
+	q := r.URL.Query()
+
+	limit = defaultLimit
+	if p := q.Get("limit"); p != "" {
+		if limit, err = strconv.Atoi(p); err != nil || limit <= 0 || limit > maxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+	}
+
+	if p := q.Get("offset"); p != "" {
+		if offset, err = strconv.Atoi(p); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a positive number")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// identify returns the id of the participant of a request, from the token
+// of its "Authorization: Bearer" header or, for websockets which cannot set
+// headers, its "token" query parameter. Tokens are issued by handleCreateUser.
+func (s *Service) identify(r *http.Request) (uuid.UUID, error) {
+	token := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, t, _ := strings.Cut(h, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return uuid.Nil, errNoIdentity
+		}
+		token = t
+	}
+
+	if token == "" {
+		return uuid.Nil, errNoIdentity
+	}
+	return s.identities.Verify(token)
+}
+
 type Option func(*Service)
 
 func WithBroker(ctx context.Context, cap uint) Option {
@@ -149,3 +817,34 @@ func WithBroker(ctx context.Context, cap uint) Option {
 		s.wsb = jam.NewBroker()
 	}
 }
+
+// WithInviteKey sets the key used to sign invite and identity tokens.
+// Without it a random key is used and tokens are lost on restart.
+func WithInviteKey(key []byte) Option {
+	return func(s *Service) {
+		s.invites = jam.NewInviteSigner(key)
+		s.identities = jam.NewIdentitySigner(key)
+	}
+}
+
+// WithCompression sets the permessage-deflate compression negotiated with
+// participants, in place of jam.DefaultCompression.
+func WithCompression(c websocket.Compression) Option {
+	return func(s *Service) {
+		s.compression = &c
+	}
+}
+
+// WithRecordings enables recording jams into the given repo.
+func WithRecordings(r jamDB.RecordingRepo) Option {
+	return func(s *Service) {
+		s.recordings = r
+	}
+}
+
+// WithRTPMIDI enables RTP-MIDI sessions of jams, listening on the given host.
+func WithRTPMIDI(host string) Option {
+	return func(s *Service) {
+		s.rtpMIDIHost = host
+	}
+}
@@ -1,23 +1,32 @@
 package service_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gobwas/ws"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/rapidmidiex/rmx/internal/jam"
 	service "github.com/rapidmidiex/rmx/internal/jam/http"
+	session "github.com/rapidmidiex/rmx/internal/jam/rtpmidi"
 	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/rtpmidi"
+	"github.com/rapidmidiex/rmx/pkg/smf"
+	pkgws "github.com/rapidmidiex/rmx/pkg/websocket"
 	"github.com/stretchr/testify/require"
 )
 
@@ -82,8 +91,24 @@ func TestService(t *testing.T) {
 		wsBase := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v0"
 		jamWSurl := fmt.Sprintf("%s/jams/%s/ws", wsBase, roomID)
 
+		// **** Each client is identified by a token **** //
+		newToken := func() string {
+			resp, err := srv.Client().Post(srv.URL+"/v0/users", applicationJSON, nil)
+			require.NoError(t, err, "should not error")
+			require.Equal(t, http.StatusCreated, resp.StatusCode, "should return 201")
+
+			defer resp.Body.Close()
+
+			var user struct {
+				Token string `json:"token"`
+			}
+			err = json.NewDecoder(resp.Body).Decode(&user)
+			require.NoError(t, err, "should not error")
+			return user.Token
+		}
+
 		// **** Client A joins Jam **** //
-		wsConnA, _, err := websocket.DefaultDialer.Dial(jamWSurl, nil)
+		wsConnA, _, err := websocket.DefaultDialer.Dial(jamWSurl+"?token="+newToken(), nil)
 		require.NoErrorf(t, err, "client Alpha could not join Jam room")
 		defer func() {
 			err := wsConnA.WriteMessage(int(ws.OpClose), nil)
@@ -92,23 +117,20 @@ func TestService(t *testing.T) {
 			}
 		}()
 
-		/* TODO: this needs to pass before this PR can even be allowed
-		need to resolve this by sending message on connection */
-		{
-			// Get user ID from Connection Message
-			// var envelope msg.Envelope
-			// var aConMsg msg.ConnectMsg
-			// err = wsConnA.ReadJSON(&envelope)
-			// require.NoError(t, err)
+		// Get user ID from Connection Message
+		var aConnEnv msg.Envelope
+		var aConMsg msg.ConnectMsg
+		err = wsConnA.ReadJSON(&aConnEnv)
+		require.NoError(t, err)
+		require.Equal(t, msg.CONNECT, aConnEnv.Typ, "should be a Connect message")
 
-			// err = json.Unmarshal(envelope.Payload, &aConMsg)
-			// require.NoError(t, err)
-			// userIDA := aConMsg.UserID
-		}
+		err = json.Unmarshal(aConnEnv.Payload, &aConMsg)
+		require.NoError(t, err)
+		userIDA := aConMsg.UserID
 
 		// **** Client B joins Jam **** //
 		var envelope msg.Envelope
-		wsConnB, _, err := websocket.DefaultDialer.Dial(jamWSurl, nil)
+		wsConnB, _, err := websocket.DefaultDialer.Dial(jamWSurl+"?token="+newToken(), nil)
 		require.NoErrorf(t, err, "client Bravo could not join Jam room")
 		defer func() {
 			err := wsConnA.WriteMessage(int(ws.OpClose), nil)
@@ -117,19 +139,15 @@ func TestService(t *testing.T) {
 			}
 		}()
 
-		/* TODO: this needs to pass before this PR can even be allowed
-		need to resolve this by sending message on connection */
-		{
-			// Get user ID B from Connection Message
-			// var bConMsg msg.ConnectMsg
-			// err = wsConnB.ReadJSON(&envelope)
-			// require.NoError(t, err)
-			// require.Equal(t, msg.CONNECT, envelope.Typ, "should be a Connect message")
-			// err = json.Unmarshal(envelope.Payload, &bConMsg)
-			// require.NoError(t, err)
-			// userIDB := bConMsg.UserID
-			// require.NotEmpty(t, userIDB, "User B should have received a connect message containing their user ID")
-		}
+		// Get user ID B from Connection Message
+		var bConMsg msg.ConnectMsg
+		err = wsConnB.ReadJSON(&envelope)
+		require.NoError(t, err)
+		require.Equal(t, msg.CONNECT, envelope.Typ, "should be a Connect message")
+		err = json.Unmarshal(envelope.Payload, &bConMsg)
+		require.NoError(t, err)
+		userIDB := bConMsg.UserID
+		require.NotEmpty(t, userIDB, "User B should have received a connect message containing their user ID")
 
 		// Alpha sends a MIDI message
 		// **** Client A broadcasts a MIDI message **** //
@@ -138,8 +156,8 @@ func TestService(t *testing.T) {
 			Number: 60,
 		}
 		yasiinEnv := msg.Envelope{
-			// UserID: userIDA,
-			Typ: msg.MIDI,
+			UserID: userIDA,
+			Typ:    msg.MIDI,
 		}
 		err = yasiinEnv.SetPayload(yasiinSend)
 		require.NoError(t, err)
@@ -160,44 +178,1953 @@ func TestService(t *testing.T) {
 	}
 }
 
-type testStore struct {
-	mu sync.Mutex
-	m  map[uuid.UUID]jam.Jam
+func TestModeration(t *testing.T) {
+	j := newTestJam(t, `{"name": "moderated"}`)
+	trollID := j.srv.newUser()
+
+	host, _ := j.join(j.owner, "")
+
+	t.Run("only the host can moderate", func(t *testing.T) {
+		troll, _ := j.join(trollID, "")
+		defer troll.Close()
+
+		sendMsg(t, troll, msg.KICK, msg.KickMsg{UserID: j.owner})
+
+		var envelope msg.Envelope
+		err := troll.ReadJSON(&envelope)
+		require.NoError(t, err)
+		require.Equal(t, msg.ERROR, envelope.Typ)
+	})
+
+	t.Run("muted participants are not relayed", func(t *testing.T) {
+		troll, _ := j.join(trollID, "")
+		defer troll.Close()
+
+		sendMsg(t, host, msg.MUTE, msg.MuteMsg{UserID: trollID, MIDI: true})
+
+		var envelope msg.Envelope
+		err := host.ReadJSON(&envelope)
+		require.NoError(t, err)
+		require.Equal(t, msg.MUTE, envelope.Typ)
+
+		sendMsg(t, troll, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60})
+		sendMsg(t, troll, msg.TEXT, msg.TextMsg{Body: "sorry"})
+
+		err = host.ReadJSON(&envelope)
+		require.NoError(t, err)
+		require.Equal(t, msg.TEXT, envelope.Typ, "muted MIDI should have been dropped")
+		require.Equal(t, trollID, envelope.UserID)
+
+		sendMsg(t, host, msg.MUTE, msg.MuteMsg{UserID: trollID})
+		err = host.ReadJSON(&envelope)
+		require.NoError(t, err)
+		require.Equal(t, msg.MUTE, envelope.Typ)
+	})
+
+	t.Run("kicked participants are disconnected", func(t *testing.T) {
+		troll, _ := j.join(trollID, "")
+		defer troll.Close()
+
+		sendMsg(t, host, msg.KICK, msg.KickMsg{UserID: trollID})
+
+		var err error
+		for {
+			var envelope msg.Envelope
+			if err = troll.ReadJSON(&envelope); err != nil {
+				break
+			}
+		}
+		require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "got %v", err)
+
+		readMsg(t, host, msg.KICK, &msg.KickMsg{})
+	})
+
+	t.Run("banned participants cannot rejoin", func(t *testing.T) {
+		troll, _ := j.join(trollID, "")
+		defer troll.Close()
+
+		sendMsg(t, host, msg.BAN, msg.BanMsg{UserID: trollID})
+		readMsg(t, host, msg.BAN, &msg.BanMsg{})
+
+		_, resp, err := j.dial(nil, trollID, "")
+		require.Error(t, err)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
 }
 
-func newTestStore() *testStore {
-	s := &testStore{
-		m: make(map[uuid.UUID]jam.Jam),
+func TestIdentity(t *testing.T) {
+	j := newTestJam(t, `{"name": "signed"}`)
+	guestID := j.srv.newUser()
+
+	t.Run("owners are only shown to the host", func(t *testing.T) {
+		resp := j.do(http.MethodGet, "", guestID, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.NotContains(t, body, "owner")
+
+		var found jam.Jam
+		resp = j.do(http.MethodGet, "", j.owner, "")
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&found))
+		require.NotNil(t, found.Owner)
+		require.Equal(t, j.owner, found.Owner.ID.UUID)
+	})
+
+	t.Run("identities are rate limited", func(t *testing.T) {
+		var resp *http.Response
+		for i := 0; i < 20; i++ {
+			if resp = j.srv.do(http.MethodPost, "/v0/users", uuid.Nil, "", nil); resp.StatusCode != http.StatusCreated {
+				break
+			}
+		}
+		require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		require.NotEmpty(t, resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("joins require a token", func(t *testing.T) {
+		_, resp, err := j.dial(nil, uuid.Nil, "")
+		require.Error(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		_, resp, err = j.dial(nil, uuid.Nil, "userId="+j.owner.String())
+		require.Error(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode, "ids are not trusted")
+	})
+
+	t.Run("tokens cannot be forged", func(t *testing.T) {
+		token := j.srv.tokens[guestID]
+		id, sig, _ := strings.Cut(token, ".")
+		forged := base64.RawURLEncoding.EncodeToString(j.owner[:]) + "." + sig
+
+		for _, token := range []string{forged, id, token + "x"} {
+			resp := j.srv.do(http.MethodPost, "/v0/jams?token="+token, uuid.Nil, applicationJSON, strings.NewReader(`{"name": "forged"}`))
+			require.Equal(t, http.StatusUnauthorized, resp.StatusCode, token)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, j.srv.URL+"/v0/jams", strings.NewReader(`{"name": "bearer"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+j.srv.tokens[j.owner])
+		resp, err := j.srv.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode, "tokens may be sent as bearer tokens")
+	})
+}
+
+func TestPrivateJam(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.newJam(`{"name": "lobby"}`)
+	srv.newJam(`{"name": "secret", "visibility": "unlisted"}`)
+	private := srv.newJam(`{"name": "rehearsal", "visibility": "private", "passcode": "hunter2"}`)
+	require.Empty(t, private.Passcode, "passcode should never be returned")
+
+	resp := srv.createJam(srv.newUser(), `{"visibility": "secret"}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode, "should reject unknown visibility")
+
+	t.Run("only public jams are listed", func(t *testing.T) {
+		resp := srv.do(http.MethodGet, "/v0/jams", uuid.Nil, "", nil)
+
+		var body struct {
+			Rooms []jam.Jam `json:"rooms"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&body)
+		require.NoError(t, err)
+		require.Len(t, body.Rooms, 1)
+		require.Equal(t, "lobby", body.Rooms[0].Name)
+	})
+
+	guestID := srv.newUser()
+	join := func(userID uuid.UUID, query string) *http.Response {
+		conn, resp, err := private.dial(nil, userID, query)
+		if err == nil {
+			conn.Close()
+		}
+		return resp
 	}
-	return s
+
+	// invites are redeemed once the connection is upgraded
+	redeem := func(userID uuid.UUID, query string) error {
+		conn, _, err := private.dial(nil, userID, query)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var envelope msg.Envelope
+		return conn.ReadJSON(&envelope)
+	}
+
+	t.Run("private jams are only described to members", func(t *testing.T) {
+		get := func(userID uuid.UUID, query string) (found jam.Jam) {
+			resp := private.do(http.MethodGet, query, userID, "")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&found))
+			return found
+		}
+
+		require.Equal(t, jam.Jam{ID: private.ID, Visibility: jam.Private}, get(guestID, ""))
+		require.Equal(t, "rehearsal", get(guestID, "?passcode=hunter2").Name)
+		require.Equal(t, "rehearsal", get(private.owner, "").Name)
+	})
+
+	t.Run("private jams require a passcode", func(t *testing.T) {
+		require.Equal(t, http.StatusForbidden, join(guestID, "").StatusCode)
+		require.Equal(t, http.StatusForbidden, join(guestID, "passcode=letmein").StatusCode)
+		require.Equal(t, http.StatusSwitchingProtocols, join(guestID, "passcode=hunter2").StatusCode)
+		require.Equal(t, http.StatusSwitchingProtocols, join(private.owner, "").StatusCode, "host can always join")
+	})
+
+	t.Run("private jams can be joined with an invite", func(t *testing.T) {
+		resp := private.do(http.MethodPost, "/invites", guestID, `{}`)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, "only the host can invite")
+
+		resp = private.do(http.MethodPost, "/invites", private.owner, `{"maxUses": 2}`)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var invite jam.Invite
+		err := json.NewDecoder(resp.Body).Decode(&invite)
+		require.NoError(t, err)
+		require.NotEmpty(t, invite.Token)
+
+		require.Equal(t, http.StatusForbidden, join(guestID, "invite="+invite.Token+"x").StatusCode, "tampered token")
+		resp = private.srv.do(http.MethodGet, private.path("/ws?invite="+invite.Token), guestID, "", nil)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, "not a websocket handshake")
+		require.NoError(t, redeem(guestID, "invite="+invite.Token), "failed joins do not use the invite")
+		require.NoError(t, redeem(guestID, "invite="+invite.Token))
+
+		err = redeem(guestID, "invite="+invite.Token)
+		require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "invite has no uses left, got %v", err)
+	})
 }
 
-func (s *testStore) CreateJam(ctx context.Context, j jam.Jam) (jam.Jam, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func TestUpdateCapacity(t *testing.T) {
+	j := newTestJam(t, `{"name": "growing", "capacity": 2}`)
+	guestID := j.srv.newUser()
 
-	created := jam.Jam{
-		ID:       uuid.New(),
-		Name:     j.Name,
-		Capacity: j.Capacity,
-		BPM:      j.BPM,
+	update := func(userID uuid.UUID, body string) *http.Response {
+		return j.do(http.MethodPatch, "", userID, body)
 	}
 
-	s.m[created.ID] = created
-	return created, nil
+	// the host has the oldest seat
+	j.join(j.owner, "")
+	guest, _ := j.join(guestID, "")
+
+	require.Equal(t, http.StatusForbidden, update(guestID, `{"capacity": 10}`).StatusCode, "only the host can update the jam")
+
+	readPosition := func() int {
+		var envelope msg.Envelope
+		err := guest.ReadJSON(&envelope)
+		require.NoError(t, err)
+		require.Equal(t, msg.WAITLIST, envelope.Typ)
+
+		var w msg.WaitlistMsg
+		require.NoError(t, envelope.Unwrap(&w))
+		return w.Position
+	}
+
+	require.Equal(t, http.StatusOK, update(j.owner, `{"capacity": 1}`).StatusCode)
+	require.Equal(t, 1, readPosition(), "newest participant should be moved to the waitlist")
+
+	require.Equal(t, http.StatusOK, update(j.owner, `{"capacity": 3, "bpm": 90}`).StatusCode)
+	require.Equal(t, 0, readPosition(), "waitlisted participant should be given a seat back")
 }
 
-func (s *testStore) GetJams(context.Context) ([]jam.Jam, error) {
-	panic("implement me")
+func TestChatHistory(t *testing.T) {
+	j := newTestJam(t, `{"name": "chatty"}`)
+
+	alice, aliceConn := j.join(j.srv.newUser(), "username=alice")
+	require.Equal(t, "alice", aliceConn.UserName)
+	require.Empty(t, aliceConn.History)
+
+	for _, body := range []string{"let's play in D", "", "120 bpm?"} {
+		sendMsg(t, alice, msg.TEXT, msg.TextMsg{DisplayName: "bob", Body: body})
+
+		var got msg.Envelope
+		require.NoError(t, alice.ReadJSON(&got))
+		if body == "" {
+			require.Equal(t, msg.ERROR, got.Typ, "empty messages should be rejected")
+			continue
+		}
+
+		var text msg.TextMsg
+		require.Equal(t, msg.TEXT, got.Typ)
+		require.NoError(t, got.Unwrap(&text))
+		require.Equal(t, "alice", text.DisplayName, "names cannot be claimed")
+	}
+
+	_, bobConn := j.join(j.srv.newUser(), "username=bob")
+	require.Len(t, bobConn.History, 2, "late joiners should see the chat history")
+	require.Equal(t, "let's play in D", bobConn.History[0].Body)
+	require.Equal(t, "alice", bobConn.History[0].DisplayName)
+	require.Equal(t, aliceConn.UserID, bobConn.History[0].UserID)
+
+	resp := j.do(http.MethodGet, "/messages?limit=1&offset=1", uuid.Nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var page struct {
+		Messages []msg.ChatMsg `json:"messages"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	require.Len(t, page.Messages, 1)
+	require.Equal(t, "let's play in D", page.Messages[0].Body)
 }
 
-func (s *testStore) GetJamByID(ctx context.Context, id uuid.UUID) (jam.Jam, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	j, ok := s.m[id]
-	if !ok {
-		return jam.Jam{}, errors.New("jam not found")
+func TestRecording(t *testing.T) {
+	recordings := newTestRecordings()
+	j := newTestJam(t, `{"name": "take one", "bpm": 90}`, service.WithRecordings(recordings))
+
+	host, _ := j.join(j.owner, "username=bach")
+
+	play := func(m msg.MIDIMsg) msg.Envelope {
+		sendMsg(t, host, msg.MIDI, m)
+
+		var got msg.Envelope
+		require.NoError(t, host.ReadJSON(&got))
+		return got
 	}
 
-	return j, nil
+	// not recorded
+	play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100})
+
+	resp := j.do(http.MethodPost, "/recordings", j.srv.newUser(), "")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode, "only the host can record")
+
+	resp = j.do(http.MethodPost, "/recordings", j.owner, "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var recording jam.Recording
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&recording))
+	require.Equal(t, uint(90), recording.BPM)
+
+	var envelope msg.Envelope
+	require.NoError(t, host.ReadJSON(&envelope))
+	require.Equal(t, msg.RECORD, envelope.Typ)
+
+	var rec msg.RecordMsg
+	require.NoError(t, envelope.Unwrap(&rec))
+	require.True(t, rec.Recording)
+	require.Equal(t, recording.ID, rec.RecordingID)
+
+	resp = j.do(http.MethodPost, "/recordings", j.owner, "")
+	require.Equal(t, http.StatusConflict, resp.StatusCode, "a jam is recorded once at a time")
+
+	got := play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 200, Velocity: 100})
+	require.Equal(t, msg.ERROR, got.Typ, "invalid MIDI should be rejected")
+
+	play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 62, Velocity: 100})
+	play(msg.MIDIMsg{State: msg.NOTE_OFF, Number: 62})
+
+	resp = j.do(http.MethodPatch, "", j.owner, `{"bpm": 120}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 64, Velocity: 100})
+
+	resp = j.do(http.MethodPost, "/recordings/stop", j.owner, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&recording))
+	require.NotNil(t, recording.StoppedAt)
+
+	require.NoError(t, host.ReadJSON(&envelope))
+	require.Equal(t, msg.RECORD, envelope.Typ)
+
+	// stopped
+	play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 65, Velocity: 100})
+
+	ms, err := recordings.GetRecordedMsgs(context.Background(), recording.ID)
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+	require.Equal(t, uint(120), ms[2].BPM, "tempo changes are recorded")
+	require.Equal(t, 62, ms[0].Number)
+	require.Equal(t, j.owner, ms[0].UserID)
+	require.Equal(t, "bach", ms[0].UserName)
+	require.Equal(t, uint(90), ms[0].BPM)
+	require.False(t, ms[1].At.Before(ms[0].At))
+
+	resp = j.do(http.MethodGet, "/recordings", uuid.Nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var list struct {
+		Recordings []jam.Recording `json:"recordings"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Recordings, 1)
+
+	resp = j.do(http.MethodGet, fmt.Sprintf("/recordings/%s.mid", recording.ID), uuid.Nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "audio/midi", resp.Header.Get("Content-Type"))
+
+	smf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "MThd", string(smf[:4]))
+	require.Equal(t, []byte{0, 1, 0, 2}, smf[8:12], "type 1 file with a tempo track and a track for bach")
+	require.True(t, bytes.Contains(smf, []byte("bach")), "tracks are named after their participant")
+	require.True(t, bytes.Contains(smf, []byte{0xFF, 0x51, 0x03, 0x0A, 0x2C, 0x2A}), "starts at 90 bpm")
+	require.True(t, bytes.Contains(smf, []byte{0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20}), "changes to 120 bpm")
+
+	resp = j.do(http.MethodGet, fmt.Sprintf("/recordings/%s.mid", uuid.New()), uuid.Nil, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPlayback(t *testing.T) {
+	ctx := context.Background()
+
+	recordings := newTestRecordings()
+	j := newTestJam(t, `{"name": "play along", "bpm": 240}`, service.WithRecordings(recordings))
+
+	// two beats at 120 bpm, played back at 240 bpm
+	start := time.Now()
+	recording, err := recordings.CreateRecording(ctx, jam.Recording{JamID: j.ID, BPM: 120})
+	require.NoError(t, err)
+	recordings.mu.Lock()
+	stop := start.Add(time.Second)
+	recording.StartedAt, recording.StoppedAt = start, &stop
+	recordings.m[recording.ID] = recording
+	recordings.mu.Unlock()
+
+	for i, m := range []msg.MIDIMsg{
+		{State: msg.NOTE_ON, Number: 60, Velocity: 100},
+		{State: msg.NOTE_OFF, Number: 60},
+	} {
+		rm := jam.RecordedMsg{MIDIMsg: m, UserID: j.owner, BPM: 120, At: start.Add(time.Duration(i) * 500 * time.Millisecond)}
+		require.NoError(t, recordings.AddRecordedMsg(ctx, recording.ID, rm))
+	}
+
+	host, _ := j.join(j.owner, "")
+
+	do := func(method, body string) (*http.Response, msg.PlaybackMsg) {
+		resp := j.do(method, "/playback", j.owner, body)
+
+		var status msg.PlaybackMsg
+		if resp.StatusCode < 300 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		}
+		return resp, status
+	}
+
+	t.Run("plays a recording back at the tempo of the jam", func(t *testing.T) {
+		resp, status := do(http.MethodPost, fmt.Sprintf(`{"recordingId": %q}`, recording.ID))
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		require.True(t, status.Playing)
+		require.Equal(t, 2.0, status.Length)
+
+		var notes []time.Time
+		for {
+			var envelope msg.Envelope
+			require.NoError(t, host.ReadJSON(&envelope))
+
+			if envelope.Typ == msg.MIDI {
+				require.Equal(t, status.UserID, envelope.UserID, "played back as a virtual participant")
+				notes = append(notes, time.Now())
+				continue
+			}
+
+			require.Equal(t, msg.PLAYBACK, envelope.Typ)
+			var got msg.PlaybackMsg
+			require.NoError(t, envelope.Unwrap(&got))
+			if !got.Playing {
+				break
+			}
+		}
+
+		require.Len(t, notes, 2)
+		gap := notes[1].Sub(notes[0])
+		require.True(t, gap > 150*time.Millisecond && gap < 400*time.Millisecond, "one beat at 240 bpm, got %v", gap)
+	})
+
+	t.Run("pause, seek and loop", func(t *testing.T) {
+		resp, _ := do(http.MethodPatch, `{"paused": true}`)
+		require.Equal(t, http.StatusConflict, resp.StatusCode, "nothing is playing")
+
+		resp, _ = do(http.MethodPost, fmt.Sprintf(`{"recordingId": %q, "loop": true}`, recording.ID))
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, _ = do(http.MethodPost, fmt.Sprintf(`{"recordingId": %q}`, recording.ID))
+		require.Equal(t, http.StatusConflict, resp.StatusCode, "one playback at a time")
+
+		resp, status := do(http.MethodPatch, `{"paused": true, "beat": 1.5}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.True(t, status.Paused)
+		require.True(t, status.Loop)
+		require.Equal(t, 1.5, status.Beat)
+
+		time.Sleep(100 * time.Millisecond)
+		_, status = do(http.MethodPatch, `{}`)
+		require.Equal(t, 1.5, status.Beat, "paused playback does not move")
+
+		resp, status = do(http.MethodDelete, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.False(t, status.Playing)
+
+		resp, _ = do(http.MethodDelete, "")
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+}
+
+func TestBackingTrack(t *testing.T) {
+	j := newTestJam(t, `{"name": "backed", "bpm": 480}`)
+
+	file := smf.File{
+		Format:   smf.MultiTrack,
+		Division: 96,
+		Tracks: []smf.Track{
+			{smf.NewTempo(0, 100)},
+			{smf.NewTrackName("drums"), smf.NewNoteOn(0, 9, 36, 110), smf.NewNoteOff(48, 9, 36, 0)},
+			{smf.NewTrackName("bass"), smf.NewNoteOn(0, 0, 40, 90), smf.NewNoteOff(96, 0, 40, 0)},
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := file.WriteTo(&buf)
+	require.NoError(t, err)
+
+	resp := j.srv.do(http.MethodPost, j.path("/tracks?name=groove"), j.owner, "audio/midi", bytes.NewReader(buf.Bytes()))
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var track jam.BackingTrack
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&track))
+	require.Equal(t, "groove", track.Name)
+	require.Equal(t, []string{"drums", "bass"}, track.Tracks, "tracks without notes are left out")
+
+	resp = j.srv.do(http.MethodPost, j.path("/tracks"), j.owner, "audio/midi", strings.NewReader("not a midi file"))
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = j.do(http.MethodGet, "/tracks", uuid.Nil, "")
+	var list struct {
+		Tracks []jam.BackingTrack `json:"tracks"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Tracks, 1)
+
+	host, _ := j.join(j.owner, "")
+
+	resp = j.do(http.MethodPost, "/backing", j.owner, fmt.Sprintf(`{"trackId": %q, "channel": 5, "muted": [0]}`, track.ID))
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var status msg.PlaybackMsg
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	require.True(t, status.Backing)
+	require.Equal(t, []int{0}, status.Muted)
+
+	var notes []msg.MIDIMsg
+	for {
+		var envelope msg.Envelope
+		require.NoError(t, host.ReadJSON(&envelope))
+
+		if envelope.Typ == msg.MIDI {
+			require.Equal(t, status.UserID, envelope.UserID)
+
+			var m msg.MIDIMsg
+			require.NoError(t, envelope.Unwrap(&m))
+			notes = append(notes, m)
+			continue
+		}
+
+		var got msg.PlaybackMsg
+		require.NoError(t, envelope.Unwrap(&got))
+		if !got.Playing {
+			break
+		}
+	}
+
+	require.Len(t, notes, 2, "drums are muted")
+	for _, m := range notes {
+		require.Equal(t, 40, m.Number)
+		require.Equal(t, 5, m.Channel, "notes are mapped to the chosen channel")
+	}
+
+	resp = j.do(http.MethodDelete, "/backing", j.owner, "")
+	require.Equal(t, http.StatusConflict, resp.StatusCode, "the backing track has ended")
+}
+
+func TestLooper(t *testing.T) {
+	j := newTestJam(t, `{"name": "loops", "bpm": 600}`)
+
+	host, _ := j.join(j.owner, "")
+	guest, _ := j.join(j.srv.newUser(), "")
+
+	var armed msg.LooperMsg
+	sendMsg(t, host, msg.LOOP, msg.LoopMsg{Action: msg.LOOP_ARM, Bars: 1})
+	readMsg(t, host, msg.LOOPER, &armed)
+	require.Equal(t, j.owner, armed.Capturing)
+	require.Equal(t, float64(jam.BeatsPerBar), armed.CaptureTo-armed.CaptureFrom)
+	require.Empty(t, armed.Layers)
+
+	var rejected msg.ErrorMsg
+	sendMsg(t, guest, msg.LOOP, msg.LoopMsg{Action: msg.LOOP_ARM, Bars: 1})
+	readMsg(t, guest, msg.ERROR, &rejected)
+	require.Equal(t, jam.ErrLooping.Error(), rejected.Message, "a single loop can be armed")
+
+	// a beat lasts 100ms at 600 bpm
+	beat := 100 * time.Millisecond
+	time.Sleep(time.Duration((armed.CaptureFrom-armed.Beat)*float64(beat)) + beat/2)
+	sendMsg(t, host, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100})
+	time.Sleep(beat)
+	sendMsg(t, host, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_OFF, Number: 60})
+
+	var looping msg.LooperMsg
+	readMsg(t, host, msg.LOOPER, &looping)
+	require.Equal(t, armed.UserID, looping.UserID)
+	require.Equal(t, uuid.Nil, looping.Capturing)
+	require.Len(t, looping.Layers, 1)
+	require.Equal(t, j.owner, looping.Layers[0].UserID)
+
+	t.Run("plays the loop back on every cycle", func(t *testing.T) {
+		var played []msg.MIDIMsg
+		for len(played) < 4 {
+			var m msg.MIDIMsg
+			if e := readMsg(t, host, msg.MIDI, &m); e.UserID == looping.UserID {
+				played = append(played, m)
+			}
+		}
+
+		for i, m := range played {
+			require.Equal(t, 60, m.Number)
+			require.Equal(t, msg.NoteState(1-i%2), m.State)
+		}
+	})
+
+	t.Run("only the host or the player of the last layer can undo it", func(t *testing.T) {
+		sendMsg(t, guest, msg.LOOP, msg.LoopMsg{Action: msg.LOOP_UNDO})
+		readMsg(t, guest, msg.ERROR, &rejected)
+		require.Equal(t, jam.ErrNotLoopOwner.Error(), rejected.Message)
+
+		var cleared msg.LooperMsg
+		sendMsg(t, host, msg.LOOP, msg.LoopMsg{Action: msg.LOOP_UNDO})
+		readMsg(t, host, msg.LOOPER, &cleared)
+		require.Equal(t, msg.LooperMsg{}, cleared, "undoing the only layer clears the loop")
+	})
+}
+
+func TestStepSequencer(t *testing.T) {
+	j := newTestJam(t, `{"name": "steps", "bpm": 600}`)
+	guestID := j.srv.newUser()
+
+	host, _ := j.join(j.owner, "")
+	guest, _ := j.join(guestID, "")
+
+	do := func(method string, userID uuid.UUID, body string) (*http.Response, msg.SequencerMsg) {
+		resp := j.do(method, "/sequencer", userID, body)
+
+		var status msg.SequencerMsg
+		if resp.StatusCode < 300 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		}
+		return resp, status
+	}
+
+	layout := `{"steps": 4, "stepsPerBeat": 1, "tracks": [{"name": "kick", "note": 36, "channel": 9}]}`
+
+	resp, _ := do(http.MethodPut, guestID, layout)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, _ = do(http.MethodPut, j.owner, `{"steps": 0, "stepsPerBeat": 1, "tracks": [{"note": 36}]}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, status := do(http.MethodPut, j.owner, layout)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, status.Tracks, 1)
+	require.Len(t, status.Tracks[0].Steps, 4)
+
+	t.Run("every client gets the merged state of a toggle", func(t *testing.T) {
+		sendMsg(t, guest, msg.STEP, msg.StepMsg{Track: 0, Step: 0, Revision: status.Revision})
+
+		var merged msg.SequencerMsg
+		readMsg(t, host, msg.SEQUENCER, &merged)
+		for merged.Revision == status.Revision {
+			readMsg(t, host, msg.SEQUENCER, &merged)
+		}
+		require.True(t, merged.Tracks[0].Steps[0].On)
+		require.Equal(t, 100, merged.Tracks[0].Steps[0].Velocity)
+
+		// the host toggled the step without seeing the guest turn it on
+		sendMsg(t, host, msg.STEP, msg.StepMsg{Track: 0, Step: 0, Revision: status.Revision})
+
+		var rejected msg.ErrorMsg
+		readMsg(t, host, msg.ERROR, &rejected)
+		require.Equal(t, jam.ErrStaleStep.Error(), rejected.Message)
+	})
+
+	t.Run("plays the pattern on the transport", func(t *testing.T) {
+		resp, status := do(http.MethodPatch, j.owner, `{"playing": true}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.True(t, status.Playing)
+
+		var m msg.MIDIMsg
+		for e := readMsg(t, host, msg.MIDI, &m); e.UserID != status.UserID; {
+			e = readMsg(t, host, msg.MIDI, &m)
+		}
+		require.Equal(t, msg.MIDIMsg{State: msg.NOTE_ON, Number: 36, Velocity: 100, Channel: 9}, m)
+	})
+
+	resp, _ = do(http.MethodDelete, j.owner, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = do(http.MethodGet, j.owner, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAssignments(t *testing.T) {
+	j := newTestJam(t, `{"name": "band"}`)
+	guestID := j.srv.newUser()
+
+	host, _ := j.join(j.owner, "")
+	guest, _ := j.join(guestID, "")
+
+	bass := 33
+	sendMsg(t, guest, msg.ASSIGN, msg.AssignMsg{Channel: 3, Program: &bass})
+
+	var assigned msg.AssignMsg
+	readMsg(t, host, msg.ASSIGN, &assigned)
+	require.Equal(t, guestID, assigned.UserID)
+	require.Equal(t, 3, assigned.Channel)
+	require.Equal(t, "Electric Bass (finger)", assigned.Instrument)
+
+	t.Run("rejects a channel assigned to someone else", func(t *testing.T) {
+		sendMsg(t, host, msg.ASSIGN, msg.AssignMsg{Channel: 3, Instrument: "keys"})
+
+		var rejected msg.ErrorMsg
+		readMsg(t, host, msg.ERROR, &rejected)
+		require.Equal(t, jam.ErrChannelTaken.Error(), rejected.Message)
+	})
+
+	t.Run("only the host assigns other participants", func(t *testing.T) {
+		sendMsg(t, guest, msg.ASSIGN, msg.AssignMsg{UserID: j.owner, Channel: 4})
+
+		var rejected msg.ErrorMsg
+		readMsg(t, guest, msg.ERROR, &rejected)
+		require.Equal(t, jam.ErrNotHost.Error(), rejected.Message)
+	})
+
+	t.Run("stamps the assigned channel on MIDI messages", func(t *testing.T) {
+		sendMsg(t, guest, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_ON, Number: 40, Velocity: 90})
+
+		var m msg.MIDIMsg
+		e := readMsg(t, host, msg.MIDI, &m)
+		require.Equal(t, guestID, e.UserID)
+		require.Equal(t, 3, m.Channel)
+	})
+
+	t.Run("sends the assignments to joining participants", func(t *testing.T) {
+		late, c := j.join(j.srv.newUser(), "")
+		defer late.Close()
+		require.Equal(t, []msg.AssignMsg{assigned}, c.Assignments)
+	})
+
+	t.Run("frees the channel of participants who leave", func(t *testing.T) {
+		guest.Close()
+
+		var freed msg.AssignMsg
+		readMsg(t, host, msg.ASSIGN, &freed)
+		require.Equal(t, msg.AssignMsg{UserID: guestID, Unassign: true}, freed)
+
+		_, c := j.join(j.srv.newUser(), "")
+		require.Empty(t, c.Assignments)
+	})
+}
+
+func TestQuantize(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp := srv.createJam(srv.newUser(), `{"name": "tight", "quantize": "1/32"}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	j := srv.newJam(`{"name": "tight"}`)
+	require.Equal(t, jam.QuantizeOff, j.Quantize)
+	require.Equal(t, uint(100), j.QuantizeStrength)
+
+	patch := func(body string) *http.Response {
+		return j.do(http.MethodPatch, "", j.owner, body)
+	}
+
+	resp = patch(`{"quantizeStrength": 150}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	host, _ := j.join(j.owner, "")
+
+	resp = patch(`{"quantize": "1/8t", "quantizeStrength": 75}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var updated jam.Jam
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&updated))
+	require.Equal(t, jam.Quantize8thTriplet, updated.Quantize)
+	require.Equal(t, uint(75), updated.QuantizeStrength)
+
+	t.Run("notes delayed onto the grid keep their order", func(t *testing.T) {
+		for n := 60; n < 65; n++ {
+			sendMsg(t, host, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_ON, Number: n, Velocity: 100})
+			sendMsg(t, host, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_OFF, Number: n})
+		}
+
+		on := make(map[int]bool)
+		for received := 0; received < 10; received++ {
+			var m msg.MIDIMsg
+			readMsg(t, host, msg.MIDI, &m)
+			if m.State == msg.NOTE_ON {
+				on[m.Number] = true
+			} else {
+				require.True(t, on[m.Number], "note %d turned off before it was turned on", m.Number)
+			}
+		}
+	})
+}
+
+func TestScale(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, payload := range []string{
+		`{"name": "modal", "key": "H", "scale": "dorian"}`,
+		`{"name": "modal", "key": "D", "scale": "bebop"}`,
+		`{"name": "modal", "scaleMode": "reject"}`,
+	} {
+		resp := srv.createJam(srv.newUser(), payload)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, payload)
+	}
+
+	j := srv.newJam(`{"name": "modal", "key": "D", "scale": "dorian", "scaleMode": "snap"}`)
+	require.Equal(t, jam.Dorian, j.Scale)
+
+	host, c := j.join(j.owner, "")
+	require.NotNil(t, c.Scale)
+	require.Equal(t, []int{2, 4, 5, 7, 9, 11, 0}, c.Scale.Notes, "clients are sent the scale to show")
+
+	// play sends a MIDI message and returns what the jam receives,
+	// or the error sent back.
+	play := func(m msg.MIDIMsg) (msg.MIDIMsg, string) {
+		sendMsg(t, host, msg.MIDI, m)
+
+		for {
+			var envelope msg.Envelope
+			require.NoError(t, host.ReadJSON(&envelope))
+			switch envelope.Typ {
+			case msg.MIDI:
+				var got msg.MIDIMsg
+				require.NoError(t, envelope.Unwrap(&got))
+				return got, ""
+			case msg.ERROR:
+				var got msg.ErrorMsg
+				require.NoError(t, envelope.Unwrap(&got))
+				return msg.MIDIMsg{}, got.Message
+			}
+		}
+	}
+
+	t.Run("snaps notes out of the scale to the nearest one", func(t *testing.T) {
+		got, _ := play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100})
+		require.Equal(t, 60, got.Number, "C# is as far from C as from D, the lower note wins")
+
+		got, _ = play(msg.MIDIMsg{State: msg.NOTE_OFF, Number: 61})
+		require.Equal(t, 60, got.Number, "notes are turned off where they were turned on")
+
+		got, _ = play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 62, Velocity: 100})
+		require.Equal(t, 62, got.Number)
+
+		got, _ = play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100, Channel: 9})
+		require.Equal(t, 61, got.Number, "drums are not held to the scale")
+	})
+
+	t.Run("rejects notes out of the scale", func(t *testing.T) {
+		resp := j.do(http.MethodPatch, "", j.owner, `{"scaleMode": "reject"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, rejected := play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100})
+		require.Equal(t, jam.ErrOutOfScale.Error(), rejected)
+
+		got, _ := play(msg.MIDIMsg{State: msg.NOTE_OFF, Number: 61})
+		require.Equal(t, 61, got.Number, "notes can always be turned off")
+	})
+
+	t.Run("clears the scale with an empty key", func(t *testing.T) {
+		resp := j.do(http.MethodPatch, "", j.owner, `{"key": ""}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var updated jam.Jam
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&updated))
+		require.Empty(t, updated.Key)
+		require.Equal(t, jam.ScaleOff, updated.ScaleMode)
+
+		got, _ := play(msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100})
+		require.Equal(t, 61, got.Number)
+	})
+}
+
+func TestChords(t *testing.T) {
+	ctx := context.Background()
+
+	recordings := newTestRecordings()
+	j := newTestJam(t, `{"name": "changes"}`, service.WithRecordings(recordings))
+
+	host, _ := j.join(j.owner, "")
+
+	resp := j.do(http.MethodPost, "/recordings", j.owner, "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var recording jam.Recording
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&recording))
+	readMsg(t, host, msg.RECORD, &msg.RecordMsg{})
+
+	guest, _ := j.join(j.srv.newUser(), "")
+
+	// play sends a MIDI message and returns the chord the jam is told about,
+	// if it changed. A chat message follows the note to tell when the jam
+	// was sent everything the note made it send.
+	play := func(conn *websocket.Conn, m msg.MIDIMsg) (chord msg.ChordMsg, changed bool) {
+		sendMsg(t, conn, msg.MIDI, m)
+		sendMsg(t, conn, msg.TEXT, msg.TextMsg{Body: "next"})
+
+		relayed := false
+		for {
+			var envelope msg.Envelope
+			require.NoError(t, host.ReadJSON(&envelope))
+			switch envelope.Typ {
+			case msg.MIDI:
+				relayed = true
+			case msg.CHORD:
+				require.True(t, relayed, "the chord is told after the note it changed with")
+				require.NoError(t, envelope.Unwrap(&chord))
+				changed = true
+			case msg.TEXT:
+				require.True(t, relayed)
+				return chord, changed
+			}
+		}
+	}
+
+	_, changed := play(host, msg.MIDIMsg{State: msg.NOTE_ON, Number: 64, Velocity: 100})
+	require.False(t, changed, "a single note is not a chord")
+
+	_, changed = play(guest, msg.MIDIMsg{State: msg.NOTE_ON, Number: 36, Velocity: 100, Channel: 9})
+	require.False(t, changed, "drums are left out")
+
+	_, changed = play(guest, msg.MIDIMsg{State: msg.NOTE_ON, Number: 67, Velocity: 100, Channel: 1})
+	require.False(t, changed, "a third is not a chord")
+
+	chord, _ := play(host, msg.MIDIMsg{State: msg.NOTE_ON, Number: 48, Velocity: 100})
+	require.Equal(t, msg.ChordMsg{Name: "C", Root: "C", Bass: "C"}, chord, "notes held across participants make the chord")
+
+	chord, _ = play(guest, msg.MIDIMsg{State: msg.NOTE_ON, Number: 71, Velocity: 100, Channel: 1})
+	require.Equal(t, "Cmaj7", chord.Name)
+
+	chord, _ = play(host, msg.MIDIMsg{State: msg.NOTE_OFF, Number: 48})
+	require.Equal(t, msg.ChordMsg{Name: "Em", Root: "E", Bass: "E"}, chord)
+
+	chord, changed = play(guest, msg.MIDIMsg{State: msg.NOTE_OFF, Number: 71, Channel: 1})
+	require.True(t, changed)
+	require.Empty(t, chord.Name, "the jam is told once the notes stop making a chord")
+
+	chord, _ = play(host, msg.MIDIMsg{State: msg.NOTE_ON, Number: 72, Velocity: 100})
+	require.Equal(t, msg.ChordMsg{Name: "C/E", Root: "C", Bass: "E"}, chord, "inversions are named over their bass")
+
+	_, c := j.join(j.srv.newUser(), "")
+	require.NotNil(t, c.Chord, "participants joining are sent the chord being played")
+	require.Equal(t, "C/E", c.Chord.Name)
+
+	guest.Close()
+	readMsg(t, host, msg.CHORD, &chord)
+	require.Empty(t, chord.Name, "the notes of participants who leave stop sounding")
+
+	resp = j.do(http.MethodPost, "/recordings/stop", j.owner, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	markers, err := recordings.GetMarkers(ctx, recording.ID)
+	require.NoError(t, err)
+
+	var names []string
+	for _, m := range markers {
+		names = append(names, m.Text)
+	}
+	require.Equal(t, []string{"C", "Cmaj7", "Em", "C/E"}, names, "every chord is marked in the recording")
+
+	resp = j.do(http.MethodGet, fmt.Sprintf("/recordings/%s.mid", recording.ID), uuid.Nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	smf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(smf, []byte{0xFF, 0x06, 0x05, 'C', 'm', 'a', 'j', '7'}), "chords are exported as markers")
+}
+
+func TestBinaryFrames(t *testing.T) {
+	j := newTestJam(t, `{"name": "low bandwidth"}`)
+	guestID := j.srv.newUser()
+
+	_, resp, err := j.dial(nil, j.owner, "encoding=morse")
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// every other message stays JSON
+	mobile, c := j.join(j.owner, "encoding=binary")
+	require.NotZero(t, c.ShortID)
+
+	desktop, _ := j.join(guestID, "username=liszt")
+
+	// readFrame returns the next binary frame, skipping the envelopes before it
+	readFrame := func() (f msg.Frame, before []msg.Envelope) {
+		for {
+			typ, p, err := mobile.ReadMessage()
+			require.NoError(t, err)
+			if typ == websocket.BinaryMessage {
+				require.NoError(t, f.UnmarshalBinary(p))
+				return f, before
+			}
+
+			var e msg.Envelope
+			require.NoError(t, json.Unmarshal(p, &e))
+			before = append(before, e)
+		}
+	}
+
+	t.Run("sends MIDI as binary frames to connections that negotiated them", func(t *testing.T) {
+		played := msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 90, Channel: 2}
+		sendMsg(t, desktop, msg.MIDI, played)
+
+		f, before := readFrame()
+		require.Equal(t, played, f.MIDI)
+		require.Equal(t, uint32(1), f.Seq)
+
+		require.Len(t, before, 1, "participants are introduced before their first frame")
+		require.Equal(t, msg.PARTICIPANT, before[0].Typ)
+
+		var p msg.ParticipantMsg
+		require.NoError(t, before[0].Unwrap(&p))
+		require.Equal(t, msg.ParticipantMsg{UserID: guestID, UserName: "liszt", ShortID: f.ShortID}, p)
+
+		sendMsg(t, desktop, msg.MIDI, played)
+		f, before = readFrame()
+		require.Equal(t, uint32(2), f.Seq)
+		require.Empty(t, before, "participants are introduced once")
+	})
+
+	t.Run("relays binary frames to other connections as JSON", func(t *testing.T) {
+		played := msg.MIDIMsg{State: msg.NOTE_OFF, Number: 64, Channel: 1}
+		p, err := msg.Frame{Typ: msg.MIDI, Seq: 1, MIDI: played}.MarshalBinary()
+		require.NoError(t, err)
+		require.NoError(t, mobile.WriteMessage(websocket.BinaryMessage, p))
+
+		var got msg.MIDIMsg
+		for e := readMsg(t, desktop, msg.MIDI, &got); e.UserID != j.owner; {
+			e = readMsg(t, desktop, msg.MIDI, &got)
+		}
+		require.Equal(t, played, got)
+
+		f, _ := readFrame()
+		require.Equal(t, c.ShortID, f.ShortID, "the sender gets its own frame back")
+	})
+
+	t.Run("rejects frames it cannot decode", func(t *testing.T) {
+		require.NoError(t, mobile.WriteMessage(websocket.BinaryMessage, []byte{byte(msg.MIDI)}))
+
+		var envelope msg.Envelope
+		require.NoError(t, mobile.ReadJSON(&envelope))
+		require.Equal(t, msg.ERROR, envelope.Typ)
+	})
+}
+
+func TestProtocols(t *testing.T) {
+	j := newTestJam(t, `{"name": "versions"}`)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"rmx.v3.json"}}
+	_, resp, err := j.dial(&dialer, j.srv.newUser(), "")
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), jam.ProtocolJSON, "clients are told what the server speaks")
+
+	dialer.Subprotocols = []string{"rmx.v3.bin", jam.ProtocolBinary}
+	bin, _, err := j.dial(&dialer, j.srv.newUser(), "encoding=json")
+	require.NoError(t, err)
+	defer bin.Close()
+	require.Equal(t, jam.ProtocolBinary, bin.Subprotocol())
+
+	dialer.Subprotocols = []string{jam.ProtocolJSON}
+	text, _, err := j.dial(&dialer, j.srv.newUser(), "encoding=binary")
+	require.NoError(t, err)
+	defer text.Close()
+	require.Equal(t, jam.ProtocolJSON, text.Subprotocol())
+
+	var envelope msg.Envelope
+	require.NoError(t, bin.ReadJSON(&envelope))
+	require.Equal(t, msg.CONNECT, envelope.Typ)
+	require.NoError(t, text.ReadJSON(&envelope))
+	require.Equal(t, msg.CONNECT, envelope.Typ)
+
+	sendMsg(t, text, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100})
+
+	require.NoError(t, text.ReadJSON(&envelope))
+	require.Equal(t, msg.MIDI, envelope.Typ, "the subprotocol wins over the encoding parameter")
+
+	for {
+		typ, _, err := bin.ReadMessage()
+		require.NoError(t, err)
+		if typ == websocket.BinaryMessage {
+			break
+		}
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	j := newTestJam(t, `{"name": "polyglot"}`)
+
+	type client struct {
+		conn  *websocket.Conn
+		codec msg.Codec
+		id    uuid.UUID
+	}
+
+	var clients []client
+	for protocol, c := range map[string]msg.Codec{
+		jam.ProtocolJSON:        msg.JSON,
+		jam.ProtocolMessagePack: msg.MessagePack,
+		jam.ProtocolCBOR:        msg.CBOR,
+	} {
+		dialer := websocket.Dialer{Subprotocols: []string{protocol}}
+		id := j.srv.newUser()
+		conn, _, err := j.dial(&dialer, id, "")
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Equal(t, protocol, conn.Subprotocol())
+
+		clients = append(clients, client{conn, c, id})
+	}
+
+	read := func(c client) msg.Envelope {
+		_, p, err := c.conn.ReadMessage()
+		require.NoError(t, err)
+		e, err := msg.Decode(c.codec, p)
+		require.NoError(t, err)
+		return e
+	}
+
+	for _, c := range clients {
+		e := read(c)
+		require.Equal(t, msg.CONNECT, e.Typ)
+
+		var connect msg.ConnectMsg
+		require.NoError(t, e.Unwrap(&connect))
+		require.Equal(t, c.id, connect.UserID)
+	}
+
+	for _, sender := range clients {
+		played := msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100, Channel: 4}
+		e := msg.Envelope{ID: uuid.New(), Typ: msg.MIDI}
+		require.NoError(t, e.SetPayload(played))
+		p, err := msg.Encode(sender.codec, e)
+		require.NoError(t, err)
+
+		typ := websocket.BinaryMessage
+		if sender.codec == msg.JSON {
+			typ = websocket.TextMessage
+		}
+		require.NoError(t, sender.conn.WriteMessage(typ, p))
+
+		// every client reads the note in its own codec
+		for _, c := range clients {
+			got := read(c)
+			require.Equal(t, msg.MIDI, got.Typ)
+			require.Equal(t, sender.id, got.UserID)
+
+			var m msg.MIDIMsg
+			require.NoError(t, got.Unwrap(&m))
+			require.Equal(t, played, m)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	j := newTestJam(t, `{"name": "squeezed"}`, service.WithCompression(pkgws.Compression{Threshold: 1}))
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	mobile, resp, err := j.dial(&dialer, j.srv.newUser(), "")
+	require.NoError(t, err)
+	defer mobile.Close()
+	require.Contains(t, resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+
+	desktop, resp, err := j.dial(nil, j.srv.newUser(), "")
+	require.NoError(t, err)
+	defer desktop.Close()
+	require.Empty(t, resp.Header.Get("Sec-WebSocket-Extensions"), "compression is only used when offered")
+
+	var envelope msg.Envelope
+	require.NoError(t, mobile.ReadJSON(&envelope))
+	require.Equal(t, msg.CONNECT, envelope.Typ)
+	require.NoError(t, desktop.ReadJSON(&envelope))
+	require.Equal(t, msg.CONNECT, envelope.Typ)
+
+	body := strings.Repeat("la ", 100)
+	sendMsg(t, mobile, msg.TEXT, msg.TextMsg{Body: body})
+
+	for _, conn := range []*websocket.Conn{mobile, desktop} {
+		var text msg.TextMsg
+		readMsg(t, conn, msg.TEXT, &text)
+		require.Equal(t, body, text.Body)
+	}
+}
+
+func TestUMP(t *testing.T) {
+	j := newTestJam(t, `{"name": "expressive"}`)
+
+	join := func(protocols ...string) *websocket.Conn {
+		dialer := websocket.Dialer{Subprotocols: protocols}
+		conn, _, err := j.dial(&dialer, j.srv.newUser(), "")
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		var envelope msg.Envelope
+		require.NoError(t, conn.ReadJSON(&envelope))
+		require.Equal(t, msg.CONNECT, envelope.Typ)
+		return conn
+	}
+
+	seaboard := join(jam.ProtocolJSON2)
+	legacy := join()
+
+	packets := []msg.UMPPacket{
+		msg.NoteOn2(0, 1, 60, 0xFFFF),
+		msg.PerNotePitchBend2(0, 1, 60, msg.UMPPitchBendCenter+0x1000),
+		msg.NoteOff2(0, 1, 60, 0),
+	}
+	sendMsg(t, seaboard, msg.UMP, msg.UMPMsg{Packets: packets})
+
+	var got msg.Envelope
+	require.NoError(t, seaboard.ReadJSON(&got))
+	require.Equal(t, msg.UMP, got.Typ)
+	var u msg.UMPMsg
+	require.NoError(t, got.Unwrap(&u))
+	require.Equal(t, packets, u.Packets, "clients speaking UMP get every packet")
+
+	for _, want := range []msg.MIDIMsg{
+		{State: msg.NOTE_ON, Number: 60, Velocity: 127, Channel: 1},
+		{State: msg.NOTE_OFF, Number: 60, Channel: 1},
+	} {
+		require.NoError(t, legacy.ReadJSON(&got))
+		require.Equal(t, msg.MIDI, got.Typ, "older clients get the notes")
+		var m msg.MIDIMsg
+		require.NoError(t, got.Unwrap(&m))
+		require.Equal(t, want, m)
+	}
+
+	sendMsg(t, seaboard, msg.UMP, msg.UMPMsg{Packets: []msg.UMPPacket{{0x10F80000}}})
+	require.NoError(t, seaboard.ReadJSON(&got))
+	require.Equal(t, msg.ERROR, got.Typ, "only channel voice messages are relayed")
+}
+
+func TestMPE(t *testing.T) {
+	recordings := newTestRecordings()
+	j := newTestJam(t, `{"name": "expression"}`, service.WithRecordings(recordings))
+	seaboardID := j.srv.newUser()
+
+	// send sends a message and returns the next envelope the sender gets back
+	send := func(conn *websocket.Conn, typ msg.MsgType, payload any) msg.Envelope {
+		sendMsg(t, conn, typ, payload)
+
+		var got msg.Envelope
+		require.NoError(t, conn.ReadJSON(&got))
+		return got
+	}
+
+	host, _ := j.join(j.owner, "")
+
+	resp := j.do(http.MethodPost, "/recordings", j.owner, "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var recording jam.Recording
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&recording))
+	readMsg(t, host, msg.RECORD, &msg.RecordMsg{})
+
+	envelope := send(host, msg.ASSIGN, msg.AssignMsg{Channel: 0})
+	require.Equal(t, msg.ASSIGN, envelope.Typ)
+
+	seaboard, _ := j.join(seaboardID, "")
+
+	envelope = send(seaboard, msg.MPE, msg.MPEMsg{Zone: jam.ZoneUpper, Members: 16})
+	require.Equal(t, msg.ERROR, envelope.Typ, "a zone cannot take every channel")
+
+	envelope = send(seaboard, msg.MPE, msg.MPEMsg{Zone: jam.ZoneUpper, Members: 3})
+	require.Equal(t, msg.MPE, envelope.Typ)
+	var zone msg.MPEMsg
+	require.NoError(t, envelope.Unwrap(&zone))
+	require.Equal(t, seaboardID, zone.UserID)
+	require.Equal(t, 1, zone.Master, "channel 0 is assigned to the host")
+	require.Equal(t, []int{2, 3, 4}, zone.Channels)
+	require.Equal(t, 48, zone.BendRange)
+
+	require.NoError(t, host.ReadJSON(&envelope))
+	require.Equal(t, msg.MPE, envelope.Typ, "everyone is told about the zone")
+
+	envelope = send(host, msg.ASSIGN, msg.AssignMsg{Channel: 3})
+	require.Equal(t, msg.ERROR, envelope.Typ, "channels of a zone cannot be assigned")
+
+	// the upper zone of the instrument has its members from 14 down
+	played := []msg.MIDIMsg{
+		{State: msg.PITCH_BEND, Value: msg.PitchBendCenter, Channel: 13},
+		{State: msg.NOTE_ON, Number: 60, Velocity: 100, Channel: 13},
+		{State: msg.PITCH_BEND, Value: 12000, Channel: 13},
+		{State: msg.CONTROL_CHANGE, Number: msg.TimbreController, Value: 90, Channel: 13},
+		{State: msg.CHANNEL_PRESSURE, Value: 70, Channel: 13},
+		{State: msg.NOTE_OFF, Number: 60, Channel: 13},
+	}
+	for _, m := range played {
+		envelope = send(seaboard, msg.MIDI, m)
+		require.Equal(t, msg.MIDI, envelope.Typ)
+
+		var got msg.MIDIMsg
+		require.NoError(t, envelope.Unwrap(&got))
+		m.Channel = 3
+		require.Equal(t, m, got, "member channels are played on the channels of the zone")
+
+		require.NoError(t, host.ReadJSON(&envelope))
+		require.Equal(t, msg.MIDI, envelope.Typ)
+	}
+
+	envelope = send(seaboard, msg.MIDI, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100, Channel: 5})
+	require.Equal(t, msg.ERROR, envelope.Typ, "channel 5 is outside a zone of 3 members")
+
+	_, c := j.join(j.srv.newUser(), "")
+	require.Equal(t, []msg.MPEMsg{zone}, c.Zones, "participants joining are sent the zones")
+
+	seaboard.Close()
+	var removed msg.MPEMsg
+	readMsg(t, host, msg.MPE, &removed)
+	require.Equal(t, msg.MPEMsg{UserID: seaboardID, Zone: jam.ZoneUpper}, removed, "the zones of participants who leave are removed")
+
+	envelope = send(host, msg.ASSIGN, msg.AssignMsg{Channel: 3})
+	require.Equal(t, msg.ASSIGN, envelope.Typ, "the channels of the zone are free again")
+
+	resp = j.do(http.MethodPost, "/recordings/stop", j.owner, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = j.do(http.MethodGet, fmt.Sprintf("/recordings/%s.mid", recording.ID), uuid.Nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	f, err := smf.ReadFile(resp.Body)
+	require.NoError(t, err)
+
+	var statuses []byte
+	for _, e := range f.Tracks[len(f.Tracks)-1] {
+		if e.Status != smf.MetaEvent {
+			statuses = append(statuses, e.Status)
+		}
+	}
+	require.Equal(t, []byte{0xE3, 0x93, 0xE3, 0xB3, 0xD3, 0x83}, statuses, "expression is exported")
+}
+
+func TestSysEx(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp := srv.createJam(srv.newUser(), `{"sysExManufacturers": ["yamaha"]}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode, "manufacturers are hex IDs")
+
+	j := srv.newJam(`{"name": "patches", "sysExMaxSize": 16, "sysExManufacturers": ["43", "00 20 33", "43"]}`)
+	require.Equal(t, []msg.Manufacturer{"43", "002033"}, j.SysExManufacturers)
+	playerID := srv.newUser()
+
+	// send sends SysEx and returns the next envelope the sender gets back
+	send := func(conn *websocket.Conn, data ...byte) msg.Envelope {
+		sendMsg(t, conn, msg.SYSEX, msg.SysExMsg{Data: data})
+
+		var got msg.Envelope
+		require.NoError(t, conn.ReadJSON(&got))
+		return got
+	}
+
+	update := func(body string) {
+		resp := j.do(http.MethodPatch, "", j.owner, body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	host, _ := j.join(j.owner, "")
+	player, _ := j.join(playerID, "")
+
+	// DX7 voice parameter change
+	envelope := send(player, 0x43, 0x10, 0x01, 0x06, 0x3F)
+	require.Equal(t, msg.SYSEX, envelope.Typ)
+
+	require.NoError(t, host.ReadJSON(&envelope))
+	require.Equal(t, msg.SYSEX, envelope.Typ)
+	require.Equal(t, playerID, envelope.UserID)
+
+	var sysEx msg.SysExMsg
+	require.NoError(t, envelope.Unwrap(&sysEx))
+	require.Equal(t, []byte{0x43, 0x10, 0x01, 0x06, 0x3F}, sysEx.Data)
+
+	envelope = send(player, 0x41, 0x10, 0x42, 0x12)
+	require.Equal(t, msg.ERROR, envelope.Typ, "Roland is not allowed in the jam")
+
+	envelope = send(player, 0x43, 0xF7)
+	require.Equal(t, msg.ERROR, envelope.Typ, "status bytes are not data")
+
+	envelope = send(player, make([]byte, 17)...)
+	require.Equal(t, msg.ERROR, envelope.Typ)
+
+	envelope = send(player, append([]byte{0x43}, make([]byte, 16)...)...)
+	require.Equal(t, msg.ERROR, envelope.Typ, "the message is larger than the jam allows")
+
+	update(`{"sysExMaxSize": 4096}`)
+
+	dump := append([]byte{0x00, 0x20, 0x33}, make([]byte, 4093)...)
+	envelope = send(player, dump...)
+	require.Equal(t, msg.SYSEX, envelope.Typ)
+	require.NoError(t, host.ReadJSON(&envelope))
+
+	envelope = send(player, dump...)
+	require.Equal(t, msg.ERROR, envelope.Typ, "SysEx is sent no faster than a MIDI cable")
+
+	var rejected msg.ErrorMsg
+	require.NoError(t, envelope.Unwrap(&rejected))
+	require.Equal(t, jam.ErrSysExRate.Error(), rejected.Message)
+
+	envelope = send(host, 0x43, 0x10, 0x01, 0x06, 0x3F)
+	require.Equal(t, msg.SYSEX, envelope.Typ, "participants are limited on their own")
+	require.NoError(t, player.ReadJSON(&envelope))
+
+	update(`{"sysExManufacturers": []}`)
+
+	envelope = send(host, 0x43, 0x10, 0x01, 0x06, 0x3F)
+	require.Equal(t, msg.ERROR, envelope.Typ, "SysEx is dropped once no manufacturer is allowed")
+}
+
+func TestLiveJam(t *testing.T) {
+	ctx := context.Background()
+
+	store := newTestStore()
+	s := service.New(ctx, store)
+
+	public, err := store.CreateJam(ctx, jam.Jam{Name: "open", Visibility: jam.Public})
+	require.NoError(t, err)
+	private, err := store.CreateJam(ctx, jam.Jam{Name: "closed", Visibility: jam.Private})
+	require.NoError(t, err)
+
+	live, err := s.LiveJam(ctx, public.ID)
+	require.NoError(t, err)
+	require.Equal(t, public.ID, live.ID)
+
+	again, err := s.LiveJam(ctx, public.ID)
+	require.NoError(t, err)
+	require.Same(t, live, again, "a jam is made live once")
+
+	_, err = s.LiveJam(ctx, private.ID)
+	require.ErrorIs(t, err, jam.ErrPrivateJam)
+
+	_, err = s.LiveJam(ctx, uuid.New())
+	require.Error(t, err)
+}
+
+func TestRTPMIDI(t *testing.T) {
+	j := newTestJam(t, `{"name": "studio"}`, service.WithRTPMIDI("127.0.0.1"))
+	guestID := j.srv.newUser()
+
+	host, _ := j.join(j.owner, "")
+
+	do := func(method string, userID uuid.UUID) (*http.Response, session.Status) {
+		resp := j.do(method, "/rtpmidi", userID, "")
+
+		var status session.Status
+		if resp.StatusCode < 300 && resp.StatusCode != http.StatusNoContent {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		}
+		return resp, status
+	}
+
+	resp, _ := do(http.MethodPost, guestID)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, _ = do(http.MethodGet, j.owner)
+	require.Equal(t, http.StatusConflict, resp.StatusCode, "no session yet")
+
+	resp, status := do(http.MethodPost, j.owner)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "studio", status.Name)
+	require.NotZero(t, status.Port)
+
+	resp, _ = do(http.MethodPost, j.owner)
+	require.Equal(t, http.StatusConflict, resp.StatusCode, "one session per jam")
+
+	// a DAW joins the session and plays a note
+	var conns [2]*net.UDPConn
+	for i := range conns {
+		var err error
+		conns[i], err = net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: status.Port + i})
+		require.NoError(t, err)
+		defer conns[i].Close()
+	}
+
+	send := func(conn *net.UDPConn, p interface{ MarshalBinary() ([]byte, error) }) {
+		b, err := p.MarshalBinary()
+		require.NoError(t, err)
+		_, err = conn.Write(b)
+		require.NoError(t, err)
+	}
+
+	receive := func(conn *net.UDPConn) []byte {
+		buf := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		return buf[:n]
+	}
+
+	for _, conn := range conns {
+		send(conn, rtpmidi.Session{Command: rtpmidi.Invitation, Token: 1, SSRC: 9, Name: "Live"})
+		var reply rtpmidi.Session
+		require.NoError(t, reply.UnmarshalBinary(receive(conn)))
+		require.Equal(t, rtpmidi.Accept, reply.Command)
+	}
+
+	resp, status = do(http.MethodGet, j.owner)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, status.Peers, 1)
+
+	send(conns[1], rtpmidi.Packet{SSRC: 9, Commands: []rtpmidi.MIDICommand{{Data: []byte{0x90, 64, 80}}}})
+	var envelope msg.Envelope
+	require.NoError(t, host.ReadJSON(&envelope))
+	require.Equal(t, msg.MIDI, envelope.Typ)
+	require.Equal(t, status.Peers[0].UserID, envelope.UserID)
+
+	resp, _ = do(http.MethodDelete, j.owner)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	var by rtpmidi.Session
+	require.NoError(t, by.UnmarshalBinary(receive(conns[0])))
+	require.Equal(t, rtpmidi.End, by.Command, "peers are told the session ended")
+
+	resp, _ = do(http.MethodDelete, j.owner)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	disabled := newTestServer(t)
+	resp = disabled.do(http.MethodPost, j.path("/rtpmidi"), j.owner, "", nil)
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+}
+
+// testServer serves the jams of a test, see newTestJam.
+type testServer struct {
+	*httptest.Server
+	t *testing.T
+
+	// identity tokens of the participants, see newUser
+	tokens map[uuid.UUID]string
+}
+
+func newTestServer(t *testing.T, opts ...service.Option) *testServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := httptest.NewServer(service.New(ctx, newTestStore(), opts...))
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+	})
+	return &testServer{srv, t, make(map[uuid.UUID]string)}
+}
+
+// newUser returns the ID of a new participant, whose token is used for the
+// requests they send.
+func (s *testServer) newUser() uuid.UUID {
+	s.t.Helper()
+
+	resp := s.do(http.MethodPost, "/v0/users", uuid.Nil, "", nil)
+	require.Equal(s.t, http.StatusCreated, resp.StatusCode)
+
+	var u struct {
+		ID    uuid.UUID `json:"id"`
+		Token string    `json:"token"`
+	}
+	require.NoError(s.t, json.NewDecoder(resp.Body).Decode(&u))
+	s.tokens[u.ID] = u.Token
+	return u.ID
+}
+
+// url returns the URL of a path as requested by the participant, or
+// anonymously if userID is uuid.Nil.
+func (s *testServer) url(path string, userID uuid.UUID) string {
+	if userID == uuid.Nil {
+		return s.URL + path
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return s.URL + path + sep + "token=" + s.tokens[userID]
+}
+
+// do sends a request as the participant. The body of the response is closed
+// with the test.
+func (s *testServer) do(method, path string, userID uuid.UUID, contentType string, body io.Reader) *http.Response {
+	s.t.Helper()
+
+	req, err := http.NewRequest(method, s.url(path, userID), body)
+	require.NoError(s.t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.Client().Do(req)
+	require.NoError(s.t, err)
+	s.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// createJam posts the payload of a jam owned by host.
+func (s *testServer) createJam(host uuid.UUID, payload string) *http.Response {
+	s.t.Helper()
+
+	return s.do(http.MethodPost, "/v0/jams", host, applicationJSON, strings.NewReader(payload))
+}
+
+// newJam creates a jam owned by a new participant.
+func (s *testServer) newJam(payload string) *testJam {
+	s.t.Helper()
+
+	j := &testJam{srv: s, owner: s.newUser()}
+	resp := s.createJam(j.owner, payload)
+	require.Equal(s.t, http.StatusCreated, resp.StatusCode)
+	require.NoError(s.t, json.NewDecoder(resp.Body).Decode(&j.Jam))
+	return j
+}
+
+// testJam is a jam created for a test.
+type testJam struct {
+	jam.Jam
+
+	srv   *testServer
+	owner uuid.UUID
+}
+
+// newTestJam creates a jam from its JSON payload, on a new server.
+func newTestJam(t *testing.T, payload string, opts ...service.Option) *testJam {
+	return newTestServer(t, opts...).newJam(payload)
+}
+
+// path returns the path of a resource of the jam, such as "/recordings".
+func (j *testJam) path(p string) string {
+	return "/v0/jams/" + j.ID.String() + p
+}
+
+// do sends a JSON request for a resource of the jam as the participant.
+func (j *testJam) do(method, path string, userID uuid.UUID, body string) *http.Response {
+	return j.srv.do(method, j.path(path), userID, applicationJSON, strings.NewReader(body))
+}
+
+// dial connects the participant to the jam with the dialer, or the default
+// one if nil. The query holds the other parameters of the connection.
+func (j *testJam) dial(d *websocket.Dialer, userID uuid.UUID, query string) (*websocket.Conn, *http.Response, error) {
+	if d == nil {
+		d = websocket.DefaultDialer
+	}
+
+	path := j.path("/ws")
+	if query != "" {
+		path += "?" + query
+	}
+	return d.Dial("ws"+strings.TrimPrefix(j.srv.url(path, userID), "http"), nil)
+}
+
+// join connects the participant to the jam and returns the connection with
+// the message it was welcomed with. The connection is closed with the test.
+func (j *testJam) join(userID uuid.UUID, query string) (*websocket.Conn, msg.ConnectMsg) {
+	t := j.srv.t
+	t.Helper()
+
+	conn, _, err := j.dial(nil, userID, query)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	var envelope msg.Envelope
+	require.NoError(t, conn.ReadJSON(&envelope))
+	require.Equal(t, msg.CONNECT, envelope.Typ)
+
+	var c msg.ConnectMsg
+	require.NoError(t, envelope.Unwrap(&c))
+	return conn, c
+}
+
+// sendMsg writes a message of the given type to a connection.
+func sendMsg(t *testing.T, conn *websocket.Conn, typ msg.MsgType, payload any) {
+	t.Helper()
+
+	e := msg.Envelope{ID: uuid.New(), Typ: typ}
+	require.NoError(t, e.SetPayload(payload))
+	require.NoError(t, conn.WriteJSON(e))
+}
+
+// readMsg reads a connection up to the next envelope of the given type and
+// unwraps its payload into v.
+func readMsg(t *testing.T, conn *websocket.Conn, typ msg.MsgType, v any) msg.Envelope {
+	t.Helper()
+
+	for {
+		var e msg.Envelope
+		require.NoError(t, conn.ReadJSON(&e))
+		if e.Typ == typ {
+			require.NoError(t, e.Unwrap(v))
+			return e
+		}
+	}
+}
+
+type testStore struct {
+	mu       sync.Mutex
+	m        map[uuid.UUID]jam.Jam
+	bans     map[uuid.UUID][]uuid.UUID
+	invites  map[uuid.UUID]jam.Invite
+	messages map[uuid.UUID][]msg.ChatMsg
+	tracks   map[uuid.UUID]jam.BackingTrack
+}
+
+func newTestStore() *testStore {
+	s := &testStore{
+		m:        make(map[uuid.UUID]jam.Jam),
+		bans:     make(map[uuid.UUID][]uuid.UUID),
+		invites:  make(map[uuid.UUID]jam.Invite),
+		messages: make(map[uuid.UUID][]msg.ChatMsg),
+		tracks:   make(map[uuid.UUID]jam.BackingTrack),
+	}
+	return s
+}
+
+func (s *testStore) CreateJam(ctx context.Context, j jam.Jam) (jam.Jam, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := jam.Jam{
+		ID:                 uuid.New(),
+		Owner:              j.Owner,
+		Name:               j.Name,
+		Capacity:           j.Capacity,
+		BPM:                j.BPM,
+		Visibility:         j.Visibility,
+		PasscodeHash:       j.PasscodeHash,
+		Quantize:           j.Quantize,
+		QuantizeStrength:   j.QuantizeStrength,
+		Key:                j.Key,
+		Scale:              j.Scale,
+		ScaleMode:          j.ScaleMode,
+		SysExMaxSize:       j.SysExMaxSize,
+		SysExManufacturers: j.SysExManufacturers,
+	}
+
+	s.m[created.ID] = created
+	return created, nil
+}
+
+func (s *testStore) GetJams(context.Context) ([]jam.Jam, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []jam.Jam
+	for _, j := range s.m {
+		if j.Visibility == jam.Public {
+			res = append(res, j)
+		}
+	}
+	return res, nil
+}
+
+func (s *testStore) GetJamByID(ctx context.Context, id uuid.UUID) (jam.Jam, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.m[id]
+	if !ok {
+		return jam.Jam{}, errors.New("jam not found")
+	}
+
+	return j, nil
+}
+
+func (s *testStore) UpdateJam(ctx context.Context, j jam.Jam) (jam.Jam, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found, ok := s.m[j.ID]
+	if !ok {
+		return jam.Jam{}, errors.New("jam not found")
+	}
+	found.BPM, found.Capacity = j.BPM, j.Capacity
+	found.Quantize, found.QuantizeStrength = j.Quantize, j.QuantizeStrength
+	found.Key, found.Scale, found.ScaleMode = j.Key, j.Scale, j.ScaleMode
+	found.SysExMaxSize, found.SysExManufacturers = j.SysExMaxSize, j.SysExManufacturers
+	s.m[j.ID] = found
+	return found, nil
+}
+
+func (s *testStore) BanUser(ctx context.Context, jamID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bans[jamID] = append(s.bans[jamID], userID)
+	return nil
+}
+
+func (s *testStore) IsBanned(ctx context.Context, jamID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.bans[jamID] {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *testStore) CreateInvite(ctx context.Context, i jam.Invite) (jam.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i.ID = uuid.New()
+	s.invites[i.ID] = i
+	return i, nil
+}
+
+func (s *testStore) RedeemInvite(ctx context.Context, jamID, inviteID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.invites[inviteID]
+	if !ok || i.JamID != jamID || i.Uses >= i.MaxUses || time.Now().After(i.ExpiresAt) {
+		return false, nil
+	}
+	i.Uses++
+	s.invites[inviteID] = i
+	return true, nil
+}
+
+func (s *testStore) CreateMessage(ctx context.Context, jamID uuid.UUID, m msg.ChatMsg) (msg.ChatMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.ID = uuid.New()
+	s.messages[jamID] = append(s.messages[jamID], m)
+	return m, nil
+}
+
+func (s *testStore) ListMessages(ctx context.Context, jamID uuid.UUID, limit, offset int) ([]msg.ChatMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms := s.messages[jamID]
+	end := len(ms) - offset
+	if end < 0 {
+		end = 0
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return append([]msg.ChatMsg(nil), ms[start:end]...), nil
+}
+
+func (s *testStore) CreateBackingTrack(ctx context.Context, b jam.BackingTrack) (jam.BackingTrack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.ID = uuid.New()
+	b.CreatedAt = time.Now()
+	s.tracks[b.ID] = b
+	return b, nil
+}
+
+func (s *testStore) GetBackingTrackByID(ctx context.Context, id uuid.UUID) (jam.BackingTrack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.tracks[id]
+	if !ok {
+		return jam.BackingTrack{}, errors.New("backing track not found")
+	}
+	return b, nil
+}
+
+func (s *testStore) GetBackingTracks(ctx context.Context, jamID uuid.UUID) ([]jam.BackingTrack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bs := make([]jam.BackingTrack, 0)
+	for _, b := range s.tracks {
+		if b.JamID == jamID {
+			b.Data = nil
+			bs = append(bs, b)
+		}
+	}
+	return bs, nil
+}
+
+type testRecordings struct {
+	mu      sync.Mutex
+	m       map[uuid.UUID]jam.Recording
+	msgs    map[uuid.UUID][]jam.RecordedMsg
+	markers map[uuid.UUID][]jam.Marker
+}
+
+func newTestRecordings() *testRecordings {
+	r := &testRecordings{
+		m:       make(map[uuid.UUID]jam.Recording),
+		msgs:    make(map[uuid.UUID][]jam.RecordedMsg),
+		markers: make(map[uuid.UUID][]jam.Marker),
+	}
+	return r
+}
+
+func (r *testRecordings) CreateRecording(ctx context.Context, rec jam.Recording) (jam.Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec.ID = uuid.New()
+	r.m[rec.ID] = rec
+	return rec, nil
+}
+
+func (r *testRecordings) StopRecording(ctx context.Context, id uuid.UUID, at time.Time) (jam.Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.m[id]
+	if !ok || rec.StoppedAt != nil {
+		return jam.Recording{}, errors.New("recording not found")
+	}
+	rec.StoppedAt = &at
+	r.m[id] = rec
+	return rec, nil
+}
+
+func (r *testRecordings) DeleteRecording(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.m, id)
+	delete(r.msgs, id)
+	delete(r.markers, id)
+	return nil
+}
+
+func (r *testRecordings) GetRecordingByID(ctx context.Context, id uuid.UUID) (jam.Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.m[id]
+	if !ok {
+		return jam.Recording{}, errors.New("recording not found")
+	}
+	return rec, nil
+}
+
+func (r *testRecordings) GetRecordings(ctx context.Context, jamID uuid.UUID) ([]jam.Recording, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rs := make([]jam.Recording, 0)
+	for _, rec := range r.m {
+		if rec.JamID == jamID {
+			rs = append(rs, rec)
+		}
+	}
+	return rs, nil
+}
+
+func (r *testRecordings) AddRecordedMsg(ctx context.Context, recordingID uuid.UUID, m jam.RecordedMsg) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs[recordingID] = append(r.msgs[recordingID], m)
+	return nil
+}
+
+func (r *testRecordings) GetRecordedMsgs(ctx context.Context, recordingID uuid.UUID) ([]jam.RecordedMsg, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]jam.RecordedMsg(nil), r.msgs[recordingID]...), nil
+}
+
+func (r *testRecordings) AddMarker(ctx context.Context, recordingID uuid.UUID, m jam.Marker) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.markers[recordingID] = append(r.markers[recordingID], m)
+	return nil
+}
+
+func (r *testRecordings) GetMarkers(ctx context.Context, recordingID uuid.UUID) ([]jam.Marker, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]jam.Marker(nil), r.markers[recordingID]...), nil
 }
@@ -1,13 +1,16 @@
 package jam
 
 import (
+	"compress/flate"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	fake "github.com/brianvoe/gofakeit/v6"
 	"github.com/google/uuid"
 	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rapidmidiex/rmx/internal/msg"
 	"github.com/rapidmidiex/rmx/pkg/websocket"
 )
 
@@ -16,6 +19,10 @@ const (
 	defaultCapacity = 10
 )
 
+// DefaultCompression is negotiated with participants offering permessage-deflate.
+// Snapshots and chat are compressed, single notes are not.
+var DefaultCompression = websocket.Compression{Level: flate.BestSpeed}
+
 type User struct {
 	ID       suid.UUID
 	Username string `json:"username"`
@@ -41,18 +48,85 @@ type Jam struct {
 	Capacity uint      `json:"capacity,omitempty"`
 	BPM      uint      `json:"bpm,omitempty"`
 
-	cli *websocket.Client
+	Visibility Visibility `json:"visibility,omitempty"`
+	// Notes played in the jam are snapped to the Quantize grid of the
+	// transport, by QuantizeStrength percent of the way.
+	Quantize         Quantize `json:"quantize,omitempty"`
+	QuantizeStrength uint     `json:"quantizeStrength,omitempty"`
+	// Key and Scale of the jam, such as D dorian. ScaleMode tells what
+	// happens to notes played out of the scale.
+	Key       string    `json:"key,omitempty"`
+	Scale     Scale     `json:"scale,omitempty"`
+	ScaleMode ScaleMode `json:"scaleMode,omitempty"`
+	// SysEx messages are relayed up to SysExMaxSize bytes, if their
+	// manufacturer is one of SysExManufacturers.
+	SysExMaxSize       uint               `json:"sysExMaxSize,omitempty"`
+	SysExManufacturers []msg.Manufacturer `json:"sysExManufacturers,omitempty"`
+	// Passcode is only read when creating a jam, see SetPasscode.
+	Passcode     string `json:"passcode,omitempty"`
+	PasscodeHash []byte `json:"-"`
+
+	cli  *websocket.Client
+	room *room
 }
 
 // NOTE this should not be empty but panic if it is
 func (j *Jam) Client() *websocket.Client {
-	if j.cli == nil {
-		j.cli = websocket.NewClient(j.Capacity)
+	if j.room == nil {
+		j.room = newRoom()
 	}
 
+	j.room.once.Do(func() {
+		j.room.transport = newTransport(j.BPM)
+		j.room.live = j.room.transport.at
+		j.cli = websocket.NewClient(
+			j.Capacity,
+			websocket.WithMessageHandler(j.handleMessage),
+			websocket.WithWaitlist(j.handleQueue),
+			websocket.WithJoinHandler(j.handleJoin),
+			websocket.WithLeaveHandler(j.handleLeave),
+			websocket.WithProtocols(j.handleProtocol, Protocols...),
+			websocket.WithCompression(DefaultCompression),
+		)
+	})
+
 	return j.cli
 }
 
+// SetCapacity changes the capacity of a live jam, see websocket.Client.SetCapacity
+// for what happens to the participants over capacity.
+func (j *Jam) SetCapacity(n uint) {
+	cli := j.Client()
+
+	j.room.mu.Lock()
+	j.Capacity = n
+	j.room.mu.Unlock()
+
+	cli.SetCapacity(n)
+}
+
+// SetBPM changes the tempo of a live jam.
+func (j *Jam) SetBPM(bpm uint) {
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+	j.BPM = bpm
+	j.room.transport.setBPM(time.Now(), bpm)
+
+	// playbacks follow the new tempo from now on
+	for _, p := range []*Player{j.room.player, j.room.backing} {
+		if p != nil {
+			p.wakeUp()
+		}
+	}
+}
+
+// IsHost reports whether the user with the given id owns the jam.
+func (j *Jam) IsHost(userID uuid.UUID) bool {
+	return j.Owner != nil && j.Owner.ID.UUID == userID
+}
+
 func (j *Jam) Close() error {
 	return j.cli.Close()
 }
@@ -61,7 +135,7 @@ func (j *Jam) String() string {
 	return "jam no: " + j.ID.String()
 }
 
-// SetDefaults set default values for BPM, Name, and Capacity.
+// SetDefaults set default values for BPM, Name, Capacity, Visibility, quantization, scale and SysEx size.
 func (j *Jam) SetDefaults() {
 	if j.BPM == 0 {
 		j.BPM = defaultBPM
@@ -72,6 +146,24 @@ func (j *Jam) SetDefaults() {
 	if j.Capacity == 0 {
 		j.Capacity = defaultCapacity
 	}
+	if j.Visibility == "" {
+		j.Visibility = Public
+	}
+	if j.Quantize == "" {
+		j.Quantize = QuantizeOff
+	}
+	if j.QuantizeStrength == 0 {
+		j.QuantizeStrength = defaultQuantizeStrength
+	}
+	if j.Key != "" && j.Scale == "" {
+		j.Scale = Major
+	}
+	if j.ScaleMode == "" {
+		j.ScaleMode = ScaleOff
+	}
+	if j.SysExMaxSize == 0 {
+		j.SysExMaxSize = defaultSysExMaxSize
+	}
 }
 
 // Broker is responsible of delegating the creation of a new Jam and the
@@ -94,17 +186,27 @@ func (b *jamBroker) Delete(id uuid.UUID) {
 
 func (b *jamBroker) LoadAndDelete(id uuid.UUID) (value *Jam, loaded bool) {
 	actual, loaded := b.m.LoadAndDelete(id)
+	if !loaded {
+		return nil, false
+	}
 	return actual.(*Jam), loaded
 }
 
 // Load loads an existing jam from the broker.
 func (b *jamBroker) Load(id uuid.UUID) (value *Jam, ok bool) {
 	v, ok := b.m.Load(id)
+	if !ok {
+		return nil, false
+	}
 	return v.(*Jam), ok
 }
 
 // Store stores the jam in the broker.
 func (b *jamBroker) Store(id uuid.UUID, jam *Jam) {
+	if jam.room == nil {
+		jam.room = newRoom()
+	}
+
 	b.m.Store(id, jam)
 }
 
@@ -112,6 +214,11 @@ func (b *jamBroker) Store(id uuid.UUID, jam *Jam) {
 // Otherwise, it stores and returns the given jam.
 // The loaded result is true if the value was loaded, false if stored.
 func (b *jamBroker) LoadOrStore(id uuid.UUID, j *Jam) (*Jam, bool) {
+	// the jam is not shared yet so its room can be set up safely
+	if j.room == nil {
+		j.room = newRoom()
+	}
+
 	actual, loaded := b.m.LoadOrStore(id, j)
 	if !loaded {
 		actual = j
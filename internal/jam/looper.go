@@ -0,0 +1,382 @@
+package jam
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+const (
+	// LooperName is the username of the virtual participant playing the loop.
+	LooperName = "Looper"
+	// MaxLoopBars is the length of the longest loop.
+	MaxLoopBars = 16
+)
+
+var (
+	ErrLooping      = errors.New("a loop is already armed, overdub or clear it")
+	ErrNoLoop       = errors.New("no loop is armed")
+	ErrCapturing    = errors.New("the looper is already capturing")
+	ErrInvalidBars  = errors.New("loops must be 1 to 16 bars long")
+	ErrNotLoopOwner = errors.New("only the host or the player of that layer can do this")
+)
+
+// Looper captures the MIDI of players against the transport of the jam, one
+// layer at a time, and plays every layer back on each cycle of the loop.
+type Looper struct {
+	// Virtual participant the loop is played back as.
+	ID uuid.UUID
+
+	j *Jam
+
+	mu     sync.Mutex
+	bars   int
+	start  float64 // beat of the transport the first cycle started on
+	layers []loopLayer
+	// pass being captured, if any
+	capture *loopCapture
+	// plays the layers once the first one is captured
+	player  *Player
+	cleared bool
+}
+
+type loopLayer struct {
+	msg.LoopLayer
+	cues []Cue
+}
+
+type loopCapture struct {
+	layer    loopLayer
+	from, to float64
+	timer    *time.Timer
+}
+
+// ArmLoop starts a loop of the given number of bars. The MIDI of userID is
+// captured from the next bar of the transport, for one cycle of the loop.
+func (j *Jam) ArmLoop(userID uuid.UUID, bars int) (*Looper, error) {
+	if bars < 1 || bars > MaxLoopBars {
+		return nil, ErrInvalidBars
+	}
+
+	j.Client()
+	start := j.nextBeat(BeatsPerBar)
+
+	l := &Looper{ID: uuid.New(), j: j, bars: bars, start: start}
+
+	j.room.mu.Lock()
+	if j.room.looper != nil {
+		j.room.mu.Unlock()
+		return nil, ErrLooping
+	}
+	j.room.looper = l
+	j.room.users[l.ID] = &User{ID: suid.UUID{UUID: l.ID}, Username: LooperName}
+	j.room.mu.Unlock()
+
+	l.mu.Lock()
+	l.arm(userID, start)
+	l.mu.Unlock()
+
+	return l, l.broadcast()
+}
+
+// Looper returns the looper of the jam, if a loop is armed.
+func (j *Jam) Looper() (*Looper, bool) {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.looper, j.room.looper != nil
+}
+
+// Overdub captures a new layer of userID over the loop, from the next bar
+// of the transport and for one cycle of the loop.
+func (l *Looper) Overdub(userID uuid.UUID) error {
+	from := l.j.nextBeat(BeatsPerBar)
+
+	l.mu.Lock()
+	switch {
+	case l.cleared:
+		l.mu.Unlock()
+		return ErrNoLoop
+	case l.capture != nil:
+		l.mu.Unlock()
+		return ErrCapturing
+	}
+	l.arm(userID, from)
+	l.mu.Unlock()
+
+	return l.broadcast()
+}
+
+// Undo cancels the capture in progress, or removes the last layer of the loop.
+// The loop is cleared once it has no layer left.
+func (l *Looper) Undo() error {
+	l.mu.Lock()
+	switch {
+	case l.cleared:
+		l.mu.Unlock()
+		return ErrNoLoop
+	case l.capture != nil:
+		l.capture.timer.Stop()
+		l.capture = nil
+	case len(l.layers) > 0:
+		l.layers = l.layers[:len(l.layers)-1]
+		if l.player != nil {
+			l.player.setSequence(l.sequence())
+		}
+	}
+
+	if l.capture == nil && len(l.layers) == 0 {
+		l.mu.Unlock()
+		return l.Clear()
+	}
+	l.mu.Unlock()
+
+	return l.broadcast()
+}
+
+// Clear stops the loop and removes every layer.
+func (l *Looper) Clear() error {
+	l.mu.Lock()
+	if l.cleared {
+		l.mu.Unlock()
+		return ErrNoLoop
+	}
+	l.cleared = true
+	if l.capture != nil {
+		l.capture.timer.Stop()
+		l.capture = nil
+	}
+	l.layers = nil
+	if l.player != nil {
+		l.player.Stop()
+	}
+	l.mu.Unlock()
+
+	l.j.room.mu.Lock()
+	if l.j.room.looper == l {
+		l.j.room.looper = nil
+	}
+	l.j.room.mu.Unlock()
+
+	return l.j.Broadcast(msg.LOOPER, msg.LooperMsg{})
+}
+
+// Status returns the state of the looper.
+func (l *Looper) Status() msg.LooperMsg {
+	beat := l.j.Beat()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cleared {
+		return msg.LooperMsg{}
+	}
+
+	s := msg.LooperMsg{
+		UserID: l.ID,
+		Bars:   l.bars,
+		Start:  l.start,
+		Beat:   beat,
+		Layers: make([]msg.LoopLayer, 0, len(l.layers)),
+	}
+	for _, layer := range l.layers {
+		s.Layers = append(s.Layers, layer.LoopLayer)
+	}
+	if c := l.capture; c != nil {
+		s.Capturing, s.CaptureFrom, s.CaptureTo = c.layer.UserID, c.from, c.to
+	}
+	return s
+}
+
+// length returns the length of the loop in beats.
+func (l *Looper) length() float64 {
+	return float64(l.bars * BeatsPerBar)
+}
+
+// arm starts capturing userID from the given beat of the transport.
+// It must be called with the lock held.
+func (l *Looper) arm(userID uuid.UUID, from float64) {
+	c := &loopCapture{layer: loopLayer{LoopLayer: msg.LoopLayer{UserID: userID}}, from: from, to: from + l.length()}
+	if u, ok := l.j.User(userID); ok {
+		c.layer.UserName = u.Username
+	}
+	c.timer = time.AfterFunc(time.Until(l.j.timeAt(c.to)), func() { l.finish(c) })
+	l.capture = c
+}
+
+// captureMIDI adds a message played at the given beat of the transport to
+// the layer being captured, if it was sent by the captured player during the pass.
+func (l *Looper) captureMIDI(from uuid.UUID, m msg.MIDIMsg, beat float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.capture
+	if c == nil || c.layer.UserID != from || beat < c.from || beat >= c.to {
+		return
+	}
+
+	cue := Cue{RecordedMsg: RecordedMsg{MIDIMsg: m, UserID: from, UserName: c.layer.UserName}, Beat: math.Mod(beat-l.start, l.length())}
+	c.layer.cues = append(c.layer.cues, cue)
+}
+
+// finish ends the pass once the transport reaches its end, adding the
+// captured layer to the loop.
+func (l *Looper) finish(c *loopCapture) {
+	beat := l.j.Beat()
+
+	l.mu.Lock()
+	if l.capture != c {
+		l.mu.Unlock()
+		return
+	}
+
+	// the tempo went down since the pass was armed
+	if beat < c.to {
+		c.timer = time.AfterFunc(time.Until(l.j.timeAt(c.to)), func() { l.finish(c) })
+		l.mu.Unlock()
+		return
+	}
+
+	l.capture = nil
+	if layer, ok := l.close(c); ok {
+		l.layers = append(l.layers, layer)
+		l.play(beat)
+	}
+
+	if len(l.layers) == 0 {
+		l.mu.Unlock()
+		l.Clear()
+		return
+	}
+	l.mu.Unlock()
+
+	l.broadcast()
+}
+
+// close returns the layer of a finished pass, turning off the notes still
+// held at its end. ok is false if nothing was played during the pass.
+// It must be called with the lock held.
+func (l *Looper) close(c *loopCapture) (layer loopLayer, ok bool) {
+	layer = loopLayer{LoopLayer: c.layer.LoopLayer}
+
+	type note struct{ channel, number int }
+	held := make(map[note]bool)
+	for _, cue := range c.layer.cues {
+		n := note{cue.Channel, cue.Number}
+		switch {
+		case !cue.IsNote():
+			// expression is replayed as played
+		case cue.State == msg.NOTE_ON && cue.Velocity > 0:
+			held[n] = true
+		case !held[n]:
+			// pressed before the pass started
+			continue
+		default:
+			delete(held, n)
+		}
+		layer.cues = append(layer.cues, cue)
+	}
+
+	end := math.Mod(c.to-l.start, l.length())
+	if end == 0 {
+		end = l.length()
+	}
+	// released before notes played again at the same position
+	var offs []Cue
+	for n := range held {
+		off := RecordedMsg{MIDIMsg: msg.MIDIMsg{State: msg.NOTE_OFF, Number: n.number, Channel: n.channel}, UserID: layer.UserID, UserName: layer.UserName}
+		offs = append(offs, Cue{RecordedMsg: off, Beat: end})
+	}
+	layer.cues = append(offs, layer.cues...)
+
+	sort.SliceStable(layer.cues, func(i, j int) bool { return layer.cues[i].Beat < layer.cues[j].Beat })
+	return layer, len(layer.cues) > 0
+}
+
+// sequence lays out every layer of the loop, one track per layer.
+// It must be called with the lock held.
+func (l *Looper) sequence() Sequence {
+	s := Sequence{Length: l.length()}
+	for i, layer := range l.layers {
+		s.Tracks = append(s.Tracks, layer.UserName)
+		for _, c := range layer.cues {
+			c.Track = i
+			s.Cues = append(s.Cues, c)
+		}
+	}
+
+	sort.SliceStable(s.Cues, func(i, j int) bool { return s.Cues[i].Beat < s.Cues[j].Beat })
+	return s
+}
+
+// play plays the layers of the loop, starting the player on the cycle of the
+// given beat of the transport if needed.
+// It must be called with the lock held.
+func (l *Looper) play(beat float64) {
+	if l.player != nil {
+		l.player.setSequence(l.sequence())
+		return
+	}
+
+	p := newPlayer(l.j, l.ID, l.sequence(), true)
+	p.ID, p.quiet = l.ID, true
+	p.offset = l.start + math.Floor((beat-l.start)/l.length())*l.length()
+	l.player = p
+
+	go p.run()
+}
+
+func (l *Looper) broadcast() error {
+	return l.j.Broadcast(msg.LOOPER, l.Status())
+}
+
+func (j *Jam) handleLoop(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	var m msg.LoopMsg
+	if err := e.Unwrap(&m); err != nil {
+		return nil, err
+	}
+
+	if m.Action == msg.LOOP_ARM {
+		_, err := j.ArmLoop(from, m.Bars)
+		return nil, err
+	}
+
+	l, ok := j.Looper()
+	if !ok {
+		return nil, ErrNoLoop
+	}
+
+	switch m.Action {
+	case msg.LOOP_OVERDUB:
+		return nil, l.Overdub(from)
+	case msg.LOOP_UNDO:
+		s := l.Status()
+		last := s.Capturing
+		if last == uuid.Nil && len(s.Layers) > 0 {
+			last = s.Layers[len(s.Layers)-1].UserID
+		}
+		if !j.IsHost(from) && from != last {
+			return nil, ErrNotLoopOwner
+		}
+		return nil, l.Undo()
+	case msg.LOOP_CLEAR:
+		s := l.Status()
+		first := s.Capturing
+		if len(s.Layers) > 0 {
+			first = s.Layers[0].UserID
+		}
+		if !j.IsHost(from) && from != first {
+			return nil, ErrNotLoopOwner
+		}
+		return nil, l.Clear()
+	}
+
+	return nil, errors.New("unknown loop action")
+}
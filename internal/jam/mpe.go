@@ -0,0 +1,197 @@
+package jam
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+// Zones of an MPE instrument.
+const (
+	ZoneLower = "lower"
+	ZoneUpper = "upper"
+)
+
+const (
+	// defaultBendRange is the pitch bend range of MPE member channels, in semitones.
+	defaultBendRange = 48
+	maxBendRange     = 96
+	// maxMembers is the number of channels left for members once the master
+	// and percussion channels are taken.
+	maxMembers = 14
+)
+
+var (
+	ErrInvalidZone = errors.New("invalid MPE zone, members or bend range")
+	ErrNoChannels  = errors.New("not enough free channels in the jam for the MPE zone")
+	ErrOutOfZone   = errors.New("channel is outside the MPE zone of the participant")
+)
+
+// SetZone declares the MPE zone of a participant, or removes it if it has no
+// members. The master channel of the zone is played on the channel assigned
+// to the participant, if any, and the member channels on the lowest channels
+// of the jam no one else plays on. The percussion channel is never used.
+func (j *Jam) SetZone(z msg.MPEMsg) (msg.MPEMsg, error) {
+	if (z.Zone != ZoneLower && z.Zone != ZoneUpper) ||
+		z.Members < 0 || z.Members > maxMembers ||
+		z.BendRange < 0 || z.BendRange > maxBendRange {
+		return z, ErrInvalidZone
+	}
+
+	z.Master, z.Channels = 0, nil
+	if z.BendRange == 0 {
+		z.BendRange = defaultBendRange
+	}
+
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+
+	if z.Members == 0 {
+		delete(j.room.zones, z.UserID)
+		return z, nil
+	}
+
+	taken := map[int]bool{percussionChannel: true}
+	for id, a := range j.room.assignments {
+		if id != z.UserID {
+			taken[a.Channel] = true
+		}
+	}
+	for id, other := range j.room.zones {
+		if id != z.UserID {
+			taken[other.Master] = true
+			for _, ch := range other.Channels {
+				taken[ch] = true
+			}
+		}
+	}
+
+	var free []int
+	if a, ok := j.room.assignments[z.UserID]; ok {
+		free = append(free, a.Channel)
+		taken[a.Channel] = true
+	}
+	for ch := 0; ch < 16; ch++ {
+		if !taken[ch] {
+			free = append(free, ch)
+		}
+	}
+	if len(free) < z.Members+1 {
+		return z, ErrNoChannels
+	}
+
+	z.Master, z.Channels = free[0], free[1:z.Members+1]
+	j.room.zones[z.UserID] = z
+	return z, nil
+}
+
+// unzone frees the channels of the MPE zone of a participant who left the jam.
+func (j *Jam) unzone(id uuid.UUID) {
+	j.Client()
+
+	j.room.mu.Lock()
+	z, ok := j.room.zones[id]
+	delete(j.room.zones, id)
+	j.room.mu.Unlock()
+
+	if ok {
+		j.Broadcast(msg.MPE, msg.MPEMsg{UserID: id, Zone: z.Zone})
+	}
+}
+
+// Zones returns the MPE zones of the participants who declared one, by master channel.
+func (j *Jam) Zones() []msg.MPEMsg {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.zoned()
+}
+
+// zoned must be called with the lock held.
+func (r *room) zoned() []msg.MPEMsg {
+	zs := make([]msg.MPEMsg, 0, len(r.zones))
+	for _, z := range r.zones {
+		zs = append(zs, z)
+	}
+	sort.Slice(zs, func(i, j int) bool { return zs[i].Master < zs[j].Master })
+	return zs
+}
+
+// channel returns the channel of the jam a participant playing on ch is
+// heard on: ch through their MPE zone, or the channel assigned to them.
+// It must be called with the lock held.
+func (r *room) channel(from uuid.UUID, ch int) (int, error) {
+	if z, ok := r.zones[from]; ok {
+		return zoneChannel(z, ch)
+	}
+	if a, ok := r.assignments[from]; ok {
+		return a.Channel, nil
+	}
+	return ch, nil
+}
+
+// zoneChannel returns the channel of the jam the master or member channel ch of a zone is played on.
+func zoneChannel(z msg.MPEMsg, ch int) (int, error) {
+	master, step := 0, 1
+	if z.Zone == ZoneUpper {
+		master, step = 15, -1
+	}
+	if ch == master {
+		return z.Master, nil
+	}
+
+	i := (ch-master)*step - 1
+	if i < 0 || i >= len(z.Channels) {
+		return 0, ErrOutOfZone
+	}
+	return z.Channels[i], nil
+}
+
+// takenByZone reports whether ch is a channel of the MPE zone of someone other than id.
+// It must be called with the lock held.
+func (r *room) takenByZone(id uuid.UUID, ch int) bool {
+	for other, z := range r.zones {
+		if other == id {
+			continue
+		}
+		if z.Master == ch {
+			return true
+		}
+		for _, c := range z.Channels {
+			if c == ch {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (j *Jam) handleMPE(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	var z msg.MPEMsg
+	if err := e.Unwrap(&z); err != nil {
+		return nil, err
+	}
+
+	if z.UserID == uuid.Nil {
+		z.UserID = from
+	}
+	if z.UserID != from && !j.IsHost(from) {
+		return nil, ErrNotHost
+	}
+
+	z, err := j.SetZone(z)
+	if err != nil {
+		return nil, err
+	}
+
+	// relayed so that everyone knows which channels to play the zone on
+	if err := e.SetPayload(z); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
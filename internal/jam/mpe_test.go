@@ -0,0 +1,35 @@
+package jam
+
+import (
+	"testing"
+
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneChannel(t *testing.T) {
+	lower := msg.MPEMsg{Zone: ZoneLower, Members: 3, Master: 4, Channels: []int{5, 6, 7}}
+	upper := msg.MPEMsg{Zone: ZoneUpper, Members: 2, Master: 1, Channels: []int{2, 3}}
+
+	for _, tc := range []struct {
+		zone    msg.MPEMsg
+		ch      int
+		want    int
+		wantErr error
+	}{
+		{lower, 0, 4, nil},
+		{lower, 1, 5, nil},
+		{lower, 3, 7, nil},
+		{lower, 4, 0, ErrOutOfZone},
+		{lower, 15, 0, ErrOutOfZone},
+		{upper, 15, 1, nil},
+		{upper, 14, 2, nil},
+		{upper, 13, 3, nil},
+		{upper, 12, 0, ErrOutOfZone},
+		{upper, 0, 0, ErrOutOfZone},
+	} {
+		got, err := zoneChannel(tc.zone, tc.ch)
+		require.Equal(t, tc.wantErr, err, "%s zone, channel %d", tc.zone.Zone, tc.ch)
+		require.Equal(t, tc.want, got, "%s zone, channel %d", tc.zone.Zone, tc.ch)
+	}
+}
@@ -0,0 +1,602 @@
+// Package bridge lets OSC controllers and patches, such as TouchOSC, Max/MSP
+// or SuperCollider, play in jams over UDP.
+//
+// Messages are addressed to /rmx/{jam id}/ followed by one of
+//
+//	note      note velocity [channel]     velocity 0 turns the note off
+//	cc        controller value [channel]
+//	bend      value [channel]             0-16383, 8192 does not bend
+//	pressure  value [channel]
+//	subscribe [port]                      mirrors the jam to the sender, or to port on its host
+//	unsubscribe [port]                    stops mirroring and leaves the jam
+//
+// Numbers may be sent as ints or floats. Every peer plays as its own
+// participant of the jam, taking a seat of it, and leaves it after sending
+// nothing for the peer timeout: subscribers that only listen subscribe again
+// to stay. The MIDI and chat of the jam are mirrored to
+// subscribers as the same note, cc, bend and pressure messages followed by
+// the id of the participant who played them, and as text messages holding
+// the display name and body of chat messages. Peers are sent
+//
+//	subscribed               once their subscription is registered
+//	error     message        when a message of theirs is rejected
+//
+// Only peers on the loopback or a private network are bridged, nothing is
+// ever read from or sent to other addresses.
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rapidmidiex/rmx/internal/jam"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/osc"
+)
+
+// Prefix of the addresses of the bridge.
+const Prefix = "/rmx/"
+
+// maxPacketSize is the largest UDP payload.
+const maxPacketSize = 65507
+
+// mirrorBuffer is how many envelopes are held for subscribers before the
+// bridge drops them, UDP being lossy anyway.
+const mirrorBuffer = 256
+
+// DefaultPeerTimeout is how long a peer may send nothing before it leaves
+// the jam it played in.
+const DefaultPeerTimeout = 5 * time.Minute
+
+var (
+	ErrAddress  = errors.New("address must be " + Prefix + "{jam id}/{note|cc|bend|pressure|subscribe|unsubscribe}")
+	ErrArgs     = errors.New("invalid arguments")
+	ErrNotLocal = errors.New("only hosts on the loopback or a private network may play or subscribe")
+	ErrFull     = errors.New("jam is full")
+)
+
+// Loader returns the live jam with the given id.
+type Loader func(ctx context.Context, id uuid.UUID) (*jam.Jam, error)
+
+// Server bridges OSC peers into jams.
+type Server struct {
+	conn    net.PacketConn
+	load    Loader
+	logf    func(format string, v ...any)
+	timeout time.Duration
+
+	mu sync.Mutex
+	// jams the peers played in, loaded once
+	jams map[uuid.UUID]*jam.Jam
+	// peers seated in a jam, by id
+	peers map[uuid.UUID]*peer
+	// jams mirrored to subscribers, by jam
+	mirrors map[uuid.UUID]*mirror
+}
+
+// peer is a participant of a jam playing over OSC.
+type peer struct {
+	jam *jam.Jam
+	// when the peer last sent a message
+	seen time.Time
+}
+
+// mirror sends the envelopes relayed to a jam to its subscribers.
+type mirror struct {
+	untap func()
+	out   chan *msg.Envelope
+	// subscribers by address
+	targets map[string]target
+}
+
+type target struct {
+	addr net.Addr
+	// participant of the peer who subscribed, not sent what they played
+	peer uuid.UUID
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithLogger sets the logger of the errors of the peers, log.Printf by default.
+func WithLogger(logf func(format string, v ...any)) Option {
+	return func(s *Server) {
+		s.logf = logf
+	}
+}
+
+// WithPeerTimeout sets how long a peer may send nothing before it leaves
+// the jam, DefaultPeerTimeout by default. Peers never time out if d is 0.
+func WithPeerTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = d
+	}
+}
+
+// New returns a server bridging the OSC packets read from conn into the
+// jams returned by load.
+func New(conn net.PacketConn, load Loader, opts ...Option) *Server {
+	s := &Server{
+		conn:    conn,
+		load:    load,
+		logf:    log.Printf,
+		timeout: DefaultPeerTimeout,
+		jams:    make(map[uuid.UUID]*jam.Jam),
+		peers:   make(map[uuid.UUID]*peer),
+		mirrors: make(map[uuid.UUID]*mirror),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// Serve reads packets until ctx is done or the connection is closed,
+// which Serve does once ctx is done.
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	go s.expire(ctx)
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("osc read: %w", err)
+		}
+
+		ms, err := osc.Parse(buf[:n])
+		if err != nil {
+			s.logf("osc %s: %v\n", from, err)
+			continue
+		}
+
+		for _, m := range ms {
+			if err := s.handle(ctx, from, m); err != nil {
+				s.logf("osc %s %s: %v\n", from, m.Address, err)
+				s.reply(from, errorAddress(m.Address), err.Error())
+			}
+		}
+	}
+}
+
+// Close closes the connection, stops mirroring the jams and makes every
+// peer leave the jam it played in.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for id, m := range s.mirrors {
+		m.stop()
+		delete(s.mirrors, id)
+	}
+	peers := s.peers
+	s.peers = make(map[uuid.UUID]*peer)
+	s.mu.Unlock()
+
+	for id, p := range peers {
+		p.leave(id)
+	}
+
+	return s.conn.Close()
+}
+
+// expire makes the peers that went idle leave their jam until ctx is done.
+func (s *Server) expire(ctx context.Context) {
+	if s.timeout <= 0 {
+		return
+	}
+
+	t := time.NewTicker(s.timeout / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			idle := make(map[uuid.UUID]*peer)
+			for id, p := range s.peers {
+				if now.Sub(p.seen) > s.timeout {
+					idle[id] = p
+					delete(s.peers, id)
+					s.unmirror(p.jam.ID, id)
+				}
+			}
+			s.mu.Unlock()
+
+			for id, p := range idle {
+				p.leave(id)
+			}
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, from net.Addr, m osc.Message) error {
+	if !isLocal(from) {
+		return ErrNotLocal
+	}
+
+	jamID, cmd, ok := parseAddress(m.Address)
+	if !ok {
+		return ErrAddress
+	}
+
+	j, err := s.jam(ctx, jamID)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "subscribe", "unsubscribe":
+		to, err := subscriber(from, m)
+		if err != nil {
+			return err
+		}
+		if cmd == "unsubscribe" {
+			s.unsubscribe(jamID, to)
+			s.leave(j, from)
+			return nil
+		}
+
+		id, err := s.peer(j, from)
+		if err != nil {
+			return err
+		}
+		s.subscribe(j, to, id)
+		s.reply(to, Prefix+jamID.String()+"/subscribed")
+		return nil
+	}
+
+	note, err := toMIDI(cmd, m)
+	if err != nil {
+		return err
+	}
+
+	e := msg.Envelope{ID: uuid.New(), Typ: msg.MIDI}
+	if err := e.SetPayload(note); err != nil {
+		return err
+	}
+
+	id, err := s.peer(j, from)
+	if err != nil {
+		return err
+	}
+	return j.Receive(id, &e)
+}
+
+// jam returns the jam with the given id, loading it the first time.
+func (s *Server) jam(ctx context.Context, id uuid.UUID) (*jam.Jam, error) {
+	s.mu.Lock()
+	j, ok := s.jams[id]
+	s.mu.Unlock()
+	if ok {
+		return j, nil
+	}
+
+	j, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loaded, ok := s.jams[id]; ok {
+		return loaded, nil
+	}
+	s.jams[id] = j
+	return j, nil
+}
+
+// peer returns the participant a peer plays as in a jam, the same every
+// time it sends from the same address. A peer new to the jam takes a seat
+// of it, ErrFull is returned if there is none left.
+func (s *Server) peer(j *jam.Jam, from net.Addr) (uuid.UUID, error) {
+	id := peerID(j, from)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.peers[id]; ok {
+		p.seen = time.Now()
+		return id, nil
+	}
+
+	if !j.Client().Reserve() {
+		return uuid.Nil, ErrFull
+	}
+	s.peers[id] = &peer{jam: j, seen: time.Now()}
+	j.AddUser(&jam.User{ID: suid.UUID{UUID: id}, Username: "osc " + from.String()})
+	return id, nil
+}
+
+// leave makes a peer leave a jam, until it plays in it again.
+func (s *Server) leave(j *jam.Jam, from net.Addr) {
+	id := peerID(j, from)
+
+	s.mu.Lock()
+	p, ok := s.peers[id]
+	delete(s.peers, id)
+	s.mu.Unlock()
+
+	if ok {
+		p.leave(id)
+	}
+}
+
+// leave gives the seat of the peer back to the jam.
+func (p *peer) leave(id uuid.UUID) {
+	p.jam.Leave(id)
+	p.jam.Client().Release()
+}
+
+func peerID(j *jam.Jam, from net.Addr) uuid.UUID {
+	return uuid.NewSHA1(j.ID, []byte("osc:"+from.String()))
+}
+
+func (s *Server) subscribe(j *jam.Jam, to net.Addr, peer uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mirrors[j.ID]
+	if !ok {
+		m = &mirror{
+			out:     make(chan *msg.Envelope, mirrorBuffer),
+			targets: make(map[string]target),
+		}
+		m.untap = j.Tap(func(e *msg.Envelope) {
+			select {
+			case m.out <- e:
+			default:
+			}
+		})
+		s.mirrors[j.ID] = m
+		go s.mirror(j.ID, m)
+	}
+
+	m.targets[to.String()] = target{addr: to, peer: peer}
+}
+
+func (s *Server) unsubscribe(jamID uuid.UUID, to net.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mirrors[jamID]
+	if !ok {
+		return
+	}
+
+	delete(m.targets, to.String())
+	if len(m.targets) == 0 {
+		m.stop()
+		delete(s.mirrors, jamID)
+	}
+}
+
+// unmirror stops mirroring a jam to the subscriptions of a peer.
+// It must be called with the lock held.
+func (s *Server) unmirror(jamID, peer uuid.UUID) {
+	m, ok := s.mirrors[jamID]
+	if !ok {
+		return
+	}
+
+	for addr, t := range m.targets {
+		if t.peer == peer {
+			delete(m.targets, addr)
+		}
+	}
+	if len(m.targets) == 0 {
+		m.stop()
+		delete(s.mirrors, jamID)
+	}
+}
+
+// stop must be called with the lock of the server held.
+func (m *mirror) stop() {
+	m.untap()
+	close(m.out)
+}
+
+// mirror sends the envelopes of a jam to its subscribers until it is stopped.
+func (s *Server) mirror(jamID uuid.UUID, m *mirror) {
+	for e := range m.out {
+		ms := fromEnvelope(jamID, e)
+		if len(ms) == 0 {
+			continue
+		}
+
+		s.mu.Lock()
+		targets := make([]target, 0, len(m.targets))
+		for _, t := range m.targets {
+			if t.peer != e.UserID {
+				targets = append(targets, t)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, om := range ms {
+			p, err := om.MarshalBinary()
+			if err != nil {
+				continue
+			}
+			for _, t := range targets {
+				if _, err := s.conn.WriteTo(p, t.addr); err != nil {
+					s.logf("osc %s: %v\n", t.addr, err)
+				}
+			}
+		}
+	}
+}
+
+// reply sends a message to a peer on a local network.
+func (s *Server) reply(to net.Addr, address string, args ...any) {
+	if !isLocal(to) {
+		return
+	}
+
+	p, err := osc.NewMessage(address, args...).MarshalBinary()
+	if err != nil {
+		return
+	}
+	if _, err := s.conn.WriteTo(p, to); err != nil {
+		s.logf("osc %s: %v\n", to, err)
+	}
+}
+
+// parseAddress splits /rmx/{jam id}/{cmd}.
+func parseAddress(address string) (uuid.UUID, string, bool) {
+	if !strings.HasPrefix(address, Prefix) {
+		return uuid.Nil, "", false
+	}
+	id, cmd, ok := strings.Cut(strings.TrimPrefix(address, Prefix), "/")
+	if !ok {
+		return uuid.Nil, "", false
+	}
+	jamID, err := uuid.Parse(id)
+	return jamID, cmd, err == nil
+}
+
+// errorAddress returns the address errors about a message to address are
+// sent to, under the jam it was sent to if any.
+func errorAddress(address string) string {
+	if jamID, _, ok := parseAddress(address); ok {
+		return Prefix + jamID.String() + "/error"
+	}
+	return strings.TrimSuffix(Prefix, "/") + "/error"
+}
+
+// subscriber returns the address of the peer subscribing from, on the port
+// given as argument if any.
+func subscriber(from net.Addr, m osc.Message) (net.Addr, error) {
+	if len(m.Args) == 0 {
+		return from, nil
+	}
+
+	port, ok := m.Int(0)
+	if !ok || port <= 0 || port > 65535 {
+		return nil, ErrArgs
+	}
+	host, _, err := net.SplitHostPort(from.String())
+	if err != nil {
+		return nil, err
+	}
+	return net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+func isLocal(addr net.Addr) bool {
+	u, ok := addr.(*net.UDPAddr)
+	return ok && (u.IP.IsLoopback() || u.IP.IsPrivate() || u.IP.IsLinkLocalUnicast())
+}
+
+// toMIDI returns the MIDI message of an OSC message.
+func toMIDI(cmd string, m osc.Message) (msg.MIDIMsg, error) {
+	var (
+		args []int
+		n    int
+	)
+	switch cmd {
+	case "note", "cc":
+		n = 2
+	case "bend", "pressure":
+		n = 1
+	default:
+		return msg.MIDIMsg{}, ErrAddress
+	}
+	// the channel is optional
+	if len(m.Args) < n || len(m.Args) > n+1 {
+		return msg.MIDIMsg{}, ErrArgs
+	}
+	for i := range m.Args {
+		v, ok := m.Int(i)
+		if !ok {
+			return msg.MIDIMsg{}, ErrArgs
+		}
+		args = append(args, v)
+	}
+	if len(args) == n {
+		args = append(args, 0)
+	}
+
+	var note msg.MIDIMsg
+	switch cmd {
+	case "note":
+		note = msg.MIDIMsg{State: msg.NOTE_ON, Number: args[0], Velocity: args[1], Channel: args[2]}
+		if note.Velocity == 0 {
+			note.State = msg.NOTE_OFF
+		}
+	case "cc":
+		note = msg.MIDIMsg{State: msg.CONTROL_CHANGE, Number: args[0], Value: args[1], Channel: args[2]}
+	case "bend":
+		note = msg.MIDIMsg{State: msg.PITCH_BEND, Value: args[0], Channel: args[1]}
+	case "pressure":
+		note = msg.MIDIMsg{State: msg.CHANNEL_PRESSURE, Value: args[0], Channel: args[1]}
+	}
+	return note, nil
+}
+
+// fromEnvelope returns the OSC messages mirroring an envelope relayed to a jam.
+func fromEnvelope(jamID uuid.UUID, e *msg.Envelope) []osc.Message {
+	prefix := Prefix + jamID.String() + "/"
+	userID := e.UserID.String()
+
+	var notes []msg.MIDIMsg
+	switch e.Typ {
+	case msg.TEXT:
+		var t msg.TextMsg
+		if e.Unwrap(&t) != nil {
+			return nil
+		}
+		return []osc.Message{osc.NewMessage(prefix+"text", t.DisplayName, t.Body)}
+	case msg.MIDI:
+		var m msg.MIDIMsg
+		if e.Unwrap(&m) != nil {
+			return nil
+		}
+		notes = append(notes, m)
+	case msg.UMP:
+		var u msg.UMPMsg
+		if e.Unwrap(&u) != nil {
+			return nil
+		}
+		for _, p := range u.Packets {
+			if m, ok := p.MIDI(); ok {
+				notes = append(notes, m)
+			}
+		}
+	}
+
+	ms := make([]osc.Message, 0, len(notes))
+	for _, m := range notes {
+		ch := int32(m.Channel)
+		switch m.State {
+		case msg.NOTE_ON:
+			ms = append(ms, osc.NewMessage(prefix+"note", int32(m.Number), int32(m.Velocity), ch, userID))
+		case msg.NOTE_OFF:
+			ms = append(ms, osc.NewMessage(prefix+"note", int32(m.Number), int32(0), ch, userID))
+		case msg.CONTROL_CHANGE:
+			ms = append(ms, osc.NewMessage(prefix+"cc", int32(m.Number), int32(m.Value), ch, userID))
+		case msg.PITCH_BEND:
+			ms = append(ms, osc.NewMessage(prefix+"bend", int32(m.Value), ch, userID))
+		case msg.CHANNEL_PRESSURE:
+			ms = append(ms, osc.NewMessage(prefix+"pressure", int32(m.Value), ch, userID))
+		}
+	}
+	return ms
+}
@@ -0,0 +1,242 @@
+package bridge_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rapidmidiex/rmx/internal/jam"
+	bridge "github.com/rapidmidiex/rmx/internal/jam/osc"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/osc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	j := &jam.Jam{ID: uuid.New()}
+	j.SetDefaults()
+
+	// live before the bridge shares it
+	ws := httptest.NewServer(j.Client())
+	t.Cleanup(ws.Close)
+
+	load := func(ctx context.Context, id uuid.UUID) (*jam.Jam, error) {
+		if id != j.ID {
+			return nil, errors.New("jam not found")
+		}
+		return j, nil
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := bridge.New(conn, load, bridge.WithLogger(t.Logf))
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx) }()
+
+	player, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ws.URL, "http"), nil)
+	require.NoError(t, err)
+	defer player.Close()
+
+	var envelope msg.Envelope
+	require.NoError(t, player.ReadJSON(&envelope))
+	require.Equal(t, msg.CONNECT, envelope.Typ)
+
+	controller, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer controller.Close()
+
+	prefix := fmt.Sprintf("%s%s/", bridge.Prefix, j.ID)
+
+	send := func(address string, args ...any) {
+		p, err := osc.NewMessage(address, args...).MarshalBinary()
+		require.NoError(t, err)
+		_, err = controller.Write(p)
+		require.NoError(t, err)
+	}
+
+	receive := func() osc.Message {
+		buf := make([]byte, 1024)
+		require.NoError(t, controller.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, err := controller.Read(buf)
+		require.NoError(t, err)
+
+		ms, err := osc.Parse(buf[:n])
+		require.NoError(t, err)
+		require.Len(t, ms, 1)
+		return ms[0]
+	}
+
+	send(prefix + "subscribe")
+	require.Equal(t, prefix+"subscribed", receive().Address)
+
+	var controllerID uuid.UUID
+
+	t.Run("plays OSC notes into the jam", func(t *testing.T) {
+		send(prefix+"note", float32(60), float32(100), int32(2))
+
+		require.NoError(t, player.ReadJSON(&envelope))
+		require.Equal(t, msg.MIDI, envelope.Typ)
+		require.NotEqual(t, uuid.Nil, envelope.UserID, "the controller plays as a participant")
+
+		var note msg.MIDIMsg
+		require.NoError(t, envelope.Unwrap(&note))
+		require.Equal(t, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100, Channel: 2}, note)
+
+		controllerID = envelope.UserID
+		u, ok := j.User(controllerID)
+		require.True(t, ok)
+		require.True(t, strings.HasPrefix(u.Username, "osc "))
+
+		send(prefix+"note", int32(60), int32(0), int32(2))
+		require.NoError(t, player.ReadJSON(&envelope))
+		require.NoError(t, envelope.Unwrap(&note))
+		require.Equal(t, msg.NOTE_OFF, note.State, "velocity 0 turns the note off")
+
+		send(prefix+"bend", int32(12000))
+		require.NoError(t, player.ReadJSON(&envelope))
+		note = msg.MIDIMsg{}
+		require.NoError(t, envelope.Unwrap(&note))
+		require.Equal(t, msg.MIDIMsg{State: msg.PITCH_BEND, Value: 12000}, note)
+	})
+
+	t.Run("mirrors the jam to subscribers", func(t *testing.T) {
+		e := msg.Envelope{ID: uuid.New(), Typ: msg.MIDI}
+		require.NoError(t, e.SetPayload(msg.MIDIMsg{State: msg.NOTE_ON, Number: 64, Velocity: 90, Channel: 1}))
+		require.NoError(t, player.WriteJSON(e))
+		require.NoError(t, player.ReadJSON(&envelope))
+
+		got := receive()
+		require.Equal(t, prefix+"note", got.Address, "the controller is not sent its own notes")
+		require.Equal(t, []any{int32(64), int32(90), int32(1), envelope.UserID.String()}, got.Args)
+
+		e = msg.Envelope{ID: uuid.New(), Typ: msg.TEXT}
+		require.NoError(t, e.SetPayload(msg.TextMsg{DisplayName: "clara", Body: "Howdy"}))
+		require.NoError(t, player.WriteJSON(e))
+		require.NoError(t, player.ReadJSON(&envelope))
+
+		got = receive()
+		require.Equal(t, prefix+"text", got.Address)
+		require.Equal(t, []any{"clara", "Howdy"}, got.Args)
+	})
+
+	t.Run("tells peers what was rejected", func(t *testing.T) {
+		send(prefix+"note", int32(200), int32(100))
+		got := receive()
+		require.Equal(t, prefix+"error", got.Address)
+		require.Equal(t, []any{jam.ErrInvalidMIDI.Error()}, got.Args)
+
+		send(prefix+"note", "C4")
+		require.Equal(t, []any{bridge.ErrArgs.Error()}, receive().Args)
+
+		send(fmt.Sprintf("%s%s/note", bridge.Prefix, uuid.New()), int32(60), int32(100))
+		require.Equal(t, []any{"jam not found"}, receive().Args)
+
+		send("/synth/note", int32(60), int32(100))
+		require.Equal(t, "/rmx/error", receive().Address)
+	})
+
+	t.Run("stops mirroring once unsubscribed", func(t *testing.T) {
+		send(prefix + "unsubscribe")
+		// messages from a peer are handled in order
+		send(prefix + "cc")
+		require.Equal(t, []any{bridge.ErrArgs.Error()}, receive().Args)
+
+		_, ok := j.User(controllerID)
+		require.False(t, ok, "unsubscribing leaves the jam")
+
+		e := msg.Envelope{ID: uuid.New(), Typ: msg.MIDI}
+		require.NoError(t, e.SetPayload(msg.MIDIMsg{State: msg.NOTE_OFF, Number: 64, Channel: 1}))
+		require.NoError(t, player.WriteJSON(e))
+		require.NoError(t, player.ReadJSON(&envelope))
+
+		require.NoError(t, controller.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		_, err := controller.Read(make([]byte, 1024))
+		require.Error(t, err)
+	})
+
+	cancel()
+	require.NoError(t, <-served)
+}
+
+func TestBridgeSeats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	j := &jam.Jam{ID: uuid.New(), Capacity: 1}
+	j.SetDefaults()
+
+	ws := httptest.NewServer(j.Client())
+	t.Cleanup(ws.Close)
+
+	load := func(ctx context.Context, id uuid.UUID) (*jam.Jam, error) { return j, nil }
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := bridge.New(conn, load, bridge.WithLogger(t.Logf), bridge.WithPeerTimeout(200*time.Millisecond))
+	go srv.Serve(ctx)
+
+	dial := func() *net.UDPConn {
+		c, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	send := func(c *net.UDPConn, address string, args ...any) {
+		p, err := osc.NewMessage(address, args...).MarshalBinary()
+		require.NoError(t, err)
+		_, err = c.Write(p)
+		require.NoError(t, err)
+	}
+
+	note := fmt.Sprintf("%s%s/note", bridge.Prefix, j.ID)
+	first, second := dial(), dial()
+
+	t.Run("peers take a seat of the jam", func(t *testing.T) {
+		send(first, note, int32(60), int32(100))
+		send(second, note, int32(60), int32(100))
+
+		buf := make([]byte, 1024)
+		require.NoError(t, second.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, err := second.Read(buf)
+		require.NoError(t, err)
+		ms, err := osc.Parse(buf[:n])
+		require.NoError(t, err)
+		require.Equal(t, []any{bridge.ErrFull.Error()}, ms[0].Args)
+	})
+
+	t.Run("idle peers leave the jam", func(t *testing.T) {
+		player, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ws.URL, "http"), nil)
+		require.NoError(t, err)
+		defer player.Close()
+
+		var (
+			envelope msg.Envelope
+			w        msg.WaitlistMsg
+		)
+		require.NoError(t, player.ReadJSON(&envelope))
+		require.Equal(t, msg.CONNECT, envelope.Typ)
+		require.NoError(t, player.ReadJSON(&envelope))
+		require.Equal(t, msg.WAITLIST, envelope.Typ)
+		require.NoError(t, envelope.Unwrap(&w))
+		require.Equal(t, 1, w.Position, "the peer holds the only seat")
+
+		require.NoError(t, player.SetReadDeadline(time.Now().Add(2*time.Second)))
+		require.NoError(t, player.ReadJSON(&envelope))
+		require.Equal(t, msg.WAITLIST, envelope.Typ)
+		require.NoError(t, envelope.Unwrap(&w))
+		require.Equal(t, 0, w.Position, "the seat of the peer is given back")
+	})
+}
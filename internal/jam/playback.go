@@ -0,0 +1,432 @@
+package jam
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+const (
+	// PlaybackName is the username of the virtual participant playing recordings back.
+	PlaybackName = "Playback"
+	// BackingName is the username of the virtual participant playing backing tracks.
+	BackingName = "Backing track"
+)
+
+var (
+	ErrPlaying    = errors.New("already playing")
+	ErrNotPlaying = errors.New("nothing is playing")
+)
+
+// Player plays a sequence back into a live jam as a virtual participant.
+// Playback follows the transport of the jam.
+type Player struct {
+	// Virtual participant the sequence is played back as.
+	ID uuid.UUID
+	// Recording or backing track being played.
+	SourceID uuid.UUID
+
+	j       *Jam
+	slot    **Player // where the room keeps the player, if anywhere
+	seq     Sequence
+	backing bool
+	// quiet players do not broadcast their status, their owner does
+	quiet bool
+
+	mu sync.Mutex
+	// transport beat at which the sequence started, while playing
+	offset float64
+	// position in the sequence, while paused or stopped
+	pos     float64
+	next    int     // index of the next cue to play
+	played  float64 // position the cues were last played up to
+	held    map[heldNote]bool
+	muted   map[int]bool
+	paused  bool
+	loop    bool
+	stopped bool
+
+	wake     chan struct{}
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+type heldNote struct {
+	track, channel, number int
+}
+
+// Play starts playing a recording back into the jam from its beginning,
+// on the next beat of the transport.
+func (j *Jam) Play(recordingID uuid.UUID, seq Sequence, loop bool) (*Player, error) {
+	j.Client()
+	return j.play(&j.room.player, recordingID, seq, loop, false)
+}
+
+// PlayBacking starts playing a backing track into the jam from its beginning,
+// on the next bar of the transport.
+func (j *Jam) PlayBacking(trackID uuid.UUID, seq Sequence, loop bool) (*Player, error) {
+	j.Client()
+	return j.play(&j.room.backing, trackID, seq, loop, true)
+}
+
+func (j *Jam) play(slot **Player, sourceID uuid.UUID, seq Sequence, loop, backing bool) (*Player, error) {
+	p := newPlayer(j, sourceID, seq, loop)
+	p.slot, p.backing = slot, backing
+
+	name, every := PlaybackName, 1.0
+	if backing {
+		name, every = BackingName, BeatsPerBar
+	}
+	p.offset = j.nextBeat(every)
+
+	j.room.mu.Lock()
+	if *slot != nil {
+		j.room.mu.Unlock()
+		return nil, ErrPlaying
+	}
+	*slot = p
+	j.room.users[p.ID] = &User{ID: suid.UUID{UUID: p.ID}, Username: name}
+	j.room.mu.Unlock()
+
+	go p.run()
+	return p, p.broadcast()
+}
+
+func newPlayer(j *Jam, sourceID uuid.UUID, seq Sequence, loop bool) *Player {
+	return &Player{
+		ID:       uuid.New(),
+		SourceID: sourceID,
+		j:        j,
+		seq:      seq,
+		played:   math.Inf(-1),
+		held:     make(map[heldNote]bool),
+		muted:    make(map[int]bool),
+		loop:     loop,
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Player returns the current playback of a recording, if any.
+func (j *Jam) Player() (*Player, bool) {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.player, j.room.player != nil
+}
+
+// Backing returns the current playback of a backing track, if any.
+func (j *Jam) Backing() (*Player, bool) {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.backing, j.room.backing != nil
+}
+
+// Status returns the state of the playback.
+func (p *Player) Status() msg.PlaybackMsg {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	beat := p.position()
+	if beat < 0 {
+		beat = 0
+	}
+
+	muted := make([]int, 0, len(p.muted))
+	for t := range p.muted {
+		muted = append(muted, t)
+	}
+	sort.Ints(muted)
+
+	return msg.PlaybackMsg{
+		RecordingID: p.SourceID,
+		UserID:      p.ID,
+		Playing:     !p.stopped,
+		Paused:      p.paused,
+		Loop:        p.loop,
+		Beat:        beat,
+		Length:      p.seq.Length,
+		Backing:     p.backing,
+		Tracks:      p.seq.Tracks,
+		Muted:       muted,
+	}
+}
+
+// position returns the position of the playback in the sequence. It is
+// negative until the transport reaches the start of the sequence.
+// It must be called with the lock held.
+func (p *Player) position() float64 {
+	if p.paused || p.stopped {
+		return p.pos
+	}
+	return p.j.Beat() - p.offset
+}
+
+// Pause pauses or resumes the playback.
+func (p *Player) Pause(paused bool) error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrNotPlaying
+	}
+
+	switch {
+	case paused && !p.paused:
+		p.pos = p.position()
+		p.release(nil)
+	case !paused && p.paused:
+		p.offset = p.j.Beat() - p.pos
+	}
+	p.paused = paused
+	p.mu.Unlock()
+
+	p.wakeUp()
+	return p.broadcast()
+}
+
+// Seek moves the playback to the given beat of the sequence.
+func (p *Player) Seek(beat float64) error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrNotPlaying
+	}
+
+	if beat < 0 {
+		beat = 0
+	}
+	if beat > p.seq.Length {
+		beat = p.seq.Length
+	}
+
+	p.release(nil)
+	if p.paused {
+		p.pos = beat
+	} else {
+		p.offset = p.j.Beat() - beat
+	}
+	p.next = p.seq.seek(beat)
+	p.mu.Unlock()
+
+	p.wakeUp()
+	return p.broadcast()
+}
+
+// SetLoop sets whether the playback starts over once it reaches the end.
+func (p *Player) SetLoop(loop bool) error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrNotPlaying
+	}
+	p.loop = loop
+	p.mu.Unlock()
+
+	p.wakeUp()
+	return p.broadcast()
+}
+
+// SetMuted sets the tracks of the sequence that are not played,
+// replacing the previously muted ones.
+func (p *Player) SetMuted(tracks []int) error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrNotPlaying
+	}
+
+	p.muted = make(map[int]bool)
+	for _, t := range tracks {
+		if t >= 0 && t < len(p.seq.Tracks) {
+			p.muted[t] = true
+		}
+	}
+	p.release(p.muted)
+	p.mu.Unlock()
+
+	return p.broadcast()
+}
+
+// Stop ends the playback, releasing any note still held.
+func (p *Player) Stop() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrNotPlaying
+	}
+	p.pos = p.position()
+	p.stopped = true
+	p.release(nil)
+	p.mu.Unlock()
+
+	p.quitOnce.Do(func() { close(p.quit) })
+
+	if p.slot != nil {
+		p.j.room.mu.Lock()
+		if *p.slot == p {
+			*p.slot = nil
+		}
+		p.j.room.mu.Unlock()
+	}
+
+	return p.broadcast()
+}
+
+func (p *Player) run() {
+	for {
+		p.mu.Lock()
+		wait, done := p.advance()
+		p.mu.Unlock()
+
+		if done {
+			p.Stop()
+			return
+		}
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			fire = timer.C
+		}
+
+		select {
+		case <-fire:
+		case <-p.wake:
+		case <-p.quit:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-p.quit:
+			return
+		default:
+		}
+	}
+}
+
+// advance plays the cues that are due and returns how long until the next
+// one, or a negative duration if the playback is paused.
+// done is true once the end of a sequence that does not loop is reached.
+// It must be called with the lock held.
+func (p *Player) advance() (wait time.Duration, done bool) {
+	if p.stopped {
+		return -1, true
+	}
+	if p.paused {
+		return -1, false
+	}
+
+	pos := p.position()
+	for {
+		for p.next < len(p.seq.Cues) && p.seq.Cues[p.next].Beat <= pos {
+			if c := p.seq.Cues[p.next]; !p.muted[c.Track] {
+				p.play(c.Track, c.MIDIMsg)
+			}
+			p.next++
+		}
+
+		if p.next < len(p.seq.Cues) || pos < p.seq.Length {
+			break
+		}
+
+		if !p.loop || p.seq.Length <= 0 {
+			return -1, true
+		}
+
+		p.release(nil)
+		p.offset += p.seq.Length
+		pos -= p.seq.Length
+		p.next = 0
+	}
+	p.played = pos
+
+	end := p.seq.Length
+	if p.next < len(p.seq.Cues) {
+		end = p.seq.Cues[p.next].Beat
+	}
+
+	return time.Until(p.j.timeAt(p.offset + end)), false
+}
+
+// setSequence replaces the sequence being played without moving the playback.
+// Cues of the new sequence past the position the cues were last played up to
+// are still played, held notes the new sequence does not turn off are released.
+func (p *Player) setSequence(seq Sequence) {
+	p.mu.Lock()
+	p.seq = seq
+	p.next = sort.Search(len(seq.Cues), func(i int) bool { return seq.Cues[i].Beat > p.played })
+
+	for n := range p.held {
+		if !seq.turnsOff(n, p.next) {
+			p.play(n.track, msg.MIDIMsg{State: msg.NOTE_OFF, Number: n.number, Channel: n.channel})
+		}
+	}
+	p.mu.Unlock()
+
+	p.wakeUp()
+}
+
+// play relays a message to the jam from the virtual participant.
+// It must be called with the lock held.
+func (p *Player) play(track int, m msg.MIDIMsg) {
+	n := heldNote{track, m.Channel, m.Number}
+	switch {
+	case !m.IsNote():
+	case m.State == msg.NOTE_ON && m.Velocity > 0:
+		p.held[n] = true
+	default:
+		delete(p.held, n)
+	}
+
+	now := time.Now()
+	p.j.room.mu.RLock()
+	p.j.record(p.ID, m, now)
+	p.j.room.mu.RUnlock()
+
+	c := p.j.analyze(p.ID, m, now)
+
+	e := msg.Envelope{ID: uuid.New(), Typ: msg.MIDI, UserID: p.ID}
+	if err := e.SetPayload(m); err != nil {
+		return
+	}
+
+	p.j.broadcastEnvelope(&e)
+	p.j.announce(c)
+}
+
+// release turns off the notes held by the given tracks, or every note if tracks is nil.
+// It must be called with the lock held.
+func (p *Player) release(tracks map[int]bool) {
+	for n := range p.held {
+		if tracks == nil || tracks[n.track] {
+			p.play(n.track, msg.MIDIMsg{State: msg.NOTE_OFF, Number: n.number, Channel: n.channel})
+		}
+	}
+}
+
+func (p *Player) wakeUp() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Player) broadcast() error {
+	if p.quiet {
+		return nil
+	}
+	return p.j.Broadcast(msg.PLAYBACK, p.Status())
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "jam_ban";
+
+ALTER TABLE "jam"
+    DROP COLUMN IF EXISTS "owner_id";
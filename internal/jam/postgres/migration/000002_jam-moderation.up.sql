@@ -0,0 +1,9 @@
+ALTER TABLE "jam"
+    ADD COLUMN "owner_id" uuid;
+
+CREATE TABLE "jam_ban" (
+    "jam_id" uuid NOT NULL REFERENCES "jam" ("id") ON DELETE CASCADE,
+    "user_id" uuid NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now()),
+    PRIMARY KEY ("jam_id", "user_id")
+);
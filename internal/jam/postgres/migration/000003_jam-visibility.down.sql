@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "jam_invite";
+
+ALTER TABLE "jam"
+    DROP COLUMN IF EXISTS "visibility",
+    DROP COLUMN IF EXISTS "passcode_hash";
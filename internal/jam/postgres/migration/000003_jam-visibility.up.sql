@@ -0,0 +1,12 @@
+ALTER TABLE "jam"
+    ADD COLUMN "visibility" varchar(8) NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'unlisted', 'private')),
+    ADD COLUMN "passcode_hash" bytea;
+
+CREATE TABLE "jam_invite" (
+    "id" uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    "jam_id" uuid NOT NULL REFERENCES "jam" ("id") ON DELETE CASCADE,
+    "expires_at" timestamptz NOT NULL,
+    "max_uses" int NOT NULL CHECK (max_uses > 0),
+    "uses" int NOT NULL DEFAULT 0,
+    "created_at" timestamptz NOT NULL DEFAULT (now())
+);
@@ -0,0 +1,10 @@
+CREATE TABLE "jam_message" (
+    "id" uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    "jam_id" uuid NOT NULL REFERENCES "jam" ("id") ON DELETE CASCADE,
+    "user_id" uuid NOT NULL,
+    "display_name" varchar(255) NOT NULL,
+    "body" text NOT NULL CHECK (body <> ''),
+    "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "jam_message" ("jam_id", "created_at");
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "jam_recording_event";
+
+DROP TABLE IF EXISTS "jam_recording";
@@ -0,0 +1,23 @@
+CREATE TABLE "jam_recording" (
+    "id" uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    "jam_id" uuid NOT NULL REFERENCES "jam" ("id") ON DELETE CASCADE,
+    "bpm" int NOT NULL CHECK (bpm > 0),
+    "started_at" timestamptz NOT NULL DEFAULT (now()),
+    "stopped_at" timestamptz
+);
+
+CREATE INDEX ON "jam_recording" ("jam_id", "started_at");
+
+CREATE TABLE "jam_recording_event" (
+    "id" bigserial PRIMARY KEY,
+    "recording_id" uuid NOT NULL REFERENCES "jam_recording" ("id") ON DELETE CASCADE,
+    "user_id" uuid NOT NULL,
+    "user_name" varchar(255) NOT NULL,
+    "state" smallint NOT NULL,
+    "number" smallint NOT NULL CHECK (number BETWEEN 0 AND 127),
+    "velocity" smallint NOT NULL CHECK (velocity BETWEEN 0 AND 127),
+    "bpm" int NOT NULL CHECK (bpm > 0),
+    "recorded_at" timestamptz NOT NULL
+);
+
+CREATE INDEX ON "jam_recording_event" ("recording_id", "recorded_at");
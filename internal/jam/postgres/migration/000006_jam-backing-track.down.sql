@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "jam_backing_track";
@@ -0,0 +1,9 @@
+CREATE TABLE "jam_backing_track" (
+    "id" uuid PRIMARY KEY DEFAULT uuid_generate_v4 (),
+    "jam_id" uuid NOT NULL REFERENCES "jam" ("id") ON DELETE CASCADE,
+    "name" varchar(255) NOT NULL CHECK (name <> ''),
+    "data" bytea NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "jam_backing_track" ("jam_id", "created_at");
@@ -0,0 +1,3 @@
+ALTER TABLE "jam"
+    DROP COLUMN IF EXISTS "quantize",
+    DROP COLUMN IF EXISTS "quantize_strength";
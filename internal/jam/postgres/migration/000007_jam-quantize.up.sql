@@ -0,0 +1,3 @@
+ALTER TABLE "jam"
+    ADD COLUMN "quantize" varchar(5) NOT NULL DEFAULT 'off' CHECK (quantize IN ('off', '1/8', '1/16', '1/8t', '1/16t')),
+    ADD COLUMN "quantize_strength" smallint NOT NULL DEFAULT 100 CHECK (quantize_strength BETWEEN 1 AND 100);
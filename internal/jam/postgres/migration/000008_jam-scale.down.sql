@@ -0,0 +1,4 @@
+ALTER TABLE "jam"
+    DROP COLUMN IF EXISTS "key",
+    DROP COLUMN IF EXISTS "scale",
+    DROP COLUMN IF EXISTS "scale_mode";
@@ -0,0 +1,4 @@
+ALTER TABLE "jam"
+    ADD COLUMN "key" varchar(2) NOT NULL DEFAULT '',
+    ADD COLUMN "scale" varchar(16) NOT NULL DEFAULT '',
+    ADD COLUMN "scale_mode" varchar(6) NOT NULL DEFAULT 'off' CHECK (scale_mode IN ('off', 'reject', 'snap'));
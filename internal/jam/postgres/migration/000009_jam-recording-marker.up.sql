@@ -0,0 +1,9 @@
+CREATE TABLE "jam_recording_marker" (
+    "id" bigserial PRIMARY KEY,
+    "recording_id" uuid NOT NULL REFERENCES "jam_recording" ("id") ON DELETE CASCADE,
+    "text" varchar(255) NOT NULL,
+    "bpm" int NOT NULL CHECK (bpm > 0),
+    "marked_at" timestamptz NOT NULL
+);
+
+CREATE INDEX ON "jam_recording_marker" ("recording_id", "marked_at");
@@ -0,0 +1,3 @@
+ALTER TABLE "jam_recording_event"
+    DROP COLUMN IF EXISTS "channel",
+    DROP COLUMN IF EXISTS "value";
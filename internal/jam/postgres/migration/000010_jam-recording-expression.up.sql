@@ -0,0 +1,3 @@
+ALTER TABLE "jam_recording_event"
+    ADD COLUMN "channel" smallint NOT NULL DEFAULT 0 CHECK (channel BETWEEN 0 AND 15),
+    ADD COLUMN "value" int NOT NULL DEFAULT 0 CHECK (value BETWEEN 0 AND 16383);
@@ -0,0 +1,3 @@
+ALTER TABLE "jam"
+    DROP COLUMN IF EXISTS "sysex_max_size",
+    DROP COLUMN IF EXISTS "sysex_manufacturers";
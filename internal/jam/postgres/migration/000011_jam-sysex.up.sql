@@ -0,0 +1,3 @@
+ALTER TABLE "jam"
+    ADD COLUMN "sysex_max_size" integer NOT NULL DEFAULT 4096 CHECK (sysex_max_size BETWEEN 1 AND 65536),
+    ADD COLUMN "sysex_manufacturers" text[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,27 @@
+-- name: CreateBackingTrack :one
+INSERT INTO jam_backing_track (jam_id, name, data)
+    VALUES ($1, $2, $3)
+RETURNING
+    *;
+
+-- name: GetBackingTrack :one
+SELECT
+    *
+FROM
+    jam_backing_track
+WHERE
+    id = $1
+LIMIT 1;
+
+-- name: ListBackingTracks :many
+SELECT
+    id,
+    jam_id,
+    name,
+    created_at
+FROM
+    jam_backing_track
+WHERE
+    jam_id = $1
+ORDER BY
+    created_at DESC;
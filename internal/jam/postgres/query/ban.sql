@@ -0,0 +1,16 @@
+-- name: CreateBan :exec
+INSERT INTO jam_ban (jam_id, user_id)
+    VALUES ($1, $2)
+ON CONFLICT
+    DO NOTHING;
+
+-- name: IsBanned :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            jam_ban
+        WHERE
+            jam_id = $1
+            AND user_id = $2);
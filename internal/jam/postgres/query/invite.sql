@@ -0,0 +1,18 @@
+-- name: CreateInvite :one
+INSERT INTO jam_invite (jam_id, expires_at, max_uses)
+    VALUES ($1, $2, $3)
+RETURNING
+    *;
+
+-- name: RedeemInvite :one
+UPDATE
+    jam_invite
+SET
+    uses = uses + 1
+WHERE
+    id = $1
+    AND jam_id = $2
+    AND expires_at > now()
+    AND uses < max_uses
+RETURNING
+    *;
@@ -1,6 +1,6 @@
 -- name: CreateJam :one
-INSERT INTO jam (name, bpm, capacity)
-    VALUES ($1, $2, $3)
+INSERT INTO jam (name, bpm, capacity, owner_id, visibility, passcode_hash, quantize, quantize_strength, "key", scale, scale_mode, sysex_max_size, sysex_manufacturers)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 RETURNING
     *;
 
@@ -18,6 +18,8 @@ SELECT
     *
 FROM
     jam
+WHERE
+    visibility = 'public'
 ORDER BY
     "name"
 LIMIT $1 OFFSET $2;
@@ -26,7 +28,15 @@ LIMIT $1 OFFSET $2;
 UPDATE
     jam
 SET
-    bpm = $2
+    bpm = $2,
+    capacity = $3,
+    quantize = $4,
+    quantize_strength = $5,
+    "key" = $6,
+    scale = $7,
+    scale_mode = $8,
+    sysex_max_size = $9,
+    sysex_manufacturers = $10
 WHERE
     id = $1
 RETURNING
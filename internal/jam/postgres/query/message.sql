@@ -0,0 +1,16 @@
+-- name: CreateMessage :one
+INSERT INTO jam_message (jam_id, user_id, display_name, body)
+    VALUES ($1, $2, $3, $4)
+RETURNING
+    *;
+
+-- name: ListMessages :many
+SELECT
+    *
+FROM
+    jam_message
+WHERE
+    jam_id = $1
+ORDER BY
+    created_at DESC
+LIMIT $2 OFFSET $3;
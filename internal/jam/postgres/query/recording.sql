@@ -0,0 +1,69 @@
+-- name: CreateRecording :one
+INSERT INTO jam_recording (jam_id, bpm, started_at)
+    VALUES ($1, $2, $3)
+RETURNING
+    *;
+
+-- name: StopRecording :one
+UPDATE
+    jam_recording
+SET
+    stopped_at = $2
+WHERE
+    id = $1
+    AND stopped_at IS NULL
+RETURNING
+    *;
+
+-- name: DeleteRecording :exec
+DELETE FROM jam_recording
+WHERE id = $1;
+
+-- name: GetRecording :one
+SELECT
+    *
+FROM
+    jam_recording
+WHERE
+    id = $1
+LIMIT 1;
+
+-- name: ListRecordings :many
+SELECT
+    *
+FROM
+    jam_recording
+WHERE
+    jam_id = $1
+ORDER BY
+    started_at DESC;
+
+-- name: CreateRecordingEvent :exec
+INSERT INTO jam_recording_event (recording_id, user_id, user_name, state, number, velocity, bpm, recorded_at, channel, value)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+
+-- name: ListRecordingEvents :many
+SELECT
+    *
+FROM
+    jam_recording_event
+WHERE
+    recording_id = $1
+ORDER BY
+    recorded_at,
+    id;
+
+-- name: CreateRecordingMarker :exec
+INSERT INTO jam_recording_marker (recording_id, text, bpm, marked_at)
+    VALUES ($1, $2, $3, $4);
+
+-- name: ListRecordingMarkers :many
+SELECT
+    *
+FROM
+    jam_recording_marker
+WHERE
+    recording_id = $1
+ORDER BY
+    marked_at,
+    id;
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/jam"
+	"github.com/rapidmidiex/rmx/internal/jam/postgres/sqlc"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+type RecordingRepo interface {
+	// CreateRecording stores a recording started at r.StartedAt, by the
+	// same clock the messages of the recording are stamped with.
+	CreateRecording(ctx context.Context, r jam.Recording) (jam.Recording, error)
+	// StopRecording marks the end of a recording at the given time. It fails
+	// with sql.ErrNoRows if the recording was already stopped.
+	StopRecording(ctx context.Context, id uuid.UUID, at time.Time) (jam.Recording, error)
+	DeleteRecording(ctx context.Context, id uuid.UUID) error
+	GetRecordingByID(ctx context.Context, id uuid.UUID) (jam.Recording, error)
+	// GetRecordings lists the recordings of a jam, most recent first.
+	GetRecordings(ctx context.Context, jamID uuid.UUID) ([]jam.Recording, error)
+
+	AddRecordedMsg(ctx context.Context, recordingID uuid.UUID, m jam.RecordedMsg) error
+	// GetRecordedMsgs returns the messages of a recording in the order they were received.
+	GetRecordedMsgs(ctx context.Context, recordingID uuid.UUID) ([]jam.RecordedMsg, error)
+
+	AddMarker(ctx context.Context, recordingID uuid.UUID, m jam.Marker) error
+	// GetMarkers returns the markers of a recording in the order they were set.
+	GetMarkers(ctx context.Context, recordingID uuid.UUID) ([]jam.Marker, error)
+}
+
+type recordingStore struct {
+	q *sqlc.Queries
+}
+
+func NewRecordingRepo(conn sqlc.DBTX) RecordingRepo {
+	return &recordingStore{q: sqlc.New(conn)}
+}
+
+func (s *recordingStore) CreateRecording(ctx context.Context, r jam.Recording) (jam.Recording, error) {
+	created, err := s.q.CreateRecording(ctx, &sqlc.CreateRecordingParams{
+		JamID:     r.JamID,
+		Bpm:       int32(r.BPM),
+		StartedAt: r.StartedAt,
+	})
+
+	return toRecording(created), err
+}
+
+func (s *recordingStore) StopRecording(ctx context.Context, id uuid.UUID, at time.Time) (jam.Recording, error) {
+	stopped, err := s.q.StopRecording(ctx, &sqlc.StopRecordingParams{
+		ID:        id,
+		StoppedAt: sql.NullTime{Time: at, Valid: true},
+	})
+	return toRecording(stopped), err
+}
+
+func (s *recordingStore) DeleteRecording(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteRecording(ctx, id)
+}
+
+func (s *recordingStore) GetRecordingByID(ctx context.Context, id uuid.UUID) (jam.Recording, error) {
+	found, err := s.q.GetRecording(ctx, id)
+	if err != nil {
+		return jam.Recording{}, err
+	}
+
+	return toRecording(found), nil
+}
+
+func (s *recordingStore) GetRecordings(ctx context.Context, jamID uuid.UUID) ([]jam.Recording, error) {
+	res := make([]jam.Recording, 0)
+	rs, err := s.q.ListRecordings(ctx, jamID)
+	if err != nil {
+		return res, fmt.Errorf("listRecordings: %w", err)
+	}
+
+	for _, r := range rs {
+		res = append(res, toRecording(r))
+	}
+	return res, nil
+}
+
+func (s *recordingStore) AddRecordedMsg(ctx context.Context, recordingID uuid.UUID, m jam.RecordedMsg) error {
+	return s.q.CreateRecordingEvent(ctx, &sqlc.CreateRecordingEventParams{
+		RecordingID: recordingID,
+		UserID:      m.UserID,
+		UserName:    m.UserName,
+		State:       int16(m.State),
+		Number:      int16(m.Number),
+		Velocity:    int16(m.Velocity),
+		Bpm:         int32(m.BPM),
+		RecordedAt:  m.At,
+		Channel:     int16(m.Channel),
+		Value:       int32(m.Value),
+	})
+}
+
+func (s *recordingStore) GetRecordedMsgs(ctx context.Context, recordingID uuid.UUID) ([]jam.RecordedMsg, error) {
+	es, err := s.q.ListRecordingEvents(ctx, recordingID)
+	if err != nil {
+		return nil, fmt.Errorf("listRecordingEvents: %w", err)
+	}
+
+	res := make([]jam.RecordedMsg, len(es))
+	for i, e := range es {
+		res[i] = toRecordedMsg(e)
+	}
+	return res, nil
+}
+
+func (s *recordingStore) AddMarker(ctx context.Context, recordingID uuid.UUID, m jam.Marker) error {
+	return s.q.CreateRecordingMarker(ctx, &sqlc.CreateRecordingMarkerParams{
+		RecordingID: recordingID,
+		Text:        m.Text,
+		Bpm:         int32(m.BPM),
+		MarkedAt:    m.At,
+	})
+}
+
+func (s *recordingStore) GetMarkers(ctx context.Context, recordingID uuid.UUID) ([]jam.Marker, error) {
+	ms, err := s.q.ListRecordingMarkers(ctx, recordingID)
+	if err != nil {
+		return nil, fmt.Errorf("listRecordingMarkers: %w", err)
+	}
+
+	res := make([]jam.Marker, len(ms))
+	for i, m := range ms {
+		res[i] = jam.Marker{Text: m.Text, BPM: uint(m.Bpm), At: m.MarkedAt}
+	}
+	return res, nil
+}
+
+func toRecording(r sqlc.JamRecording) jam.Recording {
+	res := jam.Recording{
+		ID:        r.ID,
+		JamID:     r.JamID,
+		BPM:       uint(r.Bpm),
+		StartedAt: r.StartedAt,
+	}
+
+	if r.StoppedAt.Valid {
+		res.StoppedAt = &r.StoppedAt.Time
+	}
+
+	return res
+}
+
+func toRecordedMsg(e sqlc.JamRecordingEvent) jam.RecordedMsg {
+	return jam.RecordedMsg{
+		MIDIMsg: msg.MIDIMsg{
+			State:    msg.NoteState(e.State),
+			Number:   int(e.Number),
+			Velocity: int(e.Velocity),
+			Channel:  int(e.Channel),
+			Value:    int(e.Value),
+		},
+		UserID:   e.UserID,
+		UserName: e.UserName,
+		BPM:      uint(e.Bpm),
+		At:       e.RecordedAt,
+	}
+}
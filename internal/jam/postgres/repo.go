@@ -2,17 +2,41 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/hyphengolang/prelude/types/suid"
 	"github.com/rapidmidiex/rmx/internal/jam"
 	"github.com/rapidmidiex/rmx/internal/jam/postgres/sqlc"
+	"github.com/rapidmidiex/rmx/internal/msg"
 )
 
 type Repo interface {
 	CreateJam(context.Context, jam.Jam) (jam.Jam, error)
 	GetJams(context.Context) ([]jam.Jam, error)
 	GetJamByID(ctx context.Context, id uuid.UUID) (jam.Jam, error)
+	// UpdateJam updates the BPM and capacity of a jam.
+	UpdateJam(context.Context, jam.Jam) (jam.Jam, error)
+
+	BanUser(ctx context.Context, jamID, userID uuid.UUID) error
+	IsBanned(ctx context.Context, jamID, userID uuid.UUID) (bool, error)
+
+	CreateInvite(context.Context, jam.Invite) (jam.Invite, error)
+	// RedeemInvite uses the invite once. It reports false if the invite
+	// does not exist, has expired or has no uses left.
+	RedeemInvite(ctx context.Context, jamID, inviteID uuid.UUID) (bool, error)
+
+	CreateMessage(ctx context.Context, jamID uuid.UUID, m msg.ChatMsg) (msg.ChatMsg, error)
+	// ListMessages pages through the chat history of a jam, starting from the
+	// most recent message. Messages of a page are ordered oldest first.
+	ListMessages(ctx context.Context, jamID uuid.UUID, limit, offset int) ([]msg.ChatMsg, error)
+
+	CreateBackingTrack(context.Context, jam.BackingTrack) (jam.BackingTrack, error)
+	GetBackingTrackByID(ctx context.Context, id uuid.UUID) (jam.BackingTrack, error)
+	// GetBackingTracks lists the backing tracks of a jam without their data, most recent first.
+	GetBackingTracks(ctx context.Context, jamID uuid.UUID) ([]jam.BackingTrack, error)
 }
 
 type store struct {
@@ -23,6 +47,7 @@ func New(conn sqlc.DBTX) Repo {
 	return &store{q: sqlc.New(conn)}
 }
 
+// GetJams lists public jams.
 func (s *store) GetJams(ctx context.Context) ([]jam.Jam, error) {
 	res := make([]jam.Jam, 0)
 	jams, err := s.q.ListJams(ctx, &sqlc.ListJamsParams{
@@ -34,12 +59,7 @@ func (s *store) GetJams(ctx context.Context) ([]jam.Jam, error) {
 	}
 
 	for _, j := range jams {
-		res = append(res, jam.Jam{
-			ID:       j.ID,
-			Name:     j.Name,
-			BPM:      uint(j.Bpm),
-			Capacity: uint(j.Capacity),
-		})
+		res = append(res, toJam(j))
 	}
 	return res, nil
 }
@@ -50,25 +70,223 @@ func (s *store) GetJamByID(ctx context.Context, id uuid.UUID) (jam.Jam, error) {
 		return jam.Jam{}, err
 	}
 
-	return jam.Jam{
-		ID:       found.ID,
-		Name:     found.Name,
-		BPM:      uint(found.Bpm),
-		Capacity: uint(found.Capacity),
-	}, nil
+	return toJam(found), nil
 }
 
 func (s *store) CreateJam(ctx context.Context, j jam.Jam) (jam.Jam, error) {
+	var ownerID uuid.NullUUID
+	if j.Owner != nil {
+		ownerID = uuid.NullUUID{UUID: j.Owner.ID.UUID, Valid: true}
+	}
+
 	created, err := s.q.CreateJam(ctx, &sqlc.CreateJamParams{
-		Name:     j.Name,
-		Bpm:      int32(j.BPM),
-		Capacity: int32(j.Capacity),
+		Name:               j.Name,
+		Bpm:                int32(j.BPM),
+		Capacity:           int32(j.Capacity),
+		OwnerID:            ownerID,
+		Visibility:         string(j.Visibility),
+		PasscodeHash:       j.PasscodeHash,
+		Quantize:           string(j.Quantize),
+		QuantizeStrength:   int16(j.QuantizeStrength),
+		Key:                j.Key,
+		Scale:              string(j.Scale),
+		ScaleMode:          string(j.ScaleMode),
+		SysexMaxSize:       int32(j.SysExMaxSize),
+		SysexManufacturers: fromManufacturers(j.SysExManufacturers),
+	})
+
+	return toJam(created), err
+}
+
+func (s *store) UpdateJam(ctx context.Context, j jam.Jam) (jam.Jam, error) {
+	updated, err := s.q.UpdateJam(ctx, &sqlc.UpdateJamParams{
+		ID:                 j.ID,
+		Bpm:                int32(j.BPM),
+		Capacity:           int32(j.Capacity),
+		Quantize:           string(j.Quantize),
+		QuantizeStrength:   int16(j.QuantizeStrength),
+		Key:                j.Key,
+		Scale:              string(j.Scale),
+		ScaleMode:          string(j.ScaleMode),
+		SysexMaxSize:       int32(j.SysExMaxSize),
+		SysexManufacturers: fromManufacturers(j.SysExManufacturers),
+	})
+
+	return toJam(updated), err
+}
+
+func (s *store) BanUser(ctx context.Context, jamID, userID uuid.UUID) error {
+	return s.q.CreateBan(ctx, &sqlc.CreateBanParams{
+		JamID:  jamID,
+		UserID: userID,
 	})
+}
 
-	return jam.Jam{
-		ID:       created.ID,
-		Name:     created.Name,
-		BPM:      uint(created.Bpm),
-		Capacity: uint(created.Capacity),
-	}, err
+func (s *store) IsBanned(ctx context.Context, jamID, userID uuid.UUID) (bool, error) {
+	return s.q.IsBanned(ctx, &sqlc.IsBannedParams{
+		JamID:  jamID,
+		UserID: userID,
+	})
+}
+
+func (s *store) CreateInvite(ctx context.Context, i jam.Invite) (jam.Invite, error) {
+	created, err := s.q.CreateInvite(ctx, &sqlc.CreateInviteParams{
+		JamID:     i.JamID,
+		ExpiresAt: i.ExpiresAt,
+		MaxUses:   int32(i.MaxUses),
+	})
+
+	return toInvite(created), err
+}
+
+func (s *store) RedeemInvite(ctx context.Context, jamID, inviteID uuid.UUID) (bool, error) {
+	_, err := s.q.RedeemInvite(ctx, &sqlc.RedeemInviteParams{
+		ID:    inviteID,
+		JamID: jamID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *store) CreateMessage(ctx context.Context, jamID uuid.UUID, m msg.ChatMsg) (msg.ChatMsg, error) {
+	created, err := s.q.CreateMessage(ctx, &sqlc.CreateMessageParams{
+		JamID:       jamID,
+		UserID:      m.UserID,
+		DisplayName: m.DisplayName,
+		Body:        m.Body,
+	})
+
+	return toChatMsg(created), err
+}
+
+func (s *store) ListMessages(ctx context.Context, jamID uuid.UUID, limit, offset int) ([]msg.ChatMsg, error) {
+	ms, err := s.q.ListMessages(ctx, &sqlc.ListMessagesParams{
+		JamID:  jamID,
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listMessages: %w", err)
+	}
+
+	// newest first from the database
+	res := make([]msg.ChatMsg, len(ms))
+	for i, m := range ms {
+		res[len(ms)-1-i] = toChatMsg(m)
+	}
+	return res, nil
+}
+
+func (s *store) CreateBackingTrack(ctx context.Context, b jam.BackingTrack) (jam.BackingTrack, error) {
+	created, err := s.q.CreateBackingTrack(ctx, &sqlc.CreateBackingTrackParams{
+		JamID: b.JamID,
+		Name:  b.Name,
+		Data:  b.Data,
+	})
+
+	return toBackingTrack(created), err
+}
+
+func (s *store) GetBackingTrackByID(ctx context.Context, id uuid.UUID) (jam.BackingTrack, error) {
+	found, err := s.q.GetBackingTrack(ctx, id)
+	if err != nil {
+		return jam.BackingTrack{}, err
+	}
+
+	return toBackingTrack(found), nil
+}
+
+func (s *store) GetBackingTracks(ctx context.Context, jamID uuid.UUID) ([]jam.BackingTrack, error) {
+	res := make([]jam.BackingTrack, 0)
+	bs, err := s.q.ListBackingTracks(ctx, jamID)
+	if err != nil {
+		return res, fmt.Errorf("listBackingTracks: %w", err)
+	}
+
+	for _, b := range bs {
+		res = append(res, jam.BackingTrack{
+			ID:        b.ID,
+			JamID:     b.JamID,
+			Name:      b.Name,
+			CreatedAt: b.CreatedAt,
+		})
+	}
+	return res, nil
+}
+
+func toBackingTrack(b sqlc.JamBackingTrack) jam.BackingTrack {
+	return jam.BackingTrack{
+		ID:        b.ID,
+		JamID:     b.JamID,
+		Name:      b.Name,
+		Data:      b.Data,
+		CreatedAt: b.CreatedAt,
+	}
+}
+
+func toChatMsg(m sqlc.JamMessage) msg.ChatMsg {
+	return msg.ChatMsg{
+		ID:          m.ID,
+		UserID:      m.UserID,
+		DisplayName: m.DisplayName,
+		Body:        m.Body,
+		SentAt:      m.CreatedAt,
+	}
+}
+
+func toInvite(i sqlc.JamInvite) jam.Invite {
+	return jam.Invite{
+		ID:        i.ID,
+		JamID:     i.JamID,
+		ExpiresAt: i.ExpiresAt,
+		MaxUses:   uint(i.MaxUses),
+		Uses:      uint(i.Uses),
+	}
+}
+
+func toJam(j sqlc.Jam) jam.Jam {
+	res := jam.Jam{
+		ID:                 j.ID,
+		Name:               j.Name,
+		BPM:                uint(j.Bpm),
+		Capacity:           uint(j.Capacity),
+		Visibility:         jam.Visibility(j.Visibility),
+		PasscodeHash:       j.PasscodeHash,
+		Quantize:           jam.Quantize(j.Quantize),
+		QuantizeStrength:   uint(j.QuantizeStrength),
+		Key:                j.Key,
+		Scale:              jam.Scale(j.Scale),
+		ScaleMode:          jam.ScaleMode(j.ScaleMode),
+		SysExMaxSize:       uint(j.SysexMaxSize),
+		SysExManufacturers: toManufacturers(j.SysexManufacturers),
+	}
+
+	if j.OwnerID.Valid {
+		res.Owner = &jam.User{ID: suid.UUID{UUID: j.OwnerID.UUID}}
+	}
+
+	return res
+}
+
+// fromManufacturers never returns nil, the column is not nullable.
+func fromManufacturers(ids []msg.Manufacturer) []string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = string(id)
+	}
+	return s
+}
+
+func toManufacturers(s []string) []msg.Manufacturer {
+	if len(s) == 0 {
+		return nil
+	}
+	ids := make([]msg.Manufacturer, len(s))
+	for i, id := range s {
+		ids[i] = msg.Manufacturer(id)
+	}
+	return ids
 }
@@ -2,9 +2,12 @@ package postgres_test
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
+	"github.com/google/uuid"
 	db "github.com/rapidmidiex/rmx/internal/jam/postgres/sqlc"
 	"github.com/stretchr/testify/require"
 )
@@ -18,9 +21,15 @@ func TestCreateJam(t *testing.T) {
 		Capacity: 5,
 	}
 	arg := db.CreateJamParams{
-		Name:     want.Name,
-		Bpm:      want.Bpm,
-		Capacity: want.Capacity,
+		Name:               want.Name,
+		Bpm:                want.Bpm,
+		Capacity:           want.Capacity,
+		Visibility:         "public",
+		Quantize:           "off",
+		QuantizeStrength:   100,
+		ScaleMode:          "off",
+		SysexMaxSize:       4096,
+		SysexManufacturers: []string{},
 	}
 	got, err := testQueries.CreateJam(context.Background(), &arg)
 	require.NoError(t, err)
@@ -30,3 +39,148 @@ func TestCreateJam(t *testing.T) {
 	require.Equal(t, want.Bpm, got.Bpm)
 	require.Equal(t, want.Capacity, got.Capacity)
 }
+
+func TestBanUser(t *testing.T) {
+	ctx := context.Background()
+
+	created, err := testQueries.CreateJam(ctx, &db.CreateJamParams{
+		Name:               gofakeit.NounAbstract(),
+		Bpm:                120,
+		Capacity:           5,
+		Visibility:         "public",
+		Quantize:           "off",
+		QuantizeStrength:   100,
+		ScaleMode:          "off",
+		SysexMaxSize:       4096,
+		SysexManufacturers: []string{},
+	})
+	require.NoError(t, err)
+
+	userID := uuid.New()
+	arg := db.CreateBanParams{JamID: created.ID, UserID: userID}
+
+	err = testQueries.CreateBan(ctx, &arg)
+	require.NoError(t, err)
+
+	// banning twice is a no-op
+	err = testQueries.CreateBan(ctx, &arg)
+	require.NoError(t, err)
+
+	banned, err := testQueries.IsBanned(ctx, &db.IsBannedParams{JamID: created.ID, UserID: userID})
+	require.NoError(t, err)
+	require.True(t, banned)
+
+	banned, err = testQueries.IsBanned(ctx, &db.IsBannedParams{JamID: created.ID, UserID: uuid.New()})
+	require.NoError(t, err)
+	require.False(t, banned)
+}
+
+func TestRedeemInvite(t *testing.T) {
+	ctx := context.Background()
+
+	created, err := testQueries.CreateJam(ctx, &db.CreateJamParams{
+		Name:               gofakeit.NounAbstract(),
+		Bpm:                120,
+		Capacity:           5,
+		Visibility:         "private",
+		Quantize:           "off",
+		QuantizeStrength:   100,
+		ScaleMode:          "off",
+		SysexMaxSize:       4096,
+		SysexManufacturers: []string{},
+	})
+	require.NoError(t, err)
+
+	invite, err := testQueries.CreateInvite(ctx, &db.CreateInviteParams{
+		JamID:     created.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+		MaxUses:   1,
+	})
+	require.NoError(t, err)
+
+	arg := db.RedeemInviteParams{ID: invite.ID, JamID: created.ID}
+
+	redeemed, err := testQueries.RedeemInvite(ctx, &arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), redeemed.Uses)
+
+	_, err = testQueries.RedeemInvite(ctx, &arg)
+	require.ErrorIs(t, err, sql.ErrNoRows, "invite should have no uses left")
+}
+
+func TestListMessages(t *testing.T) {
+	ctx := context.Background()
+
+	created, err := testQueries.CreateJam(ctx, &db.CreateJamParams{
+		Name:               gofakeit.NounAbstract(),
+		Bpm:                120,
+		Capacity:           5,
+		Visibility:         "public",
+		Quantize:           "off",
+		QuantizeStrength:   100,
+		ScaleMode:          "off",
+		SysexMaxSize:       4096,
+		SysexManufacturers: []string{},
+	})
+	require.NoError(t, err)
+
+	userID := uuid.New()
+	for _, body := range []string{"first", "second", "third"} {
+		_, err := testQueries.CreateMessage(ctx, &db.CreateMessageParams{
+			JamID:       created.ID,
+			UserID:      userID,
+			DisplayName: gofakeit.Username(),
+			Body:        body,
+		})
+		require.NoError(t, err)
+	}
+
+	ms, err := testQueries.ListMessages(ctx, &db.ListMessagesParams{JamID: created.ID, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	require.Equal(t, "third", ms[0].Body, "newest messages come first")
+}
+
+func TestStopRecording(t *testing.T) {
+	ctx := context.Background()
+
+	created, err := testQueries.CreateJam(ctx, &db.CreateJamParams{
+		Name:               gofakeit.NounAbstract(),
+		Bpm:                120,
+		Capacity:           5,
+		Visibility:         "public",
+		Quantize:           "off",
+		QuantizeStrength:   100,
+		ScaleMode:          "off",
+		SysexMaxSize:       4096,
+		SysexManufacturers: []string{},
+	})
+	require.NoError(t, err)
+
+	recording, err := testQueries.CreateRecording(ctx, &db.CreateRecordingParams{JamID: created.ID, Bpm: created.Bpm, StartedAt: time.Now()})
+	require.NoError(t, err)
+	require.False(t, recording.StoppedAt.Valid)
+
+	err = testQueries.CreateRecordingEvent(ctx, &db.CreateRecordingEventParams{
+		RecordingID: recording.ID,
+		UserID:      uuid.New(),
+		UserName:    gofakeit.Username(),
+		State:       1,
+		Number:      60,
+		Velocity:    100,
+		Bpm:         created.Bpm,
+		RecordedAt:  time.Now(),
+	})
+	require.NoError(t, err)
+
+	stopped, err := testQueries.StopRecording(ctx, &db.StopRecordingParams{ID: recording.ID, StoppedAt: sql.NullTime{Time: time.Now(), Valid: true}})
+	require.NoError(t, err)
+	require.True(t, stopped.StoppedAt.Valid)
+
+	_, err = testQueries.StopRecording(ctx, &db.StopRecordingParams{ID: recording.ID, StoppedAt: sql.NullTime{Time: time.Now(), Valid: true}})
+	require.ErrorIs(t, err, sql.ErrNoRows, "recording was already stopped")
+
+	events, err := testQueries.ListRecordingEvents(ctx, recording.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+}
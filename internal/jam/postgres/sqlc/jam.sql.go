@@ -9,23 +9,48 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createJam = `-- name: CreateJam :one
-INSERT INTO jam (name, bpm, capacity)
-    VALUES ($1, $2, $3)
+INSERT INTO jam (name, bpm, capacity, owner_id, visibility, passcode_hash, quantize, quantize_strength, "key", scale, scale_mode, sysex_max_size, sysex_manufacturers)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 RETURNING
-    id, name, bpm, capacity, created_at
+    id, name, bpm, capacity, created_at, owner_id, visibility, passcode_hash, quantize, quantize_strength, key, scale, scale_mode, sysex_max_size, sysex_manufacturers
 `
 
 type CreateJamParams struct {
-	Name     string `json:"name"`
-	Bpm      int32  `json:"bpm"`
-	Capacity int32  `json:"capacity"`
+	Name               string        `json:"name"`
+	Bpm                int32         `json:"bpm"`
+	Capacity           int32         `json:"capacity"`
+	OwnerID            uuid.NullUUID `json:"ownerId"`
+	Visibility         string        `json:"visibility"`
+	PasscodeHash       []byte        `json:"passcodeHash"`
+	Quantize           string        `json:"quantize"`
+	QuantizeStrength   int16         `json:"quantizeStrength"`
+	Key                string        `json:"key"`
+	Scale              string        `json:"scale"`
+	ScaleMode          string        `json:"scaleMode"`
+	SysexMaxSize       int32         `json:"sysexMaxSize"`
+	SysexManufacturers []string      `json:"sysexManufacturers"`
 }
 
 func (q *Queries) CreateJam(ctx context.Context, arg *CreateJamParams) (Jam, error) {
-	row := q.db.QueryRowContext(ctx, createJam, arg.Name, arg.Bpm, arg.Capacity)
+	row := q.db.QueryRowContext(ctx, createJam,
+		arg.Name,
+		arg.Bpm,
+		arg.Capacity,
+		arg.OwnerID,
+		arg.Visibility,
+		arg.PasscodeHash,
+		arg.Quantize,
+		arg.QuantizeStrength,
+		arg.Key,
+		arg.Scale,
+		arg.ScaleMode,
+		arg.SysexMaxSize,
+		pq.Array(arg.SysexManufacturers),
+	)
 	var i Jam
 	err := row.Scan(
 		&i.ID,
@@ -33,6 +58,16 @@ func (q *Queries) CreateJam(ctx context.Context, arg *CreateJamParams) (Jam, err
 		&i.Bpm,
 		&i.Capacity,
 		&i.CreatedAt,
+		&i.OwnerID,
+		&i.Visibility,
+		&i.PasscodeHash,
+		&i.Quantize,
+		&i.QuantizeStrength,
+		&i.Key,
+		&i.Scale,
+		&i.ScaleMode,
+		&i.SysexMaxSize,
+		pq.Array(&i.SysexManufacturers),
 	)
 	return i, err
 }
@@ -49,7 +84,7 @@ func (q *Queries) DeleteJam(ctx context.Context, id uuid.UUID) error {
 
 const getJam = `-- name: GetJam :one
 SELECT
-    id, name, bpm, capacity, created_at
+    id, name, bpm, capacity, created_at, owner_id, visibility, passcode_hash, quantize, quantize_strength, key, scale, scale_mode, sysex_max_size, sysex_manufacturers
 FROM
     jam
 WHERE
@@ -66,15 +101,27 @@ func (q *Queries) GetJam(ctx context.Context, id uuid.UUID) (Jam, error) {
 		&i.Bpm,
 		&i.Capacity,
 		&i.CreatedAt,
+		&i.OwnerID,
+		&i.Visibility,
+		&i.PasscodeHash,
+		&i.Quantize,
+		&i.QuantizeStrength,
+		&i.Key,
+		&i.Scale,
+		&i.ScaleMode,
+		&i.SysexMaxSize,
+		pq.Array(&i.SysexManufacturers),
 	)
 	return i, err
 }
 
 const listJams = `-- name: ListJams :many
 SELECT
-    id, name, bpm, capacity, created_at
+    id, name, bpm, capacity, created_at, owner_id, visibility, passcode_hash, quantize, quantize_strength, key, scale, scale_mode, sysex_max_size, sysex_manufacturers
 FROM
     jam
+WHERE
+    visibility = 'public'
 ORDER BY
     "name"
 LIMIT $1 OFFSET $2
@@ -100,6 +147,16 @@ func (q *Queries) ListJams(ctx context.Context, arg *ListJamsParams) ([]Jam, err
 			&i.Bpm,
 			&i.Capacity,
 			&i.CreatedAt,
+			&i.OwnerID,
+			&i.Visibility,
+			&i.PasscodeHash,
+			&i.Quantize,
+			&i.QuantizeStrength,
+			&i.Key,
+			&i.Scale,
+			&i.ScaleMode,
+			&i.SysexMaxSize,
+			pq.Array(&i.SysexManufacturers),
 		); err != nil {
 			return nil, err
 		}
@@ -118,20 +175,47 @@ const updateJam = `-- name: UpdateJam :one
 UPDATE
     jam
 SET
-    bpm = $2
+    bpm = $2,
+    capacity = $3,
+    quantize = $4,
+    quantize_strength = $5,
+    "key" = $6,
+    scale = $7,
+    scale_mode = $8,
+    sysex_max_size = $9,
+    sysex_manufacturers = $10
 WHERE
     id = $1
 RETURNING
-    id, name, bpm, capacity, created_at
+    id, name, bpm, capacity, created_at, owner_id, visibility, passcode_hash, quantize, quantize_strength, key, scale, scale_mode, sysex_max_size, sysex_manufacturers
 `
 
 type UpdateJamParams struct {
-	ID  uuid.UUID `json:"id"`
-	Bpm int32     `json:"bpm"`
+	ID                 uuid.UUID `json:"id"`
+	Bpm                int32     `json:"bpm"`
+	Capacity           int32     `json:"capacity"`
+	Quantize           string    `json:"quantize"`
+	QuantizeStrength   int16     `json:"quantizeStrength"`
+	Key                string    `json:"key"`
+	Scale              string    `json:"scale"`
+	ScaleMode          string    `json:"scaleMode"`
+	SysexMaxSize       int32     `json:"sysexMaxSize"`
+	SysexManufacturers []string  `json:"sysexManufacturers"`
 }
 
 func (q *Queries) UpdateJam(ctx context.Context, arg *UpdateJamParams) (Jam, error) {
-	row := q.db.QueryRowContext(ctx, updateJam, arg.ID, arg.Bpm)
+	row := q.db.QueryRowContext(ctx, updateJam,
+		arg.ID,
+		arg.Bpm,
+		arg.Capacity,
+		arg.Quantize,
+		arg.QuantizeStrength,
+		arg.Key,
+		arg.Scale,
+		arg.ScaleMode,
+		arg.SysexMaxSize,
+		pq.Array(arg.SysexManufacturers),
+	)
 	var i Jam
 	err := row.Scan(
 		&i.ID,
@@ -139,6 +223,16 @@ func (q *Queries) UpdateJam(ctx context.Context, arg *UpdateJamParams) (Jam, err
 		&i.Bpm,
 		&i.Capacity,
 		&i.CreatedAt,
+		&i.OwnerID,
+		&i.Visibility,
+		&i.PasscodeHash,
+		&i.Quantize,
+		&i.QuantizeStrength,
+		&i.Key,
+		&i.Scale,
+		&i.ScaleMode,
+		&i.SysexMaxSize,
+		pq.Array(&i.SysexManufacturers),
 	)
 	return i, err
 }
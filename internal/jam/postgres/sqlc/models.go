@@ -5,19 +5,92 @@
 package sqlc
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Jam struct {
+	ID                 uuid.UUID     `json:"id"`
+	Name               string        `json:"name"`
+	Bpm                int32         `json:"bpm"`
+	Capacity           int32         `json:"capacity"`
+	CreatedAt          time.Time     `json:"createdAt"`
+	OwnerID            uuid.NullUUID `json:"ownerId"`
+	Visibility         string        `json:"visibility"`
+	PasscodeHash       []byte        `json:"passcodeHash"`
+	Quantize           string        `json:"quantize"`
+	QuantizeStrength   int16         `json:"quantizeStrength"`
+	Key                string        `json:"key"`
+	Scale              string        `json:"scale"`
+	ScaleMode          string        `json:"scaleMode"`
+	SysexMaxSize       int32         `json:"sysexMaxSize"`
+	SysexManufacturers []string      `json:"sysexManufacturers"`
+}
+
+type JamBackingTrack struct {
 	ID        uuid.UUID `json:"id"`
+	JamID     uuid.UUID `json:"jamId"`
 	Name      string    `json:"name"`
-	Bpm       int32     `json:"bpm"`
-	Capacity  int32     `json:"capacity"`
+	Data      []byte    `json:"data"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type JamBan struct {
+	JamID     uuid.UUID `json:"jamId"`
+	UserID    uuid.UUID `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type JamInvite struct {
+	ID        uuid.UUID `json:"id"`
+	JamID     uuid.UUID `json:"jamId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	MaxUses   int32     `json:"maxUses"`
+	Uses      int32     `json:"uses"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+type JamMessage struct {
+	ID          uuid.UUID `json:"id"`
+	JamID       uuid.UUID `json:"jamId"`
+	UserID      uuid.UUID `json:"userId"`
+	DisplayName string    `json:"displayName"`
+	Body        string    `json:"body"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type JamRecording struct {
+	ID        uuid.UUID    `json:"id"`
+	JamID     uuid.UUID    `json:"jamId"`
+	Bpm       int32        `json:"bpm"`
+	StartedAt time.Time    `json:"startedAt"`
+	StoppedAt sql.NullTime `json:"stoppedAt"`
+}
+
+type JamRecordingEvent struct {
+	ID          int64     `json:"id"`
+	RecordingID uuid.UUID `json:"recordingId"`
+	UserID      uuid.UUID `json:"userId"`
+	UserName    string    `json:"userName"`
+	State       int16     `json:"state"`
+	Number      int16     `json:"number"`
+	Velocity    int16     `json:"velocity"`
+	Bpm         int32     `json:"bpm"`
+	RecordedAt  time.Time `json:"recordedAt"`
+	Channel     int16     `json:"channel"`
+	Value       int32     `json:"value"`
+}
+
+type JamRecordingMarker struct {
+	ID          int64     `json:"id"`
+	RecordingID uuid.UUID `json:"recordingId"`
+	Text        string    `json:"text"`
+	Bpm         int32     `json:"bpm"`
+	MarkedAt    time.Time `json:"markedAt"`
+}
+
 type User struct {
 	ID        uuid.UUID   `json:"id"`
 	Username  string      `json:"username"`
@@ -0,0 +1,122 @@
+package jam
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+const defaultQuantizeStrength = 100
+
+var ErrInvalidQuantize = errors.New("quantize must be one of: off, 1/8, 1/16, 1/8t, 1/16t, with a strength between 1 and 100")
+
+// Quantize is the grid of the transport the notes played in a jam are snapped to.
+type Quantize string
+
+const (
+	// QuantizeOff leaves notes where they were played.
+	QuantizeOff Quantize = "off"
+	// Quantize8th snaps notes to eighth notes.
+	Quantize8th Quantize = "1/8"
+	// Quantize16th snaps notes to sixteenth notes.
+	Quantize16th Quantize = "1/16"
+	// Quantize8thTriplet snaps notes to eighth note triplets.
+	Quantize8thTriplet Quantize = "1/8t"
+	// Quantize16thTriplet snaps notes to sixteenth note triplets.
+	Quantize16thTriplet Quantize = "1/16t"
+)
+
+func (q Quantize) Valid() bool {
+	return q == QuantizeOff || q.step() > 0
+}
+
+// step returns the length of a step of the grid in beats, 0 if notes are not snapped.
+func (q Quantize) step() float64 {
+	switch q {
+	case Quantize8th:
+		return 1.0 / 2
+	case Quantize16th:
+		return 1.0 / 4
+	case Quantize8thTriplet:
+		return 1.0 / 3
+	case Quantize16thTriplet:
+		return 1.0 / 6
+	}
+	return 0
+}
+
+// ValidQuantize reports whether q and strength make a valid quantization.
+func ValidQuantize(q Quantize, strength uint) bool {
+	return q.Valid() && strength >= 1 && strength <= 100
+}
+
+// SetQuantize changes the quantization of a live jam. Strength is the
+// percentage of the distance to the grid notes are moved by.
+func (j *Jam) SetQuantize(q Quantize, strength uint) {
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+	j.Quantize, j.QuantizeStrength = q, strength
+}
+
+// quantize returns where a note played at the given beat of the transport
+// is placed on the grid of the jam.
+// It must be called with the lock held.
+func (j *Jam) quantize(beat float64) float64 {
+	step := j.Quantize.step()
+	if step == 0 {
+		return beat
+	}
+
+	target := math.Round(beat/step) * step
+	return beat + (target-beat)*float64(j.QuantizeStrength)/100
+}
+
+// delay returns how long to hold a message back for, given how far its
+// note was moved by quantization. Notes are only ever delayed, a note snapped
+// to an earlier beat is relayed right away. A note is turned off as late as it
+// was turned on so that it keeps its length, and expression is held back
+// as long as the notes of its channel.
+func (r *room) delay(from uuid.UUID, m msg.MIDIMsg, shift time.Duration) time.Duration {
+	r.delayMu.Lock()
+	defer r.delayMu.Unlock()
+
+	if !m.IsNote() {
+		for n, d := range r.delayed {
+			if n.userID == from && n.channel == m.Channel && d > shift {
+				shift = d
+			}
+		}
+		return shift
+	}
+
+	n := participantNote{from, m.Channel, m.Number}
+	if m.State == msg.NOTE_ON && m.Velocity > 0 {
+		if shift <= 0 {
+			delete(r.delayed, n)
+			return 0
+		}
+		r.delayed[n] = shift
+		return shift
+	}
+
+	shift = r.delayed[n]
+	delete(r.delayed, n)
+	return shift
+}
+
+// forgetDelays drops the notes held by a participant who left the jam.
+func (r *room) forgetDelays(from uuid.UUID) {
+	r.delayMu.Lock()
+	defer r.delayMu.Unlock()
+
+	for n := range r.delayed {
+		if n.userID == from {
+			delete(r.delayed, n)
+		}
+	}
+}
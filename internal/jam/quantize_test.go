@@ -0,0 +1,80 @@
+package jam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantize(t *testing.T) {
+	for _, tc := range []struct {
+		q        Quantize
+		strength uint
+		beat     float64
+		want     float64
+	}{
+		{QuantizeOff, 100, 1.3, 1.3},
+		{Quantize8th, 100, 1.3, 1.5},
+		{Quantize8th, 100, 1.2, 1},
+		{Quantize8th, 100, 1.5, 1.5},
+		{Quantize8th, 50, 1.3, 1.4},
+		{Quantize16th, 100, 1.1, 1},
+		{Quantize16th, 100, 1.2, 1.25},
+		{Quantize8thTriplet, 100, 1.3, 4.0 / 3},
+		{Quantize16thTriplet, 100, 0.1, 1.0 / 6},
+	} {
+		j := &Jam{Quantize: tc.q, QuantizeStrength: tc.strength}
+		require.InDelta(t, tc.want, j.quantize(tc.beat), 1e-9, "%s %d%% at %v", tc.q, tc.strength, tc.beat)
+	}
+}
+
+func TestQuantizeTime(t *testing.T) {
+	// a beat every 100ms, an eighth note every 50ms
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := transport{at: start, bpm: 600}
+	j := &Jam{Quantize: Quantize8th, QuantizeStrength: 100}
+
+	for _, tc := range []struct{ played, want time.Duration }{
+		{0, 0},
+		{130 * time.Millisecond, 150 * time.Millisecond},
+		{170 * time.Millisecond, 150 * time.Millisecond},
+		{1010 * time.Millisecond, 1000 * time.Millisecond},
+		{1040 * time.Millisecond, 1050 * time.Millisecond},
+	} {
+		at := tr.timeAt(j.quantize(tr.beatAt(start.Add(tc.played))))
+		require.WithinDuration(t, start.Add(tc.want), at, time.Microsecond, "played at %v", tc.played)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	r := newRoom()
+	alice, bob := uuid.New(), uuid.New()
+	on := msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100}
+	off := msg.MIDIMsg{State: msg.NOTE_OFF, Number: 60}
+	bend := msg.MIDIMsg{State: msg.PITCH_BEND}
+
+	require.Equal(t, 20*time.Millisecond, r.delay(alice, on, 20*time.Millisecond))
+	require.Equal(t, 20*time.Millisecond, r.delay(alice, bend, 0), "expression is held back with the notes of its channel")
+	require.Equal(t, time.Duration(0), r.delay(bob, bend, 0), "other participants are not held back")
+	require.Equal(t, 20*time.Millisecond, r.delay(alice, off, 0), "notes are turned off as late as they were turned on")
+	require.Equal(t, time.Duration(0), r.delay(alice, off, 0))
+
+	require.Equal(t, time.Duration(0), r.delay(alice, on, -20*time.Millisecond), "notes snapped earlier are relayed right away")
+	require.Equal(t, time.Duration(0), r.delay(alice, off, 0))
+}
+
+func TestForgetDelays(t *testing.T) {
+	r := newRoom()
+	alice, bob := uuid.New(), uuid.New()
+	on := msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100}
+
+	r.delay(alice, on, 20*time.Millisecond)
+	r.delay(bob, on, 20*time.Millisecond)
+	r.forgetDelays(alice)
+
+	require.Len(t, r.delayed, 1)
+	require.Contains(t, r.delayed, participantNote{bob, 0, 60})
+}
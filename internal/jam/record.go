@@ -0,0 +1,192 @@
+package jam
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+var (
+	ErrRecording    = errors.New("jam is already being recorded")
+	ErrNotRecording = errors.New("jam is not being recorded")
+	ErrInvalidMIDI  = errors.New("invalid MIDI message")
+)
+
+// Recording is a take of a jam session.
+type Recording struct {
+	ID    uuid.UUID `json:"id"`
+	JamID uuid.UUID `json:"jamId"`
+	// Tempo of the jam when the recording started.
+	BPM       uint       `json:"bpm"`
+	StartedAt time.Time  `json:"startedAt"`
+	StoppedAt *time.Time `json:"stoppedAt,omitempty"`
+}
+
+// RecordedMsg is a MIDI message captured while a jam was being recorded.
+type RecordedMsg struct {
+	msg.MIDIMsg
+	UserID   uuid.UUID `json:"userId"`
+	UserName string    `json:"userName"`
+	// Tempo of the jam when the message was received.
+	BPM uint `json:"bpm"`
+	// Server time the message was received.
+	At time.Time `json:"at"`
+}
+
+// Marker labels a point of a recording, such as a change of chord.
+type Marker struct {
+	Text string `json:"text"`
+	// Tempo of the jam when the marker was set.
+	BPM uint `json:"bpm"`
+	// Server time the marker was set.
+	At time.Time `json:"at"`
+}
+
+// Recorder stores the MIDI messages of a jam being recorded.
+type Recorder interface {
+	// Record is called from the connection of the sender for every MIDI
+	// message relayed to the jam, with the jam locked: it must not block.
+	Record(RecordedMsg)
+	// Mark is called as the jam is analyzed, with the jam locked: it must
+	// not block.
+	Mark(Marker)
+	// Close is called once the recording has stopped and must return
+	// after every message has been stored.
+	Close() error
+}
+
+// StartRecording captures every MIDI message relayed to the jam into r
+// until StopRecording is called. id identifies the recording.
+func (j *Jam) StartRecording(id uuid.UUID, r Recorder) error {
+	j.Client()
+
+	j.room.mu.Lock()
+	if j.room.recorder != nil {
+		j.room.mu.Unlock()
+		return ErrRecording
+	}
+	j.room.recording, j.room.recorder = id, r
+	j.room.mu.Unlock()
+
+	return j.Broadcast(msg.RECORD, msg.RecordMsg{RecordingID: id, Recording: true})
+}
+
+// StopRecording stops the current recording and returns its id once its
+// Recorder has been closed.
+func (j *Jam) StopRecording() (uuid.UUID, error) {
+	j.Client()
+
+	j.room.mu.Lock()
+	id, r := j.room.recording, j.room.recorder
+	j.room.recording, j.room.recorder = uuid.Nil, nil
+	j.room.mu.Unlock()
+
+	if r == nil {
+		return uuid.Nil, ErrNotRecording
+	}
+
+	// no message can be recorded past this point
+	if err := r.Close(); err != nil {
+		return id, err
+	}
+
+	return id, j.Broadcast(msg.RECORD, msg.RecordMsg{RecordingID: id})
+}
+
+// Recording returns the id of the current recording, if any.
+func (j *Jam) Recording() (uuid.UUID, bool) {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.recording, j.room.recorder != nil
+}
+
+func (j *Jam) handleMIDI(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	var m msg.MIDIMsg
+	if err := e.Unwrap(&m); err != nil {
+		return nil, err
+	}
+
+	if !m.Valid() {
+		return nil, ErrInvalidMIDI
+	}
+
+	now := time.Now()
+
+	j.room.mu.RLock()
+	played := m
+	// the assigned channel, or the channel of their MPE zone, is stamped on
+	// every message of the participant
+	ch, err := j.room.channel(from, m.Channel)
+	if err != nil {
+		j.room.mu.RUnlock()
+		return nil, err
+	}
+	m.Channel = ch
+
+	m, ok := j.fitScale(from, m)
+	if !ok {
+		j.room.mu.RUnlock()
+		return nil, ErrOutOfScale
+	}
+
+	if m != played {
+		if err := e.SetPayload(m); err != nil {
+			j.room.mu.RUnlock()
+			return nil, err
+		}
+	}
+
+	at := now
+	if m.State == msg.NOTE_ON {
+		t := j.room.transport
+		at = t.timeAt(j.quantize(t.beatAt(now)))
+	}
+	j.room.mu.RUnlock()
+
+	if d := j.room.delay(from, m, at.Sub(now)); d > 0 {
+		time.AfterFunc(d, func() {
+			c := j.relayMIDI(from, m, now.Add(d))
+			j.broadcastEnvelope(e)
+			j.announce(c)
+		})
+		return nil, nil
+	}
+
+	return j.relayAnnounced(e, j.relayMIDI(from, m, at))
+}
+
+// relayMIDI records, loops and analyzes a message of a participant relayed
+// to the jam, as if it was played at the given time. It returns the chord
+// of the jam if it changed, see analyze.
+func (j *Jam) relayMIDI(from uuid.UUID, m msg.MIDIMsg, at time.Time) *msg.ChordMsg {
+	j.room.mu.RLock()
+	j.record(from, m, at)
+	beat := j.room.transport.beatAt(at)
+	l := j.room.looper
+	j.room.mu.RUnlock()
+
+	// the looper locks the room itself
+	if l != nil {
+		l.captureMIDI(from, m, beat)
+	}
+
+	return j.analyze(from, m, at)
+}
+
+// record captures a message relayed to the jam if it is being recorded.
+// It must be called with the lock held.
+func (j *Jam) record(from uuid.UUID, m msg.MIDIMsg, at time.Time) {
+	if j.room.recorder == nil {
+		return
+	}
+
+	rm := RecordedMsg{MIDIMsg: m, UserID: from, BPM: j.BPM, At: at}
+	if u, ok := j.room.users[from]; ok {
+		rm.UserName = u.Username
+	}
+	j.room.recorder.Record(rm)
+}
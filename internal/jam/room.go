@@ -0,0 +1,465 @@
+package jam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+// HistorySize is the number of chat messages sent to participants joining a jam.
+const HistorySize = 50
+
+var (
+	ErrNotHost = errors.New("only the jam host can do this")
+)
+
+// HandlerFunc handles an envelope sent to a jam by the participant from.
+// The returned envelope is relayed to the room, a nil envelope is dropped.
+// If an error is returned, it is sent back to the participant.
+type HandlerFunc func(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error)
+
+// room holds the live state of a jam session.
+type room struct {
+	once sync.Once
+
+	mu       sync.RWMutex
+	handlers map[msg.MsgType]HandlerFunc
+	muted    map[uuid.UUID]msg.MuteMsg
+	// MIDI channel and instrument of participants, by participant
+	assignments map[uuid.UUID]msg.AssignMsg
+	// MPE zones of participants, by participant
+	zones map[uuid.UUID]msg.MPEMsg
+	// everyone in the jam, forgotten when they leave
+	users map[uuid.UUID]*User
+	// most recent chat messages, oldest first
+	history []msg.ChatMsg
+
+	// current recording, recorder is nil when the jam is not being recorded
+	recording uuid.UUID
+	recorder  Recorder
+
+	// shared clock of the jam
+	transport transport
+
+	// current playback of a recording and of a backing track, if any
+	player  *Player
+	backing *Player
+
+	// looper of the jam, nil until a loop is armed
+	looper *Looper
+	// step sequencer of the jam, if any
+	sequencer *StepSequencer
+
+	// how long the notes held by participants were delayed by quantization
+	delayMu sync.Mutex
+	delayed map[participantNote]time.Duration
+
+	// pitches the notes held by participants were snapped to, by the note
+	// they played
+	snapMu  sync.Mutex
+	snapped map[participantNote]int
+
+	// when the jam went live
+	live time.Time
+	// short IDs of the participants in binary frames
+	shortIDs    map[uuid.UUID]uint16
+	lastShortID uint16
+
+	// notes sounding across the jam and the chord they make
+	harmonyMu sync.Mutex
+	sounding  map[participantNote]bool
+	chord     msg.ChordMsg
+
+	// SysEx sent by participants, against sysExRate
+	sysExMu sync.Mutex
+	sysEx   map[uuid.UUID]*leakyBucket
+}
+
+// participantNote is a note held by a participant of the jam.
+type participantNote struct {
+	userID          uuid.UUID
+	channel, number int
+}
+
+func newRoom() *room {
+	r := &room{
+		handlers:    make(map[msg.MsgType]HandlerFunc),
+		muted:       make(map[uuid.UUID]msg.MuteMsg),
+		assignments: make(map[uuid.UUID]msg.AssignMsg),
+		zones:       make(map[uuid.UUID]msg.MPEMsg),
+		delayed:     make(map[participantNote]time.Duration),
+		snapped:     make(map[participantNote]int),
+		sounding:    make(map[participantNote]bool),
+		shortIDs:    make(map[uuid.UUID]uint16),
+		users:       make(map[uuid.UUID]*User),
+		sysEx:       make(map[uuid.UUID]*leakyBucket),
+	}
+	return r
+}
+
+// AddUser records a participant about to join the jam.
+func (j *Jam) AddUser(u *User) {
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+	j.room.users[u.ID.UUID] = u
+}
+
+// User returns a participant in the jam.
+func (j *Jam) User(id uuid.UUID) (*User, bool) {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	u, ok := j.room.users[id]
+	return u, ok
+}
+
+// SetHistory replaces the chat history sent to joining participants.
+// Only the last HistorySize messages are kept.
+func (j *Jam) SetHistory(ms []msg.ChatMsg) {
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+	j.room.history = nil
+	for _, m := range ms {
+		j.room.remember(m)
+	}
+}
+
+// Remember adds a chat message to the history sent to joining participants.
+func (j *Jam) Remember(m msg.ChatMsg) {
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+	j.room.remember(m)
+}
+
+// remember must be called with the lock held.
+func (r *room) remember(m msg.ChatMsg) {
+	r.history = append(r.history, m)
+	if n := len(r.history); n > HistorySize {
+		r.history = append(r.history[:0:0], r.history[n-HistorySize:]...)
+	}
+}
+
+// Handle registers the handler for the given message type, replacing any
+// previous one. Messages without a handler are relayed as is.
+func (j *Jam) Handle(typ msg.MsgType, h HandlerFunc) {
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+	j.room.handlers[typ] = h
+}
+
+func (j *Jam) handler(typ msg.MsgType) (HandlerFunc, bool) {
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+
+	if h, ok := j.room.handlers[typ]; ok {
+		return h, true
+	}
+
+	switch typ {
+	case msg.KICK:
+		return j.handleKick, true
+	case msg.MUTE:
+		return j.handleMute, true
+	case msg.MIDI:
+		return j.handleMIDI, true
+	case msg.UMP:
+		return j.handleUMP, true
+	case msg.LOOP:
+		return j.handleLoop, true
+	case msg.STEP:
+		return j.handleStep, true
+	case msg.ASSIGN:
+		return j.handleAssign, true
+	case msg.MPE:
+		return j.handleMPE, true
+	case msg.SYSEX:
+		return j.handleSysEx, true
+	}
+
+	return nil, false
+}
+
+func (j *Jam) handleMessage(from uuid.UUID, m *wsutil.Message) (*wsutil.Message, error) {
+	var e msg.Envelope
+	if m.OpCode == ws.OpBinary {
+		var err error
+		if e, err = unframe(from, m.Payload); err != nil {
+			j.SendError(from, err)
+			return nil, fmt.Errorf("unframe: %w", err)
+		}
+	} else if err := json.Unmarshal(m.Payload, &e); err != nil {
+		return nil, fmt.Errorf("unmarshal envelope: %w", err)
+	}
+
+	// the server is the source of truth for who sent a message
+	e.UserID = from
+
+	if j.isMuted(from, e.Typ) {
+		return nil, nil
+	}
+
+	out := &e
+	if h, ok := j.handler(e.Typ); ok {
+		var err error
+		if out, err = h(from, &e); err != nil {
+			j.SendError(from, err)
+			return nil, err
+		}
+	}
+
+	if out == nil {
+		return nil, nil
+	}
+
+	p, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("marshal envelope: %w", err)
+	}
+
+	// relayed as JSON, connections using binary frames encode it themselves
+	return &wsutil.Message{OpCode: ws.OpText, Payload: p}, nil
+}
+
+// handleJoin greets a new participant with a snapshot of the jam.
+func (j *Jam) handleJoin(id uuid.UUID) *wsutil.Message {
+	sid := j.shortID(id)
+
+	j.room.mu.RLock()
+	c := msg.ConnectMsg{
+		UserID:    id,
+		ShortID:   sid,
+		History:   append([]msg.ChatMsg(nil), j.room.history...),
+		Recording: j.room.recorder != nil,
+	}
+	if len(j.room.assignments) > 0 {
+		c.Assignments = j.room.assigned()
+	}
+	if len(j.room.zones) > 0 {
+		c.Zones = j.room.zoned()
+	}
+	if j.Key != "" {
+		s := j.scaleMsg()
+		c.Scale = &s
+	}
+	if u, ok := j.room.users[id]; ok {
+		c.UserName = u.Username
+	}
+	p, b, l, s := j.room.player, j.room.backing, j.room.looper, j.room.sequencer
+	j.room.mu.RUnlock()
+
+	if chord := j.Chord(); chord.Name != "" {
+		c.Chord = &chord
+	}
+
+	// players, the looper and the step sequencer lock the room themselves
+	if p != nil {
+		status := p.Status()
+		c.Playback = &status
+	}
+	if b != nil {
+		status := b.Status()
+		c.Backing = &status
+	}
+	if l != nil {
+		status := l.Status()
+		c.Looper = &status
+	}
+	if s != nil {
+		status := s.Status()
+		c.Sequencer = &status
+	}
+
+	m, err := wrap(msg.CONNECT, id, c)
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// handleLeave forgets a participant once their last connection is gone.
+func (j *Jam) handleLeave(id uuid.UUID) {
+	// they may have come back in the meantime
+	if j.Client().Connected(id) {
+		return
+	}
+	j.Leave(id)
+}
+
+// Leave forgets what a participant left behind in the jam, and tells the jam
+// about it. Participants connected over websockets leave with their last
+// connection, others such as OSC controllers are made to leave by their bridge.
+func (j *Jam) Leave(id uuid.UUID) {
+	j.unassign(id)
+	j.unzone(id)
+	j.silence(id)
+	j.room.forgetSysEx(id)
+	j.room.forgetDelays(id)
+	j.room.forgetSnaps(id)
+
+	j.room.mu.Lock()
+	delete(j.room.users, id)
+	j.room.mu.Unlock()
+}
+
+func (j *Jam) handleQueue(id uuid.UUID, position int) *wsutil.Message {
+	m, err := wrap(msg.WAITLIST, id, msg.WaitlistMsg{Position: position})
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// wrap returns the text message for a new envelope sent by the server.
+func wrap(typ msg.MsgType, userID uuid.UUID, payload any) (*wsutil.Message, error) {
+	e := msg.Envelope{ID: uuid.New(), Typ: typ, UserID: userID}
+	if err := e.SetPayload(payload); err != nil {
+		return nil, err
+	}
+
+	p, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("marshal envelope: %w", err)
+	}
+
+	return &wsutil.Message{OpCode: ws.OpText, Payload: p}, nil
+}
+
+// Send sends an envelope to a single participant.
+func (j *Jam) Send(to uuid.UUID, e *msg.Envelope) error {
+	p, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+
+	j.Client().Send(to, &wsutil.Message{OpCode: ws.OpText, Payload: p})
+	return nil
+}
+
+// Broadcast sends a new envelope from the server to the whole jam.
+func (j *Jam) Broadcast(typ msg.MsgType, payload any) error {
+	m, err := wrap(typ, uuid.Nil, payload)
+	if err != nil {
+		return err
+	}
+
+	j.Client().Broadcast(m)
+	return nil
+}
+
+// broadcastEnvelope sends an envelope to the whole jam as is.
+func (j *Jam) broadcastEnvelope(e *msg.Envelope) error {
+	p, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+
+	j.Client().Broadcast(&wsutil.Message{OpCode: ws.OpText, Payload: p})
+	return nil
+}
+
+// Receive handles an envelope of a participant who is not connected over a
+// websocket, such as an OSC controller, as if it had been read from their
+// connection. The error their connection would have been sent is returned.
+func (j *Jam) Receive(from uuid.UUID, e *msg.Envelope) error {
+	p, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+
+	out, err := j.handleMessage(from, &wsutil.Message{OpCode: ws.OpText, Payload: p})
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		j.Client().Broadcast(out)
+	}
+	return nil
+}
+
+// Tap calls f with every envelope relayed to the jam from now on, until the
+// returned func is called. f must not block, see websocket.Client.Tap.
+func (j *Jam) Tap(f func(e *msg.Envelope)) (untap func()) {
+	return j.Client().Tap(func(m *wsutil.Message) {
+		var e msg.Envelope
+		if m.OpCode == ws.OpText && json.Unmarshal(m.Payload, &e) == nil {
+			f(&e)
+		}
+	})
+}
+
+// SendError tells a participant their message was rejected.
+func (j *Jam) SendError(to uuid.UUID, err error) {
+	m, err := wrap(msg.ERROR, to, msg.ErrorMsg{Message: err.Error()})
+	if err != nil {
+		return
+	}
+
+	j.Client().Send(to, m)
+}
+
+func (j *Jam) isMuted(userID uuid.UUID, typ msg.MsgType) bool {
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+
+	m := j.room.muted[userID]
+	switch typ {
+	case msg.MIDI, msg.UMP, msg.SYSEX:
+		return m.MIDI
+	case msg.TEXT:
+		return m.Text
+	}
+
+	return false
+}
+
+func (j *Jam) handleKick(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	if !j.IsHost(from) {
+		return nil, ErrNotHost
+	}
+
+	var k msg.KickMsg
+	if err := e.Unwrap(&k); err != nil {
+		return nil, err
+	}
+
+	j.Client().Kick(k.UserID, "kicked by host")
+	return e, nil
+}
+
+func (j *Jam) handleMute(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	if !j.IsHost(from) {
+		return nil, ErrNotHost
+	}
+
+	var m msg.MuteMsg
+	if err := e.Unwrap(&m); err != nil {
+		return nil, err
+	}
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+
+	if !m.MIDI && !m.Text {
+		delete(j.room.muted, m.UserID)
+	} else {
+		j.room.muted[m.UserID] = m
+	}
+
+	return e, nil
+}
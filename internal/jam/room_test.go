@@ -0,0 +1,24 @@
+package jam
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeave(t *testing.T) {
+	j := &Jam{ID: uuid.New()}
+	alice, bob := NewUser("alice"), NewUser("bob")
+	j.AddUser(alice)
+	j.AddUser(bob)
+
+	j.Leave(alice.ID.UUID)
+
+	_, ok := j.User(alice.ID.UUID)
+	require.False(t, ok, "participants who leave are forgotten")
+
+	u, ok := j.User(bob.ID.UUID)
+	require.True(t, ok)
+	require.Equal(t, "bob", u.Username)
+}
@@ -0,0 +1,499 @@
+// Package session lets DAWs and hardware speaking network MIDI, such as
+// the AppleMIDI driver of macOS and iOS or rtpMIDI on Windows, play in jams
+// over RTP-MIDI sessions.
+//
+// A Listener listens on a control port and on the data port following it.
+// Peers invite the listener on both ports, keep their clocks synchronized,
+// and send their note, control change, channel pressure and pitch bend
+// messages, every peer playing as its own participant of the jam. The MIDI
+// of the jam is sent back to every peer but the one who played it. Lost
+// packets are not recovered.
+//
+// Invitations from addresses that are not on the loopback or a private
+// network are rejected.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rapidmidiex/rmx/internal/jam"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/rtpmidi"
+)
+
+// maxPacketSize is the largest UDP payload.
+const maxPacketSize = 65507
+
+// mirrorBuffer is how many envelopes are held for the peers before the
+// listener drops them, the journal being left out anyway.
+const mirrorBuffer = 256
+
+// portAttempts is how many pairs of ports are tried when any may be used.
+const portAttempts = 16
+
+var ErrPorts = errors.New("could not listen on a pair of consecutive ports")
+
+// Listener is the RTP-MIDI session of a jam.
+type Listener struct {
+	jam     *jam.Jam
+	name    string
+	ssrc    uint32
+	control *net.UDPConn
+	data    *net.UDPConn
+	start   time.Time
+	logf    func(format string, v ...any)
+
+	untap func()
+	out   chan *msg.Envelope
+	wg    sync.WaitGroup
+
+	mu sync.Mutex
+	// peers by SSRC
+	peers  map[uint32]*peer
+	closed bool
+}
+
+type peer struct {
+	ssrc    uint32
+	name    string
+	userID  uuid.UUID
+	control *net.UDPAddr
+	// set once the peer is invited on the data port
+	data *net.UDPAddr
+	seq  uint16
+}
+
+// Status describes a Listener.
+type Status struct {
+	// Name of the session as shown by the peers.
+	Name string `json:"name"`
+	// Control port, the data port following it.
+	Port  int    `json:"port"`
+	Peers []Peer `json:"peers"`
+}
+
+// Peer is a peer of the session.
+type Peer struct {
+	UserID uuid.UUID `json:"userId"`
+	Name   string    `json:"name"`
+}
+
+// Option configures a Listener.
+type Option func(*Listener)
+
+// WithName sets the name of the session, the name of the jam by default.
+func WithName(name string) Option {
+	return func(l *Listener) {
+		l.name = name
+	}
+}
+
+// WithLogger sets the logger of the errors of the peers, log.Printf by default.
+func WithLogger(logf func(format string, v ...any)) Option {
+	return func(l *Listener) {
+		l.logf = logf
+	}
+}
+
+// Listen starts the session of j on the control port of addr and the port
+// following it. Any free pair of ports is used if the port is 0.
+func Listen(j *jam.Jam, addr string, opts ...Option) (*Listener, error) {
+	control, data, err := listenPair(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ssrc [4]byte
+	if _, err := rand.Read(ssrc[:]); err != nil {
+		control.Close()
+		data.Close()
+		return nil, err
+	}
+
+	l := &Listener{
+		jam:     j,
+		name:    j.Name,
+		ssrc:    binary.BigEndian.Uint32(ssrc[:]),
+		control: control,
+		data:    data,
+		start:   time.Now(),
+		logf:    log.Printf,
+		out:     make(chan *msg.Envelope, mirrorBuffer),
+		peers:   make(map[uint32]*peer),
+	}
+
+	for _, o := range opts {
+		o(l)
+	}
+
+	l.untap = j.Tap(func(e *msg.Envelope) {
+		select {
+		case l.out <- e:
+		default:
+		}
+	})
+
+	l.wg.Add(3)
+	go l.serve(control)
+	go l.serve(data)
+	go l.mirror()
+
+	return l, nil
+}
+
+// listenPair listens on the port of addr and the one following it.
+func listenPair(addr string) (control, data *net.UDPConn, err error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 0 || port >= 65535 {
+		return nil, nil, fmt.Errorf("invalid port %q", p)
+	}
+
+	attempts := 1
+	if port == 0 {
+		attempts = portAttempts
+	}
+
+	for i := 0; i < attempts; i++ {
+		control, err = net.ListenUDP("udp", udpAddr(host, port))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		next := control.LocalAddr().(*net.UDPAddr).Port + 1
+		if next <= 65535 {
+			if data, err = net.ListenUDP("udp", udpAddr(host, next)); err == nil {
+				return control, data, nil
+			}
+		}
+		control.Close()
+	}
+	return nil, nil, ErrPorts
+}
+
+func udpAddr(host string, port int) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.ParseIP(host), Port: port}
+}
+
+// Port returns the control port of the session.
+func (l *Listener) Port() int {
+	return l.control.LocalAddr().(*net.UDPAddr).Port
+}
+
+// Status returns the name, port and peers of the session.
+func (l *Listener) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := Status{Name: l.name, Port: l.Port(), Peers: []Peer{}}
+	for _, p := range l.peers {
+		if p.data != nil {
+			s.Peers = append(s.Peers, Peer{UserID: p.userID, Name: p.name})
+		}
+	}
+	return s
+}
+
+// Close ends the sessions of the peers and stops listening.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.untap()
+	close(l.out)
+
+	peers := l.peers
+	l.peers = make(map[uint32]*peer)
+	l.mu.Unlock()
+
+	for _, p := range peers {
+		l.send(l.control, p.control, rtpmidi.Session{Command: rtpmidi.End, SSRC: l.ssrc})
+		if p.data != nil {
+			l.jam.Leave(p.userID)
+		}
+	}
+
+	err := l.control.Close()
+	if dErr := l.data.Close(); err == nil {
+		err = dErr
+	}
+	l.wg.Wait()
+	return err
+}
+
+// serve reads packets until the connection is closed.
+func (l *Listener) serve(conn *net.UDPConn) {
+	defer l.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logf("rtpmidi read: %v\n", err)
+			}
+			return
+		}
+
+		if err := l.handle(conn, from, buf[:n]); err != nil {
+			l.logf("rtpmidi %s: %v\n", from, err)
+		}
+	}
+}
+
+func (l *Listener) handle(conn *net.UDPConn, from *net.UDPAddr, p []byte) error {
+	if !rtpmidi.IsControl(p) {
+		if conn != l.data {
+			return rtpmidi.ErrCommand
+		}
+		return l.handleMIDI(from, p)
+	}
+
+	switch cmd := rtpmidi.Command(p); cmd {
+	case rtpmidi.Invitation:
+		return l.handleInvitation(conn, from, p)
+	case rtpmidi.End:
+		return l.handleEnd(from, p)
+	case rtpmidi.Sync:
+		return l.handleSync(from, p)
+	case rtpmidi.Feedback:
+		// the journal is left out, so there is nothing to trim
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", rtpmidi.ErrCommand, cmd)
+	}
+}
+
+// handleInvitation accepts an invitation on the control port, then on the
+// data port, after which the peer plays in the jam.
+func (l *Listener) handleInvitation(conn *net.UDPConn, from *net.UDPAddr, p []byte) error {
+	var in rtpmidi.Session
+	if err := in.UnmarshalBinary(p); err != nil {
+		return err
+	}
+	if !isLocal(from) {
+		return errors.New("invitations are only accepted from the loopback or a private network")
+	}
+
+	reply := rtpmidi.Session{Command: rtpmidi.Accept, Token: in.Token, SSRC: l.ssrc, Name: l.name}
+
+	var joined bool
+	l.mu.Lock()
+	pr, ok := l.peers[in.SSRC]
+	switch {
+	case conn == l.control:
+		if !ok {
+			pr = &peer{
+				ssrc:   in.SSRC,
+				name:   in.Name,
+				userID: uuid.NewSHA1(l.jam.ID, []byte("rtpmidi:"+from.String())),
+			}
+			l.peers[in.SSRC] = pr
+		}
+		pr.control = from
+	case !ok:
+		reply.Command = rtpmidi.Reject
+	default:
+		joined = pr.data == nil
+		pr.data = from
+	}
+	l.mu.Unlock()
+
+	l.send(conn, from, reply)
+	if reply.Command == rtpmidi.Reject {
+		return errors.New("invited on the data port before the control port")
+	}
+
+	if joined {
+		l.jam.AddUser(&jam.User{ID: suid.UUID{UUID: pr.userID}, Username: "rtpmidi " + pr.name})
+	}
+	return nil
+}
+
+func (l *Listener) handleEnd(from *net.UDPAddr, p []byte) error {
+	var by rtpmidi.Session
+	if err := by.UnmarshalBinary(p); err != nil {
+		return err
+	}
+
+	// peers join the jam once invited on both ports
+	var joined bool
+	l.mu.Lock()
+	pr, ok := l.peers[by.SSRC]
+	if ok && (sameAddr(pr.control, from) || sameAddr(pr.data, from)) {
+		delete(l.peers, by.SSRC)
+		joined = pr.data != nil
+	}
+	l.mu.Unlock()
+
+	if joined {
+		l.jam.Leave(pr.userID)
+	}
+	return nil
+}
+
+// handleSync answers the first packet of a clock synchronization with the
+// clock of the session.
+func (l *Listener) handleSync(from *net.UDPAddr, p []byte) error {
+	var ck rtpmidi.Clock
+	if err := ck.UnmarshalBinary(p); err != nil {
+		return err
+	}
+	if _, ok := l.peer(ck.SSRC, from); !ok || ck.Count != 0 {
+		return nil
+	}
+
+	ck.SSRC, ck.Count = l.ssrc, 1
+	ck.Timestamps[1] = l.now()
+	l.send(l.data, from, ck)
+	return nil
+}
+
+// handleMIDI plays the MIDI of a packet of a peer in the jam.
+func (l *Listener) handleMIDI(from *net.UDPAddr, p []byte) error {
+	var pkt rtpmidi.Packet
+	if err := pkt.UnmarshalBinary(p); err != nil {
+		return err
+	}
+	pr, ok := l.peer(pkt.SSRC, from)
+	if !ok {
+		return errors.New("not in the session")
+	}
+
+	for _, c := range pkt.Commands {
+		m, ok := msg.ParseMIDI(c.Data)
+		if !ok {
+			continue
+		}
+		if m.State == msg.NOTE_ON && m.Velocity == 0 {
+			m.State = msg.NOTE_OFF
+		}
+
+		e := msg.Envelope{ID: uuid.New(), Typ: msg.MIDI}
+		if err := e.SetPayload(m); err != nil {
+			return err
+		}
+		if err := l.jam.Receive(pr.userID, &e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peer returns the peer with the given SSRC if it was invited on the data
+// port from the given address.
+func (l *Listener) peer(ssrc uint32, from *net.UDPAddr) (peer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pr, ok := l.peers[ssrc]
+	if !ok || !sameAddr(pr.data, from) {
+		return peer{}, false
+	}
+	return *pr, true
+}
+
+// mirror sends the MIDI relayed to the jam to the peers until the listener
+// is closed.
+func (l *Listener) mirror() {
+	defer l.wg.Done()
+
+	for e := range l.out {
+		cmds := toCommands(e)
+		if len(cmds) == 0 {
+			continue
+		}
+
+		type target struct {
+			addr *net.UDPAddr
+			seq  uint16
+		}
+
+		l.mu.Lock()
+		targets := make([]target, 0, len(l.peers))
+		for _, p := range l.peers {
+			if p.data != nil && p.userID != e.UserID {
+				p.seq++
+				targets = append(targets, target{addr: p.data, seq: p.seq})
+			}
+		}
+		l.mu.Unlock()
+
+		pkt := rtpmidi.Packet{Timestamp: uint32(l.now()), SSRC: l.ssrc, Commands: cmds}
+		for _, t := range targets {
+			pkt.Sequence = t.seq
+			l.send(l.data, t.addr, pkt)
+		}
+	}
+}
+
+// now returns the clock of the session, in ticks of rtpmidi.ClockRate.
+func (l *Listener) now() uint64 {
+	return uint64(time.Since(l.start) / (time.Second / rtpmidi.ClockRate))
+}
+
+func (l *Listener) send(conn *net.UDPConn, to *net.UDPAddr, p interface{ MarshalBinary() ([]byte, error) }) {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		l.logf("rtpmidi %s: %v\n", to, err)
+		return
+	}
+	if _, err := conn.WriteToUDP(b, to); err != nil && !errors.Is(err, net.ErrClosed) {
+		l.logf("rtpmidi %s: %v\n", to, err)
+	}
+}
+
+func sameAddr(a, b *net.UDPAddr) bool {
+	return a != nil && b != nil && a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+func isLocal(addr *net.UDPAddr) bool {
+	return addr.IP.IsLoopback() || addr.IP.IsPrivate() || addr.IP.IsLinkLocalUnicast()
+}
+
+// toCommands returns the MIDI commands of an envelope relayed to the jam.
+func toCommands(e *msg.Envelope) []rtpmidi.MIDICommand {
+	var notes []msg.MIDIMsg
+	switch e.Typ {
+	case msg.MIDI:
+		var m msg.MIDIMsg
+		if e.Unwrap(&m) != nil {
+			return nil
+		}
+		notes = append(notes, m)
+	case msg.UMP:
+		var u msg.UMPMsg
+		if e.Unwrap(&u) != nil {
+			return nil
+		}
+		for _, p := range u.Packets {
+			if m, ok := p.MIDI(); ok {
+				notes = append(notes, m)
+			}
+		}
+	}
+
+	cmds := make([]rtpmidi.MIDICommand, 0, len(notes))
+	for _, m := range notes {
+		if b := m.Bytes(); b != nil {
+			cmds = append(cmds, rtpmidi.MIDICommand{Data: b})
+		}
+	}
+	return cmds
+}
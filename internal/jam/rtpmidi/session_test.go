@@ -0,0 +1,144 @@
+package session_test
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rapidmidiex/rmx/internal/jam"
+	session "github.com/rapidmidiex/rmx/internal/jam/rtpmidi"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/rtpmidi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListener(t *testing.T) {
+	j := &jam.Jam{ID: uuid.New(), Name: "Garage"}
+	j.SetDefaults()
+
+	// live before the listener shares it
+	ws := httptest.NewServer(j.Client())
+	t.Cleanup(ws.Close)
+
+	l, err := session.Listen(j, "127.0.0.1:0", session.WithLogger(t.Logf))
+	require.NoError(t, err)
+	defer l.Close()
+
+	player, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ws.URL, "http"), nil)
+	require.NoError(t, err)
+	defer player.Close()
+
+	var envelope msg.Envelope
+	require.NoError(t, player.ReadJSON(&envelope))
+	require.Equal(t, msg.CONNECT, envelope.Typ)
+
+	// the peer, a DAW inviting the jam to its session
+	const ssrc = 0xD4
+	dial := func(port int) *net.UDPConn {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	control, data := dial(l.Port()), dial(l.Port()+1)
+
+	send := func(conn *net.UDPConn, p interface{ MarshalBinary() ([]byte, error) }) {
+		b, err := p.MarshalBinary()
+		require.NoError(t, err)
+		_, err = conn.Write(b)
+		require.NoError(t, err)
+	}
+
+	receive := func(conn *net.UDPConn) []byte {
+		buf := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		return buf[:n]
+	}
+
+	t.Run("accepts invitations on both ports", func(t *testing.T) {
+		send(data, rtpmidi.Session{Command: rtpmidi.Invitation, Token: 1, SSRC: ssrc, Name: "Logic"})
+		var reply rtpmidi.Session
+		require.NoError(t, reply.UnmarshalBinary(receive(data)))
+		require.Equal(t, rtpmidi.Reject, reply.Command, "the control port is invited first")
+
+		for _, conn := range []*net.UDPConn{control, data} {
+			send(conn, rtpmidi.Session{Command: rtpmidi.Invitation, Token: 2, SSRC: ssrc, Name: "Logic"})
+			require.NoError(t, reply.UnmarshalBinary(receive(conn)))
+			require.Equal(t, rtpmidi.Session{Command: rtpmidi.Accept, Token: 2, SSRC: reply.SSRC, Name: "Garage"}, reply)
+		}
+
+		status := l.Status()
+		require.Equal(t, l.Port(), status.Port)
+		require.Len(t, status.Peers, 1)
+		require.Equal(t, "Logic", status.Peers[0].Name)
+
+		u, ok := j.User(status.Peers[0].UserID)
+		require.True(t, ok, "the peer plays as a participant")
+		require.Equal(t, "rtpmidi Logic", u.Username)
+	})
+
+	t.Run("synchronizes clocks", func(t *testing.T) {
+		send(data, rtpmidi.Clock{SSRC: ssrc, Timestamps: [3]uint64{42}})
+
+		var ck rtpmidi.Clock
+		require.NoError(t, ck.UnmarshalBinary(receive(data)))
+		require.Equal(t, uint8(1), ck.Count)
+		require.Equal(t, uint64(42), ck.Timestamps[0])
+	})
+
+	t.Run("plays the MIDI of the peer in the jam", func(t *testing.T) {
+		send(data, rtpmidi.Packet{Sequence: 1, SSRC: ssrc, Commands: []rtpmidi.MIDICommand{
+			{Data: []byte{0x92, 60, 100}},
+			{Delta: 10, Data: []byte{0x92, 60, 0}},
+		}})
+
+		var note msg.MIDIMsg
+		require.NoError(t, player.ReadJSON(&envelope))
+		require.Equal(t, msg.MIDI, envelope.Typ)
+		require.Equal(t, l.Status().Peers[0].UserID, envelope.UserID)
+		require.NoError(t, envelope.Unwrap(&note))
+		require.Equal(t, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100, Channel: 2}, note)
+
+		note = msg.MIDIMsg{}
+		require.NoError(t, player.ReadJSON(&envelope))
+		require.NoError(t, envelope.Unwrap(&note))
+		require.Equal(t, msg.NOTE_OFF, note.State, "velocity 0 turns the note off")
+	})
+
+	t.Run("sends the MIDI of the jam to the peer", func(t *testing.T) {
+		e := msg.Envelope{ID: uuid.New(), Typ: msg.MIDI}
+		require.NoError(t, e.SetPayload(msg.MIDIMsg{State: msg.PITCH_BEND, Value: 12000, Channel: 1}))
+		require.NoError(t, player.WriteJSON(e))
+		require.NoError(t, player.ReadJSON(&envelope))
+
+		var pkt rtpmidi.Packet
+		require.NoError(t, pkt.UnmarshalBinary(receive(data)))
+		require.Equal(t, []rtpmidi.MIDICommand{{Data: []byte{0xE1, 12000 & 0x7F, 12000 >> 7}}}, pkt.Commands,
+			"the peer is not sent its own notes")
+	})
+
+	t.Run("ends sessions", func(t *testing.T) {
+		userID := l.Status().Peers[0].UserID
+		send(control, rtpmidi.Session{Command: rtpmidi.End, SSRC: ssrc})
+		require.Eventually(t, func() bool { return len(l.Status().Peers) == 0 }, time.Second, 10*time.Millisecond)
+		require.Eventually(t, func() bool {
+			_, ok := j.User(userID)
+			return !ok
+		}, time.Second, 10*time.Millisecond, "the peer leaves the jam")
+
+		// the listener ends the sessions of its peers when closed
+		send(control, rtpmidi.Session{Command: rtpmidi.Invitation, Token: 3, SSRC: ssrc, Name: "Logic"})
+		receive(control)
+		require.NoError(t, l.Close())
+
+		var by rtpmidi.Session
+		require.NoError(t, by.UnmarshalBinary(receive(control)))
+		require.Equal(t, rtpmidi.End, by.Command)
+	})
+}
@@ -0,0 +1,259 @@
+package jam
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+// percussionChannel is the channel General MIDI plays drum kits on,
+// notes played on it are never held to the scale of the jam.
+const percussionChannel = 9
+
+var (
+	ErrInvalidKey       = errors.New("key must be a note name such as C, F# or Bb")
+	ErrInvalidScale     = errors.New("scale must be one of: major, minor, dorian, phrygian, lydian, mixolydian, locrian, harmonic-minor, melodic-minor, major-pentatonic, minor-pentatonic, blues")
+	ErrInvalidScaleMode = errors.New("scale mode must be one of: off, reject, snap, and requires a key")
+	ErrOutOfScale       = errors.New("note is out of the scale of the jam")
+)
+
+// Scale is a set of intervals from the key of a jam.
+type Scale string
+
+const (
+	Major           Scale = "major"
+	Minor           Scale = "minor"
+	Dorian          Scale = "dorian"
+	Phrygian        Scale = "phrygian"
+	Lydian          Scale = "lydian"
+	Mixolydian      Scale = "mixolydian"
+	Locrian         Scale = "locrian"
+	HarmonicMinor   Scale = "harmonic-minor"
+	MelodicMinor    Scale = "melodic-minor"
+	MajorPentatonic Scale = "major-pentatonic"
+	MinorPentatonic Scale = "minor-pentatonic"
+	Blues           Scale = "blues"
+)
+
+var scaleIntervals = map[Scale][]int{
+	Major:           {0, 2, 4, 5, 7, 9, 11},
+	Minor:           {0, 2, 3, 5, 7, 8, 10},
+	Dorian:          {0, 2, 3, 5, 7, 9, 10},
+	Phrygian:        {0, 1, 3, 5, 7, 8, 10},
+	Lydian:          {0, 2, 4, 6, 7, 9, 11},
+	Mixolydian:      {0, 2, 4, 5, 7, 9, 10},
+	Locrian:         {0, 1, 3, 5, 6, 8, 10},
+	HarmonicMinor:   {0, 2, 3, 5, 7, 8, 11},
+	MelodicMinor:    {0, 2, 3, 5, 7, 9, 11},
+	MajorPentatonic: {0, 2, 4, 7, 9},
+	MinorPentatonic: {0, 3, 5, 7, 10},
+	Blues:           {0, 3, 5, 6, 7, 10},
+}
+
+func (s Scale) Valid() bool {
+	_, ok := scaleIntervals[s]
+	return ok
+}
+
+// ScaleMode is what happens to notes played out of the scale of a jam.
+type ScaleMode string
+
+const (
+	// ScaleOff lets every note through, the scale is only shown to players.
+	ScaleOff ScaleMode = "off"
+	// ScaleReject drops notes out of the scale, the player is sent an error.
+	ScaleReject ScaleMode = "reject"
+	// ScaleSnap moves notes out of the scale to the nearest note in the scale.
+	ScaleSnap ScaleMode = "snap"
+)
+
+func (m ScaleMode) Valid() bool {
+	switch m {
+	case ScaleOff, ScaleReject, ScaleSnap:
+		return true
+	}
+	return false
+}
+
+// pitchClass returns the pitch class of a note name, C being 0.
+func pitchClass(key string) (int, bool) {
+	if key == "" || len(key) > 2 {
+		return 0, false
+	}
+
+	pc, ok := map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}[key[0]]
+	if !ok {
+		return 0, false
+	}
+
+	if len(key) == 2 {
+		switch key[1] {
+		case '#':
+			pc++
+		case 'b':
+			pc--
+		default:
+			return 0, false
+		}
+	}
+
+	return (pc + 12) % 12, true
+}
+
+// ValidScale reports whether the key, scale and scale mode of a jam go together.
+// A jam without a key has no scale to enforce.
+func ValidScale(key string, scale Scale, mode ScaleMode) error {
+	if !mode.Valid() || (key == "" && mode != ScaleOff) {
+		return ErrInvalidScaleMode
+	}
+	if key == "" {
+		return nil
+	}
+
+	if _, ok := pitchClass(key); !ok {
+		return ErrInvalidKey
+	}
+	if !scale.Valid() {
+		return ErrInvalidScale
+	}
+	return nil
+}
+
+// ScaleNotes returns the pitch classes of a scale in the given key, in
+// ascending order from the key. It is empty if key or scale are not valid.
+func ScaleNotes(key string, scale Scale) []int {
+	root, ok := pitchClass(key)
+	if !ok {
+		return nil
+	}
+
+	var pcs []int
+	for _, i := range scaleIntervals[scale] {
+		pcs = append(pcs, (root+i)%12)
+	}
+	return pcs
+}
+
+// SetScale changes the key, scale and scale mode of a live jam and tells
+// everyone in the jam.
+func (j *Jam) SetScale(key string, scale Scale, mode ScaleMode) error {
+	j.Client()
+
+	j.room.mu.Lock()
+	j.Key, j.Scale, j.ScaleMode = key, scale, mode
+	s := j.scaleMsg()
+	j.room.mu.Unlock()
+
+	return j.Broadcast(msg.SCALE, s)
+}
+
+// scaleMsg must be called with the lock held.
+func (j *Jam) scaleMsg() msg.ScaleMsg {
+	return msg.ScaleMsg{
+		Key:   j.Key,
+		Scale: string(j.Scale),
+		Mode:  string(j.ScaleMode),
+		Notes: ScaleNotes(j.Key, j.Scale),
+	}
+}
+
+// fitScale holds a note played by a participant to the scale of the jam.
+// ok is false if the note must be dropped. Notes are only ever turned off,
+// on the pitch they were turned on at even if the scale changed since, so
+// none is left held.
+// It must be called with the lock held.
+func (j *Jam) fitScale(from uuid.UUID, m msg.MIDIMsg) (_ msg.MIDIMsg, ok bool) {
+	if m.Channel == percussionChannel || !m.IsNote() {
+		return m, true
+	}
+
+	n := participantNote{from, m.Channel, m.Number}
+	if m.State == msg.NOTE_OFF || m.Velocity == 0 {
+		m.Number = j.room.unsnap(n)
+		return m, true
+	}
+
+	if j.ScaleMode == ScaleOff || j.ScaleMode == "" {
+		return m, true
+	}
+
+	notes := ScaleNotes(j.Key, j.Scale)
+	if len(notes) == 0 || inScale(notes, m.Number) {
+		return m, true
+	}
+
+	switch j.ScaleMode {
+	case ScaleReject:
+		return m, false
+	case ScaleSnap:
+		// the nearest note in the scale, the lower one on a tie
+		for d := 1; d < 12; d++ {
+			if n := m.Number - d; n >= 0 && inScale(notes, n) {
+				m.Number = n
+				break
+			}
+			if n := m.Number + d; n <= 127 && inScale(notes, n) {
+				m.Number = n
+				break
+			}
+		}
+		j.room.snap(n, m.Number)
+	}
+
+	return m, true
+}
+
+// snap remembers the pitch a held note was snapped to.
+func (r *room) snap(n participantNote, number int) {
+	r.snapMu.Lock()
+	defer r.snapMu.Unlock()
+	r.snapped[n] = number
+}
+
+// snappedNote returns the pitch a held note was snapped to, its own if it
+// was not snapped.
+func (r *room) snappedNote(n participantNote) int {
+	r.snapMu.Lock()
+	defer r.snapMu.Unlock()
+
+	if number, ok := r.snapped[n]; ok {
+		return number
+	}
+	return n.number
+}
+
+// unsnap returns the pitch a note being turned off was snapped to, and
+// forgets it.
+func (r *room) unsnap(n participantNote) int {
+	r.snapMu.Lock()
+	defer r.snapMu.Unlock()
+
+	number, ok := r.snapped[n]
+	if !ok {
+		return n.number
+	}
+	delete(r.snapped, n)
+	return number
+}
+
+// forgetSnaps drops the notes held by a participant who left the jam.
+func (r *room) forgetSnaps(from uuid.UUID) {
+	r.snapMu.Lock()
+	defer r.snapMu.Unlock()
+
+	for n := range r.snapped {
+		if n.userID == from {
+			delete(r.snapped, n)
+		}
+	}
+}
+
+func inScale(notes []int, number int) bool {
+	for _, pc := range notes {
+		if number%12 == pc {
+			return true
+		}
+	}
+	return false
+}
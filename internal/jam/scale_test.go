@@ -0,0 +1,67 @@
+package jam
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitScale(t *testing.T) {
+	j := &Jam{Key: "C", Scale: Major, ScaleMode: ScaleSnap}
+	j.Client()
+	alice := uuid.New()
+
+	for _, tc := range []struct {
+		m    msg.MIDIMsg
+		want int
+		ok   bool
+	}{
+		{msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100}, 60, true},
+		{msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100}, 60, true},
+		{msg.MIDIMsg{State: msg.NOTE_ON, Number: 66, Velocity: 100}, 65, true},
+		{msg.MIDIMsg{State: msg.NOTE_ON, Number: 70, Velocity: 100}, 69, true},
+		{msg.MIDIMsg{State: msg.NOTE_ON, Number: 0, Velocity: 100}, 0, true},
+		{msg.MIDIMsg{State: msg.NOTE_ON, Number: 127, Velocity: 100}, 127, true},
+		{msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100, Channel: percussionChannel}, 61, true},
+		{msg.MIDIMsg{State: msg.CONTROL_CHANGE, Number: 1, Value: 64}, 1, true},
+	} {
+		got, ok := j.fitScale(alice, tc.m)
+		require.Equal(t, tc.ok, ok, "%+v", tc.m)
+		require.Equal(t, tc.want, got.Number, "%+v", tc.m)
+	}
+
+	j.ScaleMode = ScaleReject
+	_, ok := j.fitScale(alice, msg.MIDIMsg{State: msg.NOTE_ON, Number: 63, Velocity: 100})
+	require.False(t, ok)
+	got, ok := j.fitScale(alice, msg.MIDIMsg{State: msg.NOTE_OFF, Number: 63})
+	require.True(t, ok, "notes can always be turned off")
+	require.Equal(t, 63, got.Number)
+}
+
+func TestFitScaleChange(t *testing.T) {
+	j := &Jam{Key: "C", Scale: Major, ScaleMode: ScaleSnap}
+	j.Client()
+	alice, bob := uuid.New(), uuid.New()
+
+	got, _ := j.fitScale(alice, msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100})
+	require.Equal(t, 60, got.Number)
+	got, _ = j.fitScale(bob, msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 100})
+	require.Equal(t, 60, got.Number)
+
+	// C# is in D major, so it would not be snapped anymore
+	j.Key = "D"
+	got, _ = j.fitScale(alice, msg.MIDIMsg{State: msg.NOTE_OFF, Number: 61})
+	require.Equal(t, 60, got.Number, "notes are turned off where they were turned on")
+	got, _ = j.fitScale(alice, msg.MIDIMsg{State: msg.NOTE_OFF, Number: 61})
+	require.Equal(t, 61, got.Number)
+
+	j.ScaleMode = ScaleOff
+	got, _ = j.fitScale(bob, msg.MIDIMsg{State: msg.NOTE_ON, Number: 61, Velocity: 0})
+	require.Equal(t, 60, got.Number, "a note on without velocity turns the note off")
+
+	j.room.snap(participantNote{alice, 0, 61}, 60)
+	j.room.forgetSnaps(alice)
+	require.Empty(t, j.room.snapped)
+}
@@ -0,0 +1,101 @@
+package jam
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+// Cue is a recorded MIDI message at its position in a Sequence.
+type Cue struct {
+	RecordedMsg
+	// Position from the start of the sequence, in beats.
+	Beat float64
+	// Index of the track of the sequence the message belongs to.
+	Track int
+}
+
+// Sequence is a recording laid out in beats rather than time, so that
+// it can be rendered or played back at any tempo.
+type Sequence struct {
+	Cues []Cue
+	// Length of the sequence in beats.
+	Length float64
+	// Names of the tracks of the sequence.
+	Tracks []string
+}
+
+// Sequence lays out the messages of a recording in beats, following the
+// tempo changes of the jam. Every participant gets a track, in the order
+// they first played. ms must be in the order they were received.
+func (r Recording) Sequence(ms []RecordedMsg) Sequence {
+	bpm := r.BPM
+	if bpm == 0 && len(ms) > 0 {
+		bpm = ms[0].BPM
+	}
+	if bpm == 0 {
+		bpm = defaultBPM
+	}
+
+	var (
+		s      Sequence
+		last   = r.StartedAt
+		tracks = make(map[uuid.UUID]int)
+	)
+	for _, m := range ms {
+		if d := m.At.Sub(last); d > 0 {
+			s.Length += d.Seconds() * float64(bpm) / 60
+			last = m.At
+		}
+
+		if m.BPM != 0 {
+			bpm = m.BPM
+		}
+
+		track, ok := tracks[m.UserID]
+		if !ok {
+			name := m.UserName
+			if name == "" {
+				name = m.UserID.String()
+			}
+
+			track = len(s.Tracks)
+			tracks[m.UserID] = track
+			s.Tracks = append(s.Tracks, name)
+		}
+
+		s.Cues = append(s.Cues, Cue{RecordedMsg: m, Beat: s.Length, Track: track})
+	}
+
+	if r.StoppedAt != nil {
+		if d := r.StoppedAt.Sub(last); d > 0 {
+			s.Length += d.Seconds() * float64(bpm) / 60
+		}
+	}
+
+	return s
+}
+
+// SetChannel plays every message of the sequence on the given channel.
+func (s Sequence) SetChannel(ch int) {
+	for i := range s.Cues {
+		s.Cues[i].Channel = ch
+	}
+}
+
+// seek returns the index of the first cue at or after beat.
+func (s Sequence) seek(beat float64) int {
+	return sort.Search(len(s.Cues), func(i int) bool { return s.Cues[i].Beat >= beat })
+}
+
+// turnsOff reports whether the next cue of a held note from the cue at index
+// from turns it off.
+func (s Sequence) turnsOff(n heldNote, from int) bool {
+	for _, c := range s.Cues[from:] {
+		if c.IsNote() && c.Track == n.track && c.Channel == n.channel && c.Number == n.number {
+			return c.State == msg.NOTE_OFF || c.Velocity == 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package jam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequence(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	stop := start.Add(3 * time.Second)
+	alice, bob := uuid.New(), uuid.New()
+
+	on := msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100}
+	off := msg.MIDIMsg{State: msg.NOTE_OFF, Number: 60}
+
+	r := Recording{BPM: 120, StartedAt: start, StoppedAt: &stop}
+	s := r.Sequence([]RecordedMsg{
+		{MIDIMsg: on, UserID: alice, UserName: "alice", BPM: 120, At: start.Add(500 * time.Millisecond)},
+		{MIDIMsg: on, UserID: bob, BPM: 120, At: start.Add(time.Second)},
+		// the tempo doubles from here on
+		{MIDIMsg: off, UserID: alice, UserName: "alice", BPM: 240, At: start.Add(1500 * time.Millisecond)},
+		{MIDIMsg: off, UserID: bob, BPM: 240, At: start.Add(2 * time.Second)},
+	})
+
+	require.Equal(t, []string{"alice", bob.String()}, s.Tracks, "participants without a name are named after their id")
+
+	var beats []float64
+	var tracks []int
+	for _, c := range s.Cues {
+		beats = append(beats, c.Beat)
+		tracks = append(tracks, c.Track)
+	}
+	require.Equal(t, []float64{1, 2, 3, 5}, beats)
+	require.Equal(t, []int{0, 1, 0, 1}, tracks)
+	require.Equal(t, 9.0, s.Length, "the recording lasts until it was stopped")
+
+	require.Equal(t, 2, s.seek(3))
+	require.Equal(t, 3, s.seek(3.5))
+	require.Equal(t, 4, s.seek(6))
+
+	require.True(t, s.turnsOff(heldNote{0, 0, 60}, 1))
+	require.False(t, s.turnsOff(heldNote{1, 0, 61}, 0))
+
+	s.SetChannel(3)
+	for _, c := range s.Cues {
+		require.Equal(t, 3, c.Channel)
+	}
+}
+
+func TestSequenceEmpty(t *testing.T) {
+	s := Recording{}.Sequence(nil)
+	require.Empty(t, s.Cues)
+	require.Zero(t, s.Length)
+}
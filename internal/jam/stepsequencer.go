@@ -0,0 +1,303 @@
+package jam
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+const (
+	// SequencerName is the username of the virtual participant playing the step sequencer.
+	SequencerName = "Step sequencer"
+
+	MaxSteps           = 64
+	MaxStepsPerBeat    = 8
+	MaxSequencerTracks = 16
+
+	defaultStepVelocity = 100
+	defaultStepGate     = 0.5
+)
+
+var (
+	ErrNoSequencer      = errors.New("jam has no step sequencer")
+	ErrInvalidSequencer = errors.New("invalid step sequencer")
+	ErrInvalidStep      = errors.New("invalid step")
+	ErrStaleStep        = errors.New("step changed since it was toggled")
+)
+
+// StepSequencer is a grid of steps shared by everyone in a jam. The server
+// holds the authoritative state, which is played on the transport of the jam.
+type StepSequencer struct {
+	// Virtual participant the pattern is played as.
+	ID uuid.UUID
+
+	j *Jam
+
+	mu      sync.Mutex
+	state   msg.SequencerMsg
+	player  *Player // while playing
+	removed bool
+}
+
+// SetStepSequencer lays out the step sequencer of the jam, creating it if
+// needed. Steps left out of the tracks are off. A playing pattern keeps playing.
+func (j *Jam) SetStepSequencer(steps, stepsPerBeat int, tracks []msg.SequencerTrack) (*StepSequencer, error) {
+	if err := validLayout(steps, stepsPerBeat, tracks); err != nil {
+		return nil, err
+	}
+
+	j.Client()
+
+	j.room.mu.Lock()
+	s := j.room.sequencer
+	if s == nil {
+		s = &StepSequencer{ID: uuid.New(), j: j}
+		s.state.UserID = s.ID
+		j.room.sequencer = s
+		j.room.users[s.ID] = &User{ID: suid.UUID{UUID: s.ID}, Username: SequencerName}
+	}
+	j.room.mu.Unlock()
+
+	s.mu.Lock()
+	if s.removed {
+		s.mu.Unlock()
+		return nil, ErrNoSequencer
+	}
+
+	s.state.Revision++
+	s.state.Steps, s.state.StepsPerBeat = steps, stepsPerBeat
+	s.state.Tracks = make([]msg.SequencerTrack, 0, len(tracks))
+	for i, t := range tracks {
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("Track %d", i+1)
+		}
+
+		row := t
+		row.Steps = make([]msg.Step, steps)
+		for k, step := range t.Steps {
+			if step.On {
+				row.Steps[k] = newStep(step.Velocity, step.Gate, s.state.Revision)
+			} else {
+				row.Steps[k] = msg.Step{Revision: s.state.Revision}
+			}
+		}
+		s.state.Tracks = append(s.state.Tracks, row)
+	}
+
+	if s.player != nil {
+		s.player.setSequence(s.sequence())
+	}
+	s.mu.Unlock()
+
+	return s, s.broadcast()
+}
+
+// StepSequencer returns the step sequencer of the jam, if any.
+func (j *Jam) StepSequencer() (*StepSequencer, bool) {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.sequencer, j.room.sequencer != nil
+}
+
+// RemoveStepSequencer stops and removes the step sequencer of the jam.
+func (j *Jam) RemoveStepSequencer() error {
+	j.Client()
+
+	j.room.mu.Lock()
+	s := j.room.sequencer
+	j.room.sequencer = nil
+	j.room.mu.Unlock()
+
+	if s == nil {
+		return ErrNoSequencer
+	}
+
+	s.mu.Lock()
+	s.removed = true
+	if s.player != nil {
+		s.player.Stop()
+		s.player = nil
+	}
+	s.mu.Unlock()
+
+	return j.Broadcast(msg.SEQUENCER, msg.SequencerMsg{})
+}
+
+// Toggle turns a step on or off. Concurrent toggles of a step are resolved
+// in the order they reach the server: a toggle made before the step last
+// changed is rejected with ErrStaleStep, so that two players turning the
+// same step on do not turn it back off.
+func (s *StepSequencer) Toggle(m msg.StepMsg) error {
+	s.mu.Lock()
+	if s.removed {
+		s.mu.Unlock()
+		return ErrNoSequencer
+	}
+
+	if m.Track < 0 || m.Track >= len(s.state.Tracks) || m.Step < 0 || m.Step >= s.state.Steps ||
+		m.Velocity < 0 || m.Velocity > 127 || m.Gate < 0 || m.Gate > 1 {
+		s.mu.Unlock()
+		return ErrInvalidStep
+	}
+
+	step := &s.state.Tracks[m.Track].Steps[m.Step]
+	if step.Revision > m.Revision {
+		s.mu.Unlock()
+		return ErrStaleStep
+	}
+
+	s.state.Revision++
+	if step.On {
+		*step = msg.Step{Revision: s.state.Revision}
+	} else {
+		*step = newStep(m.Velocity, m.Gate, s.state.Revision)
+	}
+
+	if s.player != nil {
+		s.player.setSequence(s.sequence())
+	}
+	s.mu.Unlock()
+
+	return s.broadcast()
+}
+
+// SetPlaying starts playing the pattern in a loop from the next bar of the
+// transport, or stops it.
+func (s *StepSequencer) SetPlaying(playing bool) error {
+	start := s.j.nextBeat(BeatsPerBar)
+
+	s.mu.Lock()
+	switch {
+	case s.removed:
+		s.mu.Unlock()
+		return ErrNoSequencer
+	case playing == (s.player != nil):
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.state.Revision++
+	s.state.Playing = playing
+	if playing {
+		p := newPlayer(s.j, s.ID, s.sequence(), true)
+		p.ID, p.quiet, p.offset = s.ID, true, start
+		s.player, s.state.Start = p, start
+
+		go p.run()
+	} else {
+		s.player.Stop()
+		s.player, s.state.Start = nil, 0
+	}
+	s.mu.Unlock()
+
+	return s.broadcast()
+}
+
+// Status returns the state of the step sequencer.
+func (s *StepSequencer) Status() msg.SequencerMsg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.removed {
+		return msg.SequencerMsg{}
+	}
+
+	state := s.state
+	state.Tracks = make([]msg.SequencerTrack, len(s.state.Tracks))
+	for i, t := range s.state.Tracks {
+		t.Steps = append([]msg.Step(nil), t.Steps...)
+		state.Tracks[i] = t
+	}
+	return state
+}
+
+// sequence lays out the steps that are on, one track per row.
+// It must be called with the lock held.
+func (s *StepSequencer) sequence() Sequence {
+	perBeat := float64(s.state.StepsPerBeat)
+
+	seq := Sequence{Length: float64(s.state.Steps) / perBeat}
+	for i, t := range s.state.Tracks {
+		seq.Tracks = append(seq.Tracks, t.Name)
+		for k, step := range t.Steps {
+			if !step.On {
+				continue
+			}
+
+			at := float64(k) / perBeat
+			on := msg.MIDIMsg{State: msg.NOTE_ON, Number: t.Note, Velocity: step.Velocity, Channel: t.Channel}
+			off := msg.MIDIMsg{State: msg.NOTE_OFF, Number: t.Note, Channel: t.Channel}
+			seq.Cues = append(seq.Cues,
+				Cue{RecordedMsg: RecordedMsg{MIDIMsg: on}, Beat: at, Track: i},
+				Cue{RecordedMsg: RecordedMsg{MIDIMsg: off}, Beat: at + step.Gate/perBeat, Track: i},
+			)
+		}
+	}
+
+	// a note ending on a step is turned off before the step plays
+	sort.SliceStable(seq.Cues, func(i, j int) bool { return seq.Cues[i].Beat < seq.Cues[j].Beat })
+	return seq
+}
+
+func (s *StepSequencer) broadcast() error {
+	return s.j.Broadcast(msg.SEQUENCER, s.Status())
+}
+
+func newStep(velocity int, gate float64, revision int) msg.Step {
+	if velocity == 0 {
+		velocity = defaultStepVelocity
+	}
+	if gate == 0 {
+		gate = defaultStepGate
+	}
+	return msg.Step{On: true, Velocity: velocity, Gate: gate, Revision: revision}
+}
+
+func validLayout(steps, stepsPerBeat int, tracks []msg.SequencerTrack) error {
+	switch {
+	case steps < 1 || steps > MaxSteps:
+		return fmt.Errorf("%w: steps must be between 1 and %d", ErrInvalidSequencer, MaxSteps)
+	case stepsPerBeat < 1 || stepsPerBeat > MaxStepsPerBeat:
+		return fmt.Errorf("%w: steps per beat must be between 1 and %d", ErrInvalidSequencer, MaxStepsPerBeat)
+	case len(tracks) < 1 || len(tracks) > MaxSequencerTracks:
+		return fmt.Errorf("%w: tracks must be between 1 and %d", ErrInvalidSequencer, MaxSequencerTracks)
+	}
+
+	for _, t := range tracks {
+		if t.Note < 0 || t.Note > 127 || t.Channel < 0 || t.Channel > 15 {
+			return fmt.Errorf("%w: invalid note or channel of track %q", ErrInvalidSequencer, t.Name)
+		}
+		if len(t.Steps) > steps {
+			return fmt.Errorf("%w: track %q has more than %d steps", ErrInvalidSequencer, t.Name, steps)
+		}
+		for _, step := range t.Steps {
+			if step.Velocity < 0 || step.Velocity > 127 || step.Gate < 0 || step.Gate > 1 {
+				return fmt.Errorf("%w: invalid velocity or gate in track %q", ErrInvalidSequencer, t.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (j *Jam) handleStep(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	var m msg.StepMsg
+	if err := e.Unwrap(&m); err != nil {
+		return nil, err
+	}
+
+	s, ok := j.StepSequencer()
+	if !ok {
+		return nil, ErrNoSequencer
+	}
+
+	// every client gets the merged state rather than the toggle
+	return nil, s.Toggle(m)
+}
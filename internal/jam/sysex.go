@@ -0,0 +1,140 @@
+package jam
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+)
+
+const (
+	defaultSysExMaxSize = 4096
+	maxSysExMaxSize     = 65536
+	// sysExRate is how many bytes of SysEx a participant may send per second,
+	// the speed of a MIDI 1.0 cable: hardware cannot take them in faster.
+	sysExRate = 3125
+)
+
+var (
+	ErrInvalidSysEx       = errors.New("SysEx messages hold a manufacturer ID and data bytes only")
+	ErrInvalidSysExConfig = errors.New("SysEx max size must be at most 65536 bytes, and manufacturers hex IDs such as 43 or 002033")
+	ErrSysExManufacturer  = errors.New("SysEx of this manufacturer is not allowed in the jam")
+	ErrSysExTooLarge      = errors.New("SysEx message is larger than the jam allows")
+	ErrSysExRate          = errors.New("too much SysEx sent, wait before sending more")
+)
+
+// ParseManufacturers returns the manufacturer IDs in ids in the form
+// msg.SysExMsg.Manufacturer reports them, without duplicates.
+func ParseManufacturers(ids []msg.Manufacturer) ([]msg.Manufacturer, error) {
+	parsed := make([]msg.Manufacturer, 0, len(ids))
+	seen := make(map[msg.Manufacturer]bool, len(ids))
+	for _, s := range ids {
+		id, ok := msg.ParseManufacturer(string(s))
+		if !ok {
+			return nil, ErrInvalidSysExConfig
+		}
+		if !seen[id] {
+			seen[id] = true
+			parsed = append(parsed, id)
+		}
+	}
+	return parsed, nil
+}
+
+// ValidSysEx reports whether size and manufacturers make a valid SysEx
+// configuration for a jam.
+func ValidSysEx(size uint, manufacturers []msg.Manufacturer) error {
+	if size == 0 || size > maxSysExMaxSize {
+		return ErrInvalidSysExConfig
+	}
+	for _, id := range manufacturers {
+		if parsed, ok := msg.ParseManufacturer(string(id)); !ok || parsed != id {
+			return ErrInvalidSysExConfig
+		}
+	}
+	return nil
+}
+
+// SetSysEx changes the largest SysEx message relayed in a live jam and the
+// manufacturers allowed to be, SysEx is dropped if there are none.
+func (j *Jam) SetSysEx(size uint, manufacturers []msg.Manufacturer) {
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+	j.SysExMaxSize, j.SysExManufacturers = size, manufacturers
+}
+
+// handleSysEx relays the SysEx messages of a participant if the jam allows
+// their manufacturer and size, and the participant keeps to sysExRate bytes
+// per second of them. Bursts of a message as large as the jam allows and a
+// second worth of bytes are let through.
+func (j *Jam) handleSysEx(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	var m msg.SysExMsg
+	if err := e.Unwrap(&m); err != nil {
+		return nil, err
+	}
+
+	if !m.Valid() {
+		return nil, ErrInvalidSysEx
+	}
+	id, _ := m.Manufacturer()
+
+	j.room.mu.RLock()
+	size, allowed := j.SysExMaxSize, false
+	for _, a := range j.SysExManufacturers {
+		allowed = allowed || a == id
+	}
+	j.room.mu.RUnlock()
+
+	if !allowed {
+		return nil, ErrSysExManufacturer
+	}
+	if uint(len(m.Data)) > size {
+		return nil, ErrSysExTooLarge
+	}
+	// framed as sent to hardware
+	if !j.room.takeSysEx(from, len(m.Data)+2, float64(size+2+sysExRate), time.Now()) {
+		return nil, ErrSysExRate
+	}
+
+	return e, nil
+}
+
+// leakyBucket holds the bytes of SysEx a participant sent, draining at
+// sysExRate bytes per second. Bytes are counted rather than tokens so that
+// raising the size allowed in the jam takes effect at once.
+type leakyBucket struct {
+	level float64
+	last  time.Time
+}
+
+// takeSysEx adds n bytes to the bucket of a participant, unless it would
+// then hold more than burst bytes.
+func (r *room) takeSysEx(from uuid.UUID, n int, burst float64, now time.Time) bool {
+	r.sysExMu.Lock()
+	defer r.sysExMu.Unlock()
+
+	b, ok := r.sysEx[from]
+	if !ok {
+		b = &leakyBucket{last: now}
+		r.sysEx[from] = b
+	}
+
+	b.level = math.Max(0, b.level-now.Sub(b.last).Seconds()*sysExRate)
+	b.last = now
+	if b.level+float64(n) > burst {
+		return false
+	}
+	b.level += float64(n)
+	return true
+}
+
+// forgetSysEx drops the bucket of a participant who left the jam.
+func (r *room) forgetSysEx(from uuid.UUID) {
+	r.sysExMu.Lock()
+	defer r.sysExMu.Unlock()
+	delete(r.sysEx, from)
+}
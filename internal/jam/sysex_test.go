@@ -0,0 +1,30 @@
+package jam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTakeSysEx(t *testing.T) {
+	r := newRoom()
+	alice, bob := uuid.New(), uuid.New()
+	now := time.Now()
+
+	require.True(t, r.takeSysEx(alice, 60, 100, now))
+	require.False(t, r.takeSysEx(alice, 50, 100, now), "the bucket would overflow")
+	require.True(t, r.takeSysEx(bob, 100, 100, now), "every participant has their own bucket")
+	require.False(t, r.takeSysEx(bob, 1, 100, now))
+
+	// 10ms drain 31.25 bytes at sysExRate
+	now = now.Add(10 * time.Millisecond)
+	require.True(t, r.takeSysEx(alice, 50, 100, now))
+	require.InDelta(t, 78.75, r.sysEx[alice].level, 1e-9)
+	require.False(t, r.takeSysEx(alice, 101, 100, now.Add(time.Hour)), "never more than the burst at once")
+
+	r.forgetSysEx(alice)
+	require.NotContains(t, r.sysEx, alice)
+	require.Contains(t, r.sysEx, bob)
+}
@@ -0,0 +1,66 @@
+package jam
+
+import (
+	"math"
+	"time"
+)
+
+// BeatsPerBar is the number of beats in a bar of every jam.
+const BeatsPerBar = 4
+
+// transport is the shared clock of a live jam. It counts beats at the tempo
+// of the jam from the moment the jam went live.
+type transport struct {
+	at   time.Time // when beat was last computed
+	beat float64
+	bpm  uint
+}
+
+func newTransport(bpm uint) transport {
+	return transport{at: time.Now(), bpm: bpm}
+}
+
+// beatAt returns the position of the transport at the given time.
+func (t transport) beatAt(now time.Time) float64 {
+	return t.beat + now.Sub(t.at).Seconds()*float64(t.tempo())/60
+}
+
+// timeAt returns when the transport reaches the given beat at the current tempo.
+func (t transport) timeAt(beat float64) time.Time {
+	d := (beat - t.beat) * 60 / float64(t.tempo())
+	return t.at.Add(time.Duration(d * float64(time.Second)))
+}
+
+// setBPM changes the tempo from now on.
+func (t *transport) setBPM(now time.Time, bpm uint) {
+	t.beat, t.at, t.bpm = t.beatAt(now), now, bpm
+}
+
+func (t transport) tempo() uint {
+	if t.bpm == 0 {
+		return defaultBPM
+	}
+	return t.bpm
+}
+
+// Beat returns the position of the transport of the jam, in beats since
+// the jam went live.
+func (j *Jam) Beat() float64 {
+	j.Client()
+
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.transport.beatAt(time.Now())
+}
+
+// nextBeat returns the next beat of the transport that starts a multiple of n beats.
+func (j *Jam) nextBeat(n float64) float64 {
+	return math.Ceil(j.Beat()/n) * n
+}
+
+// timeAt returns when the transport of the jam reaches the given beat.
+func (j *Jam) timeAt(beat float64) time.Time {
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return j.room.transport.timeAt(beat)
+}
@@ -0,0 +1,108 @@
+package jam
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/websocket"
+)
+
+var ErrInvalidUMP = errors.New("UMP messages carry MIDI 1.0 or 2.0 channel voice packets")
+
+// handleUMP relays the MIDI 2.0 packets of a participant like their MIDI
+// messages: moved to their channels, fitted to the scale of the jam, and
+// recorded, looped and analyzed as MIDI messages. They are not quantized.
+func (j *Jam) handleUMP(from uuid.UUID, e *msg.Envelope) (*msg.Envelope, error) {
+	var u msg.UMPMsg
+	if err := e.Unwrap(&u); err != nil {
+		return nil, err
+	}
+
+	if len(u.Packets) == 0 {
+		return nil, ErrInvalidUMP
+	}
+	for _, p := range u.Packets {
+		if !p.Valid() {
+			return nil, ErrInvalidUMP
+		}
+	}
+
+	now := time.Now()
+
+	var notes []msg.MIDIMsg
+	j.room.mu.RLock()
+	for i, p := range u.Packets {
+		ch, err := j.room.channel(from, int(p.Channel()))
+		if err != nil {
+			j.room.mu.RUnlock()
+			return nil, err
+		}
+		p = p.WithChannel(uint8(ch))
+
+		if m, ok := p.MIDI(); ok {
+			if m, ok = j.fitScale(from, m); !ok {
+				j.room.mu.RUnlock()
+				return nil, ErrOutOfScale
+			}
+			p = p.WithNote(uint8(m.Number))
+			notes = append(notes, m)
+		} else if n, ok := p.Note(); ok {
+			// follow the notes snapped to the scale
+			p = p.WithNote(uint8(j.room.snappedNote(participantNote{from, int(p.Channel()), int(n)})))
+		}
+		u.Packets[i] = p
+	}
+	j.room.mu.RUnlock()
+
+	if err := e.SetPayload(u); err != nil {
+		return nil, err
+	}
+
+	chords := make([]*msg.ChordMsg, 0, len(notes))
+	for _, m := range notes {
+		chords = append(chords, j.relayMIDI(from, m, now))
+	}
+	return j.relayAnnounced(e, chords...)
+}
+
+// downconvert returns an encoder for connections that do not speak UMP,
+// sending them the notes of UMP envelopes as MIDI envelopes before next
+// encodes them, if not nil.
+func downconvert(next websocket.Encoder) websocket.Encoder {
+	encode := func(m *wsutil.Message) []*wsutil.Message {
+		if next == nil {
+			return []*wsutil.Message{m}
+		}
+		return next(m)
+	}
+
+	return func(m *wsutil.Message) []*wsutil.Message {
+		var e msg.Envelope
+		if m.OpCode != ws.OpText || json.Unmarshal(m.Payload, &e) != nil || e.Typ != msg.UMP {
+			return encode(m)
+		}
+
+		var u msg.UMPMsg
+		if err := e.Unwrap(&u); err != nil {
+			return nil
+		}
+
+		var out []*wsutil.Message
+		for _, p := range u.Packets {
+			note, ok := p.MIDI()
+			if !ok {
+				// per-note messages have no MIDI 1.0 equivalent
+				continue
+			}
+			if w, err := wrap(msg.MIDI, e.UserID, note); err == nil {
+				out = append(out, encode(w)...)
+			}
+		}
+		return out
+	}
+}
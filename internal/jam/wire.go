@@ -0,0 +1,217 @@
+package jam
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/rapidmidiex/rmx/pkg/websocket"
+)
+
+var ErrInvalidEncoding = errors.New("encoding must be one of: json, binary")
+
+// Encoding is how MIDI messages travel over the connection of a participant.
+// Every other message is always a JSON Envelope.
+type Encoding string
+
+const (
+	// EncodingJSON sends MIDI messages as JSON envelopes, like every other message.
+	EncodingJSON Encoding = "json"
+	// EncodingBinary sends MIDI messages as binary frames, see msg.Frame.
+	EncodingBinary Encoding = "binary"
+)
+
+func (e Encoding) Valid() bool {
+	return e == EncodingJSON || e == EncodingBinary
+}
+
+// Subprotocols a connection may negotiate with Sec-WebSocket-Protocol. They
+// name the version of package msg spoken and how messages are encoded, and
+// take precedence over the "encoding" query parameter.
+const (
+	// ProtocolJSON encodes every message as JSON.
+	ProtocolJSON = "rmx.v1.json"
+	// ProtocolBinary encodes MIDI messages as binary frames, and every other message as JSON.
+	ProtocolBinary = "rmx.v1.bin"
+	// ProtocolMessagePack encodes every message as MessagePack.
+	ProtocolMessagePack = "rmx.v1.msgpack"
+	// ProtocolCBOR encodes every message as CBOR.
+	ProtocolCBOR = "rmx.v1.cbor"
+
+	// Version 2 of the subprotocols adds UMP envelopes. Connections of
+	// version 1, or without a subprotocol, are sent the notes of UMP
+	// envelopes as MIDI envelopes.
+	ProtocolJSON2        = "rmx.v2.json"
+	ProtocolBinary2      = "rmx.v2.bin"
+	ProtocolMessagePack2 = "rmx.v2.msgpack"
+	ProtocolCBOR2        = "rmx.v2.cbor"
+)
+
+// Protocols are the subprotocols jams support.
+var Protocols = []string{
+	ProtocolJSON2, ProtocolBinary2, ProtocolMessagePack2, ProtocolCBOR2,
+	ProtocolJSON, ProtocolBinary, ProtocolMessagePack, ProtocolCBOR,
+}
+
+// protocol is how a subprotocol encodes messages.
+type protocol struct {
+	codec  msg.Codec
+	binary bool
+	ump    bool
+}
+
+var protocols = map[string]protocol{
+	ProtocolJSON:         {codec: msg.JSON},
+	ProtocolBinary:       {codec: msg.JSON, binary: true},
+	ProtocolMessagePack:  {codec: msg.MessagePack},
+	ProtocolCBOR:         {codec: msg.CBOR},
+	ProtocolJSON2:        {codec: msg.JSON, ump: true},
+	ProtocolBinary2:      {codec: msg.JSON, binary: true, ump: true},
+	ProtocolMessagePack2: {codec: msg.MessagePack, ump: true},
+	ProtocolCBOR2:        {codec: msg.CBOR, ump: true},
+}
+
+// handleProtocol sets up a connection for the subprotocol it negotiated.
+func (j *Jam) handleProtocol(id uuid.UUID, name string) []websocket.ConnOption {
+	p := protocols[name]
+
+	var (
+		enc  websocket.Encoder
+		opts []websocket.ConnOption
+	)
+	switch {
+	case p.binary:
+		enc = j.BinaryEncoder()
+	case p.codec != nil && p.codec != msg.JSON:
+		enc = codecEncoder(p.codec)
+		opts = append(opts, websocket.WithDecoder(codecDecoder(p.codec)))
+	}
+	if !p.ump {
+		enc = downconvert(enc)
+	}
+	return append(opts, websocket.WithEncoder(enc))
+}
+
+// Encoder returns the encoder of a connection without a subprotocol, which
+// chose its encoding with a query parameter instead.
+func (j *Jam) Encoder(e Encoding) websocket.Encoder {
+	if e == EncodingBinary {
+		return downconvert(j.BinaryEncoder())
+	}
+	return downconvert(nil)
+}
+
+// codecEncoder translates the JSON envelopes relayed to a jam into c, so that
+// clients using different codecs can share it.
+func codecEncoder(c msg.Codec) websocket.Encoder {
+	return func(m *wsutil.Message) []*wsutil.Message {
+		p, err := msg.Transcode(m.Payload, msg.JSON, c)
+		if err != nil {
+			// the client could not read it anyway
+			return nil
+		}
+		return []*wsutil.Message{{OpCode: ws.OpBinary, Payload: p}}
+	}
+}
+
+// codecDecoder translates the envelopes a client encoded with c into JSON.
+func codecDecoder(c msg.Codec) websocket.Decoder {
+	return func(m *wsutil.Message) (*wsutil.Message, error) {
+		p, err := msg.Transcode(m.Payload, c, msg.JSON)
+		if err != nil {
+			return nil, err
+		}
+		return &wsutil.Message{OpCode: ws.OpText, Payload: p}, nil
+	}
+}
+
+// shortID returns the short ID of a participant in binary frames, giving
+// them one if needed. The server is 0, and so is anyone once every short ID
+// was given out.
+func (j *Jam) shortID(id uuid.UUID) uint16 {
+	if id == uuid.Nil {
+		return 0
+	}
+
+	j.Client()
+
+	j.room.mu.Lock()
+	defer j.room.mu.Unlock()
+
+	if sid, ok := j.room.shortIDs[id]; ok {
+		return sid
+	}
+	if j.room.lastShortID == math.MaxUint16 {
+		return 0
+	}
+	j.room.lastShortID++
+	j.room.shortIDs[id] = j.room.lastShortID
+	return j.room.lastShortID
+}
+
+// BinaryEncoder returns the encoder of a connection that negotiated binary
+// frames. MIDI envelopes are sent as frames, each participant being
+// introduced with a PARTICIPANT envelope before their first frame.
+func (j *Jam) BinaryEncoder() websocket.Encoder {
+	var (
+		seq   uint32
+		known = make(map[uint16]bool)
+	)
+
+	return func(m *wsutil.Message) []*wsutil.Message {
+		var e msg.Envelope
+		if m.OpCode != ws.OpText || json.Unmarshal(m.Payload, &e) != nil || e.Typ != msg.MIDI {
+			return []*wsutil.Message{m}
+		}
+
+		f := msg.Frame{Typ: msg.MIDI, ShortID: j.shortID(e.UserID), Timestamp: j.sinceLive()}
+		if err := e.Unwrap(&f.MIDI); err != nil {
+			return []*wsutil.Message{m}
+		}
+
+		seq++
+		f.Seq = seq
+		p, err := f.MarshalBinary()
+		if err != nil {
+			return []*wsutil.Message{m}
+		}
+
+		var out []*wsutil.Message
+		if f.ShortID != 0 && !known[f.ShortID] {
+			known[f.ShortID] = true
+			intro := msg.ParticipantMsg{UserID: e.UserID, ShortID: f.ShortID}
+			if u, ok := j.User(e.UserID); ok {
+				intro.UserName = u.Username
+			}
+			if w, err := wrap(msg.PARTICIPANT, uuid.Nil, intro); err == nil {
+				out = append(out, w)
+			}
+		}
+		return append(out, &wsutil.Message{OpCode: ws.OpBinary, Payload: p})
+	}
+}
+
+// sinceLive returns the milliseconds since the jam went live, as sent in binary frames.
+func (j *Jam) sinceLive() uint32 {
+	j.room.mu.RLock()
+	defer j.room.mu.RUnlock()
+	return uint32(time.Since(j.room.live) / time.Millisecond)
+}
+
+// unframe decodes a binary frame sent by a participant into an envelope.
+// The sequence number, short ID and timestamp of the frame are not used,
+// the server knows who sent it and when.
+func unframe(from uuid.UUID, p []byte) (msg.Envelope, error) {
+	var f msg.Frame
+	if err := f.UnmarshalBinary(p); err != nil {
+		return msg.Envelope{}, err
+	}
+
+	e := msg.Envelope{ID: uuid.New(), Typ: f.Typ, UserID: from}
+	return e, e.SetPayload(f.MIDI)
+}
@@ -0,0 +1,188 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes envelopes and their payloads. The payload of an envelope is
+// always encoded with the codec of the envelope, see Encode and Decode.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSON is the codec of envelopes unless stated otherwise.
+	JSON Codec = jsonCodec{}
+	// MessagePack encodes envelopes as MessagePack, with the field names of JSON.
+	MessagePack Codec = msgpackCodec{}
+	// CBOR encodes envelopes as CBOR, with the field names of JSON.
+	CBOR Codec = cborCodec{}
+)
+
+// RawPayload is a payload encoded with the codec of its envelope. Like
+// json.RawMessage, it is embedded as is when the envelope is encoded.
+type RawPayload []byte
+
+func (p RawPayload) MarshalJSON() ([]byte, error) {
+	if p == nil {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+func (p *RawPayload) UnmarshalJSON(data []byte) error {
+	*p = append((*p)[0:0], data...)
+	return nil
+}
+
+func (p RawPayload) MarshalMsgpack() ([]byte, error) { return p, nil }
+
+func (p *RawPayload) UnmarshalMsgpack(data []byte) error {
+	*p = append((*p)[0:0], data...)
+	return nil
+}
+
+func (p RawPayload) MarshalCBOR() ([]byte, error) {
+	if p == nil {
+		return []byte{0xF6}, nil // null
+	}
+	return p, nil
+}
+
+func (p *RawPayload) UnmarshalCBOR(data []byte) error {
+	*p = append((*p)[0:0], data...)
+	return nil
+}
+
+// Decode reads an envelope encoded with c.
+func Decode(c Codec, data []byte) (Envelope, error) {
+	var e Envelope
+	if err := c.Unmarshal(data, &e); err != nil {
+		return Envelope{}, err
+	}
+	e.codec = c
+	return e, nil
+}
+
+// Encode writes an envelope with c, encoding its payload again if it was
+// encoded with another codec.
+func Encode(c Codec, e Envelope) ([]byte, error) {
+	if from := e.Codec(); from != c && e.Payload != nil {
+		v := newPayload(e.Typ)
+		if err := from.Unmarshal(e.Payload, v); err != nil {
+			return nil, fmt.Errorf("decode payload: %w", err)
+		}
+
+		p, err := c.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode payload: %w", err)
+		}
+		e.Payload, e.codec = p, c
+	}
+
+	return c.Marshal(e)
+}
+
+// Transcode encodes with another codec an envelope encoded with from.
+func Transcode(data []byte, from, to Codec) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+
+	e, err := Decode(from, data)
+	if err != nil {
+		return nil, fmt.Errorf("decode envelope: %w", err)
+	}
+	return Encode(to, e)
+}
+
+// newPayload returns a pointer to the payload of a type of message, so that
+// it keeps its types from one codec to another.
+func newPayload(typ MsgType) any {
+	switch typ {
+	case TEXT:
+		return &TextMsg{}
+	case MIDI:
+		return &MIDIMsg{}
+	case CONNECT:
+		return &ConnectMsg{}
+	case KICK:
+		return &KickMsg{}
+	case BAN:
+		return &BanMsg{}
+	case MUTE:
+		return &MuteMsg{}
+	case ERROR:
+		return &ErrorMsg{}
+	case WAITLIST:
+		return &WaitlistMsg{}
+	case RECORD:
+		return &RecordMsg{}
+	case PLAYBACK:
+		return &PlaybackMsg{}
+	case LOOP:
+		return &LoopMsg{}
+	case LOOPER:
+		return &LooperMsg{}
+	case STEP:
+		return &StepMsg{}
+	case SEQUENCER:
+		return &SequencerMsg{}
+	case ASSIGN:
+		return &AssignMsg{}
+	case SCALE:
+		return &ScaleMsg{}
+	case CHORD:
+		return &ChordMsg{}
+	case PARTICIPANT:
+		return &ParticipantMsg{}
+	case UMP:
+		return &UMPMsg{}
+	case MPE:
+		return &MPEMsg{}
+	case SYSEX:
+		return &SysExMsg{}
+	}
+
+	var v any
+	return &v
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type cborCodec struct{}
+
+// cborEnc keeps the precision of times, which CBOR encodes as whole seconds by default.
+var cborEnc, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+
+func (cborCodec) Marshal(v any) ([]byte, error) { return cborEnc.Marshal(v) }
+
+func (cborCodec) Unmarshal(data []byte, v any) error { return cbor.Unmarshal(data, v) }
@@ -0,0 +1,118 @@
+package msg_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs(t *testing.T) {
+	codecs := map[string]msg.Codec{
+		"JSON":        msg.JSON,
+		"MessagePack": msg.MessagePack,
+		"CBOR":        msg.CBOR,
+	}
+
+	payloads := map[msg.MsgType]any{
+		msg.TEXT: msg.TextMsg{DisplayName: "clara", Body: "Howdy"},
+		msg.MIDI: msg.MIDIMsg{State: msg.NOTE_ON, Number: 67, Velocity: 127, Channel: 9},
+		msg.CONNECT: msg.ConnectMsg{
+			UserID:   uuid.New(),
+			UserName: "clara",
+			Looper:   &msg.LooperMsg{UserID: uuid.New(), Bars: 4, Beat: 2.5},
+			Assignments: []msg.AssignMsg{
+				{UserID: uuid.New(), Channel: 3, Instrument: "Violin"},
+			},
+			ShortID: 7,
+		},
+		msg.SEQUENCER: msg.SequencerMsg{
+			Steps:        16,
+			StepsPerBeat: 4,
+			Tracks: []msg.SequencerTrack{
+				{Name: "Kick", Note: 36, Channel: 9, Steps: []msg.Step{{On: true, Velocity: 100, Gate: 0.5, Revision: 2}, {}}},
+			},
+		},
+		msg.CHORD: msg.ChordMsg{Name: "C/E", Root: "C", Bass: "E"},
+		msg.UMP: msg.UMPMsg{Packets: []msg.UMPPacket{
+			msg.NoteOn2(0, 1, 60, 0xFFFF),
+			msg.PerNotePitchBend2(0, 1, 60, msg.UMPPitchBendCenter),
+		}},
+		msg.SYSEX: msg.SysExMsg{Data: []byte{0x43, 0x00, 0x09, 0x20, 0x00, 0x7F}},
+	}
+
+	for name, c := range codecs {
+		c := c
+		t.Run(name+" round-trips envelopes and their payloads", func(t *testing.T) {
+			for typ, payload := range payloads {
+				e := msg.Envelope{ID: uuid.New(), Typ: typ, UserID: uuid.New()}
+				data, err := msg.Encode(c, e)
+				require.NoError(t, err)
+
+				// the payload is set once the codec of the envelope is known
+				e, err = msg.Decode(c, data)
+				require.NoError(t, err)
+				require.NoError(t, e.SetPayload(payload))
+
+				data, err = msg.Encode(c, e)
+				require.NoError(t, err)
+
+				got, err := msg.Decode(c, data)
+				require.NoError(t, err)
+				require.Equal(t, e.ID, got.ID)
+				require.Equal(t, typ, got.Typ)
+				require.Equal(t, e.UserID, got.UserID)
+
+				unwrapped := reflect.New(reflect.TypeOf(payload))
+				require.NoError(t, got.Unwrap(unwrapped.Interface()))
+				require.Equal(t, payload, unwrapped.Elem().Interface(), "payload of type %d", typ)
+			}
+		})
+
+		t.Run(name+" keeps the precision of times", func(t *testing.T) {
+			sent := msg.ChatMsg{ID: uuid.New(), Body: "late", SentAt: time.Date(2023, 5, 1, 12, 30, 15, 123456789, time.UTC)}
+
+			e, err := msg.Decode(c, mustEncode(t, c, msg.Envelope{}))
+			require.NoError(t, err)
+			require.NoError(t, e.SetPayload(sent))
+
+			var got msg.ChatMsg
+			require.NoError(t, e.Unwrap(&got))
+			require.True(t, sent.SentAt.Equal(got.SentAt))
+		})
+	}
+
+	t.Run("translates between codecs", func(t *testing.T) {
+		want := msg.Envelope{ID: uuid.New(), Typ: msg.CONNECT, UserID: uuid.New()}
+		require.NoError(t, want.SetPayload(payloads[msg.CONNECT]))
+
+		data, err := msg.Encode(msg.JSON, want)
+		require.NoError(t, err)
+
+		for _, hop := range []struct{ from, to msg.Codec }{
+			{msg.JSON, msg.MessagePack},
+			{msg.MessagePack, msg.CBOR},
+			{msg.CBOR, msg.JSON},
+		} {
+			data, err = msg.Transcode(data, hop.from, hop.to)
+			require.NoError(t, err)
+		}
+
+		got, err := msg.Decode(msg.JSON, data)
+		require.NoError(t, err)
+		require.Equal(t, want.ID, got.ID)
+
+		var c msg.ConnectMsg
+		require.NoError(t, got.Unwrap(&c))
+		require.Equal(t, payloads[msg.CONNECT], c)
+	})
+}
+
+func mustEncode(t *testing.T, c msg.Codec, e msg.Envelope) []byte {
+	data, err := msg.Encode(c, e)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,89 @@
+package msg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// FrameHeaderSize is the length of the header of a binary frame, in bytes.
+const FrameHeaderSize = 11
+
+var (
+	ErrShortFrame      = errors.New("binary frame is too short")
+	ErrFrameType       = errors.New("binary frames only carry MIDI messages")
+	ErrUnsupportedMIDI = errors.New("binary frames only carry notes, control changes, channel pressure and pitch bends")
+	ErrInvalidFrame    = errors.New("binary frame carries an invalid MIDI message")
+)
+
+// Frame is the compact binary encoding of a MIDI message, sent in place of a
+// JSON Envelope to connections that negotiated it. A frame is a header
+// followed by the raw MIDI bytes of the message, all integers big-endian:
+//
+//	offset  size  field
+//	0       1     type, always MIDI
+//	1       4     sequence number
+//	5       2     short ID of the participant, 0 for the server
+//	7       4     timestamp in milliseconds
+//	11      3     status and data bytes of the MIDI message, padded to 3 bytes
+type Frame struct {
+	Typ MsgType
+	// Incremented for every frame sent on a connection, so that clients can
+	// tell frames were dropped.
+	Seq uint32
+	// Short ID of the participant who played the message, see ParticipantMsg.
+	ShortID uint16
+	// Milliseconds since the jam went live in frames sent by the server,
+	// frames sent by clients may use any clock.
+	Timestamp uint32
+	MIDI      MIDIMsg
+}
+
+func (f Frame) MarshalBinary() ([]byte, error) {
+	if f.Typ != MIDI {
+		return nil, ErrFrameType
+	}
+	if !f.MIDI.Valid() {
+		return nil, ErrInvalidFrame
+	}
+
+	p := make([]byte, FrameHeaderSize+3)
+	p[0] = byte(f.Typ)
+	binary.BigEndian.PutUint32(p[1:5], f.Seq)
+	binary.BigEndian.PutUint16(p[5:7], f.ShortID)
+	binary.BigEndian.PutUint32(p[7:11], f.Timestamp)
+
+	copy(p[11:], f.MIDI.Bytes())
+	return p, nil
+}
+
+func (f *Frame) UnmarshalBinary(p []byte) error {
+	if len(p) < FrameHeaderSize {
+		return ErrShortFrame
+	}
+
+	f.Typ = MsgType(p[0])
+	if f.Typ != MIDI {
+		return ErrFrameType
+	}
+	if len(p) != FrameHeaderSize+3 {
+		return fmt.Errorf("%w: MIDI frames are %d bytes long", ErrShortFrame, FrameHeaderSize+3)
+	}
+
+	f.Seq = binary.BigEndian.Uint32(p[1:5])
+	f.ShortID = binary.BigEndian.Uint16(p[5:7])
+	f.Timestamp = binary.BigEndian.Uint32(p[7:11])
+
+	if p[12] > 127 || p[13] > 127 {
+		return ErrInvalidFrame
+	}
+	var ok bool
+	if f.MIDI, ok = ParseMIDI(p[11:]); !ok {
+		return ErrUnsupportedMIDI
+	}
+
+	if !f.MIDI.Valid() {
+		return ErrInvalidFrame
+	}
+	return nil
+}
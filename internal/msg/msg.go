@@ -2,24 +2,29 @@
 package msg
 
 import (
-	"encoding/json"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type (
-	MsgType   int
-	NoteState int
+	MsgType    int
+	NoteState  int
+	LoopAction int
 
 	Envelope struct {
 		// Message identifier
 		ID uuid.UUID `json:"id"`
-		// TextMsg | MIDIMsg | ConnectMsg
+		// TextMsg | MIDIMsg | ConnectMsg | KickMsg | BanMsg | MuteMsg | ErrorMsg | WaitlistMsg | RecordMsg | PlaybackMsg | LoopMsg | LooperMsg | StepMsg | SequencerMsg | AssignMsg | ScaleMsg | ChordMsg | ParticipantMsg | UMPMsg | MPEMsg | SysExMsg
 		Typ MsgType `json:"type"`
 		// RMX client identifier
 		UserID uuid.UUID `json:"userId"`
 		// Actual message data.
-		Payload json.RawMessage `json:"payload"`
+		Payload RawPayload `json:"payload"`
+
+		// codec of the payload, JSON if nil
+		codec Codec
 	}
 
 	TextMsg struct {
@@ -30,14 +35,270 @@ type (
 	MIDIMsg struct {
 		State NoteState `json:"state"`
 		// MIDI Note # in "C3 Convention", C3 = 60. Available values: (0-127)
+		// The controller of a control change.
 		Number int `json:"number"`
 		// MIDI Velocity (0-127)
 		Velocity int `json:"velocity"`
+		// MIDI Channel (0-15)
+		Channel int `json:"channel,omitempty"`
+		// Value of a control change or channel pressure (0-127), or of a
+		// pitch bend (0-16383), PitchBendCenter not bending.
+		Value int `json:"value,omitempty"`
 	}
 
+	// ConnectMsg is sent by the server to a client when it joins a jam.
 	ConnectMsg struct {
 		UserID   uuid.UUID `json:"userId"`
 		UserName string    `json:"userName"`
+		// Most recent chat messages of the jam, oldest first.
+		History []ChatMsg `json:"history,omitempty"`
+		// Whether the jam is being recorded.
+		Recording bool `json:"recording,omitempty"`
+		// Recording being played back into the jam, if any.
+		Playback *PlaybackMsg `json:"playback,omitempty"`
+		// Backing track being played into the jam, if any.
+		Backing *PlaybackMsg `json:"backing,omitempty"`
+		// Looper of the jam, if a loop is armed or playing.
+		Looper *LooperMsg `json:"looper,omitempty"`
+		// Step sequencer of the jam, if any.
+		Sequencer *SequencerMsg `json:"sequencer,omitempty"`
+		// Channel and instrument of every participant who has one.
+		Assignments []AssignMsg `json:"assignments,omitempty"`
+		// Key and scale of the jam, if it has a key.
+		Scale *ScaleMsg `json:"scale,omitempty"`
+		// Chord being played in the jam, if any.
+		Chord *ChordMsg `json:"chord,omitempty"`
+		// MPE zones of the participants who declared one.
+		Zones []MPEMsg `json:"zones,omitempty"`
+		// Short ID of the participant in binary frames.
+		ShortID uint16 `json:"shortId,omitempty"`
+	}
+
+	// ChatMsg is a TextMsg as stored by the server.
+	ChatMsg struct {
+		ID          uuid.UUID `json:"id"`
+		UserID      uuid.UUID `json:"userId"`
+		DisplayName string    `json:"displayName"`
+		Body        string    `json:"body"`
+		SentAt      time.Time `json:"sentAt"`
+	}
+
+	// KickMsg disconnects a participant from the jam. Host only.
+	KickMsg struct {
+		UserID uuid.UUID `json:"userId"`
+	}
+
+	// BanMsg disconnects a participant and prevents them from rejoining the jam. Host only.
+	BanMsg struct {
+		UserID uuid.UUID `json:"userId"`
+	}
+
+	// MuteMsg sets which messages of a participant are dropped by the server.
+	// Sending it with both fields false unmutes the participant. Host only.
+	MuteMsg struct {
+		UserID uuid.UUID `json:"userId"`
+		MIDI   bool      `json:"midi"`
+		Text   bool      `json:"text"`
+	}
+
+	// ErrorMsg is sent by the server to a client whose message was rejected.
+	ErrorMsg struct {
+		Message string `json:"message"`
+	}
+
+	// WaitlistMsg is sent by the server to a client waiting for a seat in a full jam.
+	WaitlistMsg struct {
+		// Position in the waitlist, starting at 1. 0 means the client was given a seat.
+		Position int `json:"position"`
+	}
+
+	// RecordMsg is broadcast by the server when a recording of the jam starts or stops.
+	RecordMsg struct {
+		RecordingID uuid.UUID `json:"recordingId"`
+		Recording   bool      `json:"recording"`
+	}
+
+	// PlaybackMsg is broadcast by the server when the playback of a recording
+	// or backing track into the jam starts, stops, or is paused, looped, muted or moved.
+	PlaybackMsg struct {
+		RecordingID uuid.UUID `json:"recordingId"`
+		// Virtual participant the recording is played back as.
+		UserID  uuid.UUID `json:"userId"`
+		Playing bool      `json:"playing"`
+		Paused  bool      `json:"paused"`
+		Loop    bool      `json:"loop"`
+		// Position of the playback from the start of the recording, in beats.
+		Beat float64 `json:"beat"`
+		// Length of the recording in beats.
+		Length float64 `json:"length"`
+		// Whether a backing track is played rather than a recording,
+		// RecordingID is then the id of the backing track.
+		Backing bool `json:"backing,omitempty"`
+		// Names of the tracks of the recording, one per participant for a recording.
+		Tracks []string `json:"tracks,omitempty"`
+		// Indexes of the tracks that are muted.
+		Muted []int `json:"muted,omitempty"`
+	}
+
+	// LoopMsg is sent by a client to control the looper of the jam.
+	// Undo and clear are reserved to the host and, respectively, the player
+	// of the last layer and the player who armed the loop.
+	LoopMsg struct {
+		Action LoopAction `json:"action"`
+		// Length of the loop to arm, in bars.
+		Bars int `json:"bars,omitempty"`
+	}
+
+	// LooperMsg is broadcast by the server when the looper of the jam changes.
+	// It is empty once the loop is cleared.
+	LooperMsg struct {
+		// Virtual participant the loop is played back as.
+		UserID uuid.UUID `json:"userId"`
+		Bars   int       `json:"bars"`
+		// Beat of the transport the first cycle of the loop started on.
+		Start float64 `json:"start"`
+		// Beat of the transport when the message was sent.
+		Beat float64 `json:"beat"`
+		// Participant whose MIDI is being captured, if any,
+		// from beat CaptureFrom up to beat CaptureTo of the transport.
+		Capturing   uuid.UUID `json:"capturing"`
+		CaptureFrom float64   `json:"captureFrom,omitempty"`
+		CaptureTo   float64   `json:"captureTo,omitempty"`
+		// Layers of the loop, oldest first.
+		Layers []LoopLayer `json:"layers"`
+	}
+
+	// LoopLayer is a pass of a player captured by the looper.
+	LoopLayer struct {
+		UserID   uuid.UUID `json:"userId"`
+		UserName string    `json:"userName"`
+	}
+
+	// AssignMsg sets the MIDI channel and instrument of a participant, every
+	// MIDI message they send is then played on that channel. Two participants
+	// cannot share a channel. Players may assign themselves, the host anyone.
+	AssignMsg struct {
+		// Participant to assign, the sender if left out.
+		UserID  uuid.UUID `json:"userId"`
+		Channel int       `json:"channel"`
+		// General MIDI program (0-127), if any.
+		Program *int `json:"program,omitempty"`
+		// Label of the instrument, the name of the program if left out.
+		Instrument string `json:"instrument,omitempty"`
+		// Removes the assignment of the participant, freeing their channel.
+		Unassign bool `json:"unassign,omitempty"`
+	}
+
+	// ScaleMsg is broadcast by the server when the key or scale of the jam changes.
+	ScaleMsg struct {
+		// Note name of the key, such as "D" or "F#", empty if the jam has no key.
+		Key   string `json:"key"`
+		Scale string `json:"scale,omitempty"`
+		// What happens to notes out of the scale: "off", "reject" or "snap".
+		Mode string `json:"mode"`
+		// Pitch classes of the scale from the key, C being 0, for clients to
+		// show on their keyboards.
+		Notes []int `json:"notes,omitempty"`
+	}
+
+	// ChordMsg is broadcast by the server when the chord made by the notes held
+	// across the jam changes. It is empty when the notes do not make a chord.
+	ChordMsg struct {
+		// Name of the chord, such as "Am7" or "C/E".
+		Name string `json:"name"`
+		// Note names of the root and of the lowest note of the chord.
+		Root string `json:"root"`
+		Bass string `json:"bass"`
+	}
+
+	// ParticipantMsg is sent by the server to a connection using binary frames
+	// before the first frame of a participant, to tell who its short ID stands for.
+	ParticipantMsg struct {
+		UserID   uuid.UUID `json:"userId"`
+		UserName string    `json:"userName"`
+		ShortID  uint16    `json:"shortId"`
+	}
+
+	// UMPMsg carries MIDI 2.0 channel voice messages, played at once.
+	// Participants whose subprotocol predates it are sent the notes and
+	// expression of the packets as MIDI messages.
+	UMPMsg struct {
+		Packets []UMPPacket `json:"packets"`
+	}
+
+	// MPEMsg declares the MPE zone of the instrument of a participant. The
+	// server gives the master and member channels of the zone their own
+	// channels in the jam, in place of the channel assigned to the
+	// participant, and broadcasts the zone with them. Players may declare
+	// their own zone, the host anyone's. A zone without members is removed.
+	MPEMsg struct {
+		// Participant of the zone, the sender if left out.
+		UserID uuid.UUID `json:"userId"`
+		// "lower" zones have their master channel on 0 and their member
+		// channels from 1 up, "upper" zones on 15 and from 14 down.
+		Zone    string `json:"zone"`
+		Members int    `json:"members"`
+		// Pitch bend range of the member channels in semitones, 48 if left out.
+		BendRange int `json:"bendRange,omitempty"`
+		// Channels of the jam the master and member channels are played on,
+		// set by the server.
+		Master   int   `json:"master"`
+		Channels []int `json:"channels,omitempty"`
+	}
+
+	// SysExMsg carries a System Exclusive message for the hardware of the
+	// other participants, such as a patch dump. The server only relays the
+	// manufacturers allowed in the jam, up to the size set for the jam.
+	SysExMsg struct {
+		// Bytes between the F0 and F7 bytes of the message, starting with
+		// the manufacturer ID. Base64 in JSON.
+		Data []byte `json:"data"`
+	}
+
+	// StepMsg is sent by a client to toggle a step of the step sequencer.
+	// It is rejected if the step changed since the revision the client saw.
+	StepMsg struct {
+		Track int `json:"track"`
+		Step  int `json:"step"`
+		// Revision of the step sequencer the client toggled the step in.
+		Revision int `json:"revision"`
+		// Velocity and gate of a step turned on, defaults are used if left out.
+		Velocity int     `json:"velocity,omitempty"`
+		Gate     float64 `json:"gate,omitempty"`
+	}
+
+	// SequencerMsg is broadcast by the server when the step sequencer of the jam changes.
+	// It is empty once the step sequencer is removed.
+	SequencerMsg struct {
+		// Virtual participant the pattern is played as.
+		UserID uuid.UUID `json:"userId"`
+		// Incremented on every change.
+		Revision int `json:"revision"`
+		// Number of steps of every track, and how many of them fit in a beat.
+		Steps        int  `json:"steps"`
+		StepsPerBeat int  `json:"stepsPerBeat"`
+		Playing      bool `json:"playing"`
+		// Beat of the transport the pattern started on, while playing.
+		Start  float64          `json:"start,omitempty"`
+		Tracks []SequencerTrack `json:"tracks"`
+	}
+
+	// SequencerTrack is a row of the step sequencer, playing a single note.
+	SequencerTrack struct {
+		Name    string `json:"name"`
+		Note    int    `json:"note"`
+		Channel int    `json:"channel,omitempty"`
+		Steps   []Step `json:"steps"`
+	}
+
+	// Step is a cell of the step sequencer.
+	Step struct {
+		On       bool `json:"on"`
+		Velocity int  `json:"velocity,omitempty"`
+		// Length of the note, as a fraction of the step (0-1].
+		Gate float64 `json:"gate,omitempty"`
+		// Revision of the step sequencer the step last changed in.
+		Revision int `json:"revision,omitempty"`
 	}
 )
 
@@ -45,15 +306,167 @@ const (
 	TEXT MsgType = iota
 	MIDI
 	CONNECT
+	KICK
+	BAN
+	MUTE
+	ERROR
+	WAITLIST
+	RECORD
+	PLAYBACK
+	LOOP
+	LOOPER
+	STEP
+	SEQUENCER
+	ASSIGN
+	SCALE
+	CHORD
+	PARTICIPANT
+	UMP
+	MPE
+	SYSEX
 )
 
+var msgTypeNames = [...]string{
+	TEXT:        "TEXT",
+	MIDI:        "MIDI",
+	CONNECT:     "CONNECT",
+	KICK:        "KICK",
+	BAN:         "BAN",
+	MUTE:        "MUTE",
+	ERROR:       "ERROR",
+	WAITLIST:    "WAITLIST",
+	RECORD:      "RECORD",
+	PLAYBACK:    "PLAYBACK",
+	LOOP:        "LOOP",
+	LOOPER:      "LOOPER",
+	STEP:        "STEP",
+	SEQUENCER:   "SEQUENCER",
+	ASSIGN:      "ASSIGN",
+	SCALE:       "SCALE",
+	CHORD:       "CHORD",
+	PARTICIPANT: "PARTICIPANT",
+	UMP:         "UMP",
+	MPE:         "MPE",
+	SYSEX:       "SYSEX",
+}
+
+// String returns the name of the constant of the type.
+func (t MsgType) String() string {
+	if t < 0 || int(t) >= len(msgTypeNames) {
+		return "MsgType(" + strconv.Itoa(int(t)) + ")"
+	}
+	return msgTypeNames[t]
+}
+
 const (
 	NOTE_OFF NoteState = iota
 	NOTE_ON
+	// Expression messages, carrying a Value rather than a velocity. MPE
+	// instruments send them on the member channel of a single note.
+	CONTROL_CHANGE
+	PITCH_BEND
+	CHANNEL_PRESSURE
+)
+
+const (
+	// PitchBendCenter is the value of a pitch bend that does not bend.
+	PitchBendCenter = 8192
+	// TimbreController is the control change MPE instruments send timbre with.
+	TimbreController = 74
+)
+
+const (
+	// LOOP_ARM starts a new loop, capturing the sender from the next bar.
+	LOOP_ARM LoopAction = iota
+	// LOOP_OVERDUB captures a new layer of the sender from the next bar.
+	LOOP_OVERDUB
+	// LOOP_UNDO removes the last layer, or cancels the capture in progress.
+	LOOP_UNDO
+	// LOOP_CLEAR stops and empties the loop.
+	LOOP_CLEAR
 )
 
+// Valid reports whether the note number, velocity, channel and value are in range.
+func (m MIDIMsg) Valid() bool {
+	max := 127
+	switch m.State {
+	case NOTE_OFF, NOTE_ON, CONTROL_CHANGE, CHANNEL_PRESSURE:
+	case PITCH_BEND:
+		max = 16383
+	default:
+		return false
+	}
+
+	return m.Number >= 0 && m.Number <= 127 &&
+		m.Velocity >= 0 && m.Velocity <= 127 &&
+		m.Channel >= 0 && m.Channel <= 15 &&
+		m.Value >= 0 && m.Value <= max
+}
+
+// IsNote reports whether the message turns a note on or off.
+func (m MIDIMsg) IsNote() bool {
+	return m.State == NOTE_ON || m.State == NOTE_OFF
+}
+
+// Bytes returns the status and data bytes of the message, as sent to hardware.
+func (m MIDIMsg) Bytes() []byte {
+	ch := byte(m.Channel)
+	switch m.State {
+	case NOTE_OFF:
+		return []byte{0x80 | ch, byte(m.Number), byte(m.Velocity)}
+	case NOTE_ON:
+		return []byte{0x90 | ch, byte(m.Number), byte(m.Velocity)}
+	case CONTROL_CHANGE:
+		return []byte{0xB0 | ch, byte(m.Number), byte(m.Value)}
+	case CHANNEL_PRESSURE:
+		return []byte{0xD0 | ch, byte(m.Value)}
+	case PITCH_BEND:
+		return []byte{0xE0 | ch, byte(m.Value & 0x7F), byte(m.Value >> 7)}
+	}
+	return nil
+}
+
+// ParseMIDI returns the message of the status and data bytes p starts with.
+// It reports false if they are not a message MIDIMsg carries: a note,
+// control change, channel pressure or pitch bend. Bytes past the message
+// are ignored.
+func ParseMIDI(p []byte) (MIDIMsg, bool) {
+	if len(p) < 2 || (len(p) < 3 && p[0]&0xF0 != 0xD0) {
+		return MIDIMsg{}, false
+	}
+	d1, d2 := int(p[1]), 0
+	if len(p) > 2 && p[0]&0xF0 != 0xD0 {
+		d2 = int(p[2])
+	}
+
+	m := MIDIMsg{Channel: int(p[0] & 0x0F)}
+	switch p[0] & 0xF0 {
+	case 0x80:
+		m.State, m.Number, m.Velocity = NOTE_OFF, d1, d2
+	case 0x90:
+		m.State, m.Number, m.Velocity = NOTE_ON, d1, d2
+	case 0xB0:
+		m.State, m.Number, m.Value = CONTROL_CHANGE, d1, d2
+	case 0xD0:
+		m.State, m.Value = CHANNEL_PRESSURE, d1
+	case 0xE0:
+		m.State, m.Value = PITCH_BEND, d2<<7|d1
+	default:
+		return MIDIMsg{}, false
+	}
+	return m, d1 <= 127 && d2 <= 127
+}
+
+// Codec returns the codec the payload of the envelope is encoded with.
+func (e *Envelope) Codec() Codec {
+	if e.codec == nil {
+		return JSON
+	}
+	return e.codec
+}
+
 func (e *Envelope) SetPayload(payload any) error {
-	p, err := json.Marshal(payload)
+	p, err := e.Codec().Marshal(payload)
 	if err != nil {
 		return err
 	}
@@ -62,5 +475,5 @@ func (e *Envelope) SetPayload(payload any) error {
 }
 
 func (e *Envelope) Unwrap(msg any) error {
-	return json.Unmarshal(e.Payload, msg)
+	return e.Codec().Unmarshal(e.Payload, msg)
 }
@@ -44,3 +44,175 @@ func TestEnvelope(t *testing.T) {
 		require.Equal(t, payload, got)
 	})
 }
+
+func TestFrame(t *testing.T) {
+	t.Run("round-trips MIDI messages", func(t *testing.T) {
+		f := msg.Frame{
+			Typ:       msg.MIDI,
+			Seq:       70000,
+			ShortID:   513,
+			Timestamp: 123456789,
+			MIDI:      msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 100, Channel: 3},
+		}
+
+		p, err := f.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, p, msg.FrameHeaderSize+3)
+		require.Equal(t, []byte{0x93, 60, 100}, p[msg.FrameHeaderSize:], "raw MIDI follows the header")
+
+		var got msg.Frame
+		require.NoError(t, got.UnmarshalBinary(p))
+		require.Equal(t, f, got)
+	})
+
+	t.Run("round-trips expression messages", func(t *testing.T) {
+		for _, m := range []msg.MIDIMsg{
+			{State: msg.CONTROL_CHANGE, Number: msg.TimbreController, Value: 90, Channel: 2},
+			{State: msg.CHANNEL_PRESSURE, Value: 64, Channel: 3},
+			{State: msg.PITCH_BEND, Value: 12000, Channel: 4},
+		} {
+			f := msg.Frame{Typ: msg.MIDI, MIDI: m}
+			p, err := f.MarshalBinary()
+			require.NoError(t, err)
+
+			var got msg.Frame
+			require.NoError(t, got.UnmarshalBinary(p))
+			require.Equal(t, f, got)
+		}
+	})
+
+	t.Run("rejects what it cannot carry", func(t *testing.T) {
+		_, err := msg.Frame{Typ: msg.TEXT}.MarshalBinary()
+		require.ErrorIs(t, err, msg.ErrFrameType)
+
+		var f msg.Frame
+		require.ErrorIs(t, f.UnmarshalBinary([]byte{byte(msg.MIDI), 0, 0}), msg.ErrShortFrame)
+
+		p := make([]byte, msg.FrameHeaderSize+3)
+		p[0], p[msg.FrameHeaderSize] = byte(msg.MIDI), 0xF0
+		require.ErrorIs(t, f.UnmarshalBinary(p), msg.ErrUnsupportedMIDI, "system messages are not relayed")
+	})
+}
+
+func TestUMP(t *testing.T) {
+	t.Run("lays out MIDI 2.0 packets", func(t *testing.T) {
+		p := msg.NoteOn2(1, 3, 60, 0xABCD)
+		require.Equal(t, msg.UMPPacket{0x41933C00, 0xABCD0000}, p)
+		require.True(t, p.Valid())
+		require.Equal(t, msg.UMPMIDI2, p.Type())
+		require.Equal(t, uint8(1), p.Group())
+		require.Equal(t, uint8(3), p.Channel())
+		require.Equal(t, uint16(0xABCD), p.Velocity())
+
+		note, ok := msg.PerNotePitchBend2(0, 0, 64, msg.UMPPitchBendCenter).Note()
+		require.True(t, ok)
+		require.Equal(t, uint8(64), note)
+
+		c := msg.PerNoteController2(0, 2, 64, 74, 0xFFFFFFFF, false)
+		require.Equal(t, msg.UMPAssignablePerNoteController, c.Status())
+		require.Equal(t, uint32(0xFFFFFFFF), c.Value())
+		require.Equal(t, uint8(5), c.WithChannel(5).Channel())
+		require.Equal(t, uint8(2), c.Channel(), "packets are copied")
+	})
+
+	t.Run("rejects what is not a channel voice message", func(t *testing.T) {
+		require.False(t, msg.UMPPacket{}.Valid())
+		require.False(t, msg.UMPPacket{0x10F80000}.Valid(), "system messages are not relayed")
+		require.False(t, msg.UMPPacket{0x40903C00}.Valid(), "MIDI 2.0 packets are 64 bits")
+		require.False(t, msg.UMPPacket{0x20908000}.Valid(), "note numbers are 7 bits")
+	})
+
+	t.Run("downconverts to MIDI messages", func(t *testing.T) {
+		m, ok := msg.NoteOn2(0, 9, 36, 0xFFFF).MIDI()
+		require.True(t, ok)
+		require.Equal(t, msg.MIDIMsg{State: msg.NOTE_ON, Number: 36, Velocity: 127, Channel: 9}, m)
+
+		m, ok = msg.NoteOn2(0, 0, 60, 0x00FF).MIDI()
+		require.True(t, ok)
+		require.Equal(t, 1, m.Velocity, "soft notes are still played")
+
+		silent, ok := msg.UMPFromMIDI(0, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60}).Upconvert()
+		require.True(t, ok)
+		require.Equal(t, msg.UMPNoteOff, silent.Status(), "note ons without velocity are note offs")
+
+		m, ok = msg.ControlChange2(0, 2, msg.TimbreController, 0xFFFFFFFF).MIDI()
+		require.True(t, ok)
+		require.Equal(t, msg.MIDIMsg{State: msg.CONTROL_CHANGE, Number: msg.TimbreController, Value: 127, Channel: 2}, m)
+
+		_, ok = msg.PerNotePitchBend2(0, 0, 60, 0).MIDI()
+		require.False(t, ok)
+	})
+
+	t.Run("round-trips MIDI 1.0 packets losslessly", func(t *testing.T) {
+		for v := uint8(0); v < 128; v++ {
+			for _, p := range []msg.UMPPacket{
+				msg.UMPFromMIDI(2, msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: int(v) | 1, Channel: 4}),
+				msg.UMPFromMIDI(2, msg.MIDIMsg{State: msg.NOTE_OFF, Number: int(v), Velocity: int(v)}),
+				{0x22B00100 | uint32(v)},                // modulation
+				{0x22D00000 | uint32(v)<<8},             // channel pressure
+				{0x22E00000 | uint32(v)<<8 | uint32(v)}, // pitch bend
+			} {
+				up, ok := p.Upconvert()
+				require.True(t, ok)
+				require.Equal(t, msg.UMPMIDI2, up.Type())
+
+				down, ok := up.Downconvert()
+				require.True(t, ok)
+				require.Equal(t, p, down)
+			}
+		}
+
+		up, _ := msg.UMPPacket{0x22B0017F}.Upconvert()
+		require.Equal(t, uint32(0xFFFFFFFF), up.Value(), "the maximum scales to the maximum")
+		up, _ = msg.UMPPacket{0x22E00040}.Upconvert()
+		require.Equal(t, uint32(msg.UMPPitchBendCenter), up.Value(), "the center scales to the center")
+	})
+
+	t.Run("cannot downconvert per-note messages", func(t *testing.T) {
+		_, ok := msg.PerNotePitchBend2(0, 0, 60, 0).Downconvert()
+		require.False(t, ok)
+		_, ok = msg.PerNoteController2(0, 0, 60, 74, 0, false).Downconvert()
+		require.False(t, ok)
+	})
+}
+
+func TestSysEx(t *testing.T) {
+	t.Run("reads the manufacturer ID", func(t *testing.T) {
+		id, ok := msg.SysExMsg{Data: []byte{0x43, 0x10, 0x01}}.Manufacturer()
+		require.True(t, ok)
+		require.Equal(t, msg.Manufacturer("43"), id)
+
+		id, ok = msg.SysExMsg{Data: []byte{0x00, 0x20, 0x33, 0x01}}.Manufacturer()
+		require.True(t, ok)
+		require.Equal(t, msg.Manufacturer("002033"), id, "IDs starting with 00 are 3 bytes")
+
+		_, ok = msg.SysExMsg{Data: []byte{0x00, 0x20}}.Manufacturer()
+		require.False(t, ok)
+	})
+
+	t.Run("parses manufacturer IDs", func(t *testing.T) {
+		for s, want := range map[string]msg.Manufacturer{
+			"43":       "43",
+			"00 20 33": "002033",
+			"7E":       msg.UniversalNonRealTime,
+		} {
+			id, ok := msg.ParseManufacturer(s)
+			require.True(t, ok, s)
+			require.Equal(t, want, id)
+		}
+
+		for _, s := range []string{"", "80", "4310", "0020", "000000", "yamaha"} {
+			_, ok := msg.ParseManufacturer(s)
+			require.False(t, ok, s)
+		}
+	})
+
+	t.Run("only holds data bytes", func(t *testing.T) {
+		m := msg.SysExMsg{Data: []byte{0x41, 0x10, 0x42, 0x12}}
+		require.True(t, m.Valid())
+		require.Equal(t, []byte{0xF0, 0x41, 0x10, 0x42, 0x12, 0xF7}, m.Bytes())
+
+		require.False(t, msg.SysExMsg{}.Valid())
+		require.False(t, msg.SysExMsg{Data: []byte{0x41, 0xF7}}.Valid(), "framing bytes are left out")
+	})
+}
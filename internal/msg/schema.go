@@ -0,0 +1,357 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Version of the messages of the package, named by the subprotocols of jams
+// and by their JSON Schema and TypeScript definitions.
+const Version = 2
+
+type enumValue struct {
+	name  string
+	value int
+}
+
+// enums are the constants of the integer types of payloads. MsgType is
+// added from its names.
+var enums = map[reflect.Type][]enumValue{
+	reflect.TypeOf(NoteState(0)): {
+		{"NOTE_OFF", int(NOTE_OFF)},
+		{"NOTE_ON", int(NOTE_ON)},
+		{"CONTROL_CHANGE", int(CONTROL_CHANGE)},
+		{"PITCH_BEND", int(PITCH_BEND)},
+		{"CHANNEL_PRESSURE", int(CHANNEL_PRESSURE)},
+	},
+	reflect.TypeOf(LoopAction(0)): {
+		{"LOOP_ARM", int(LOOP_ARM)},
+		{"LOOP_OVERDUB", int(LOOP_OVERDUB)},
+		{"LOOP_UNDO", int(LOOP_UNDO)},
+		{"LOOP_CLEAR", int(LOOP_CLEAR)},
+	},
+}
+
+var (
+	msgTypeType  = reflect.TypeOf(MsgType(0))
+	envelopeType = reflect.TypeOf(Envelope{})
+	uuidType     = reflect.TypeOf(uuid.UUID{})
+	timeType     = reflect.TypeOf(time.Time{})
+	payloadType  = reflect.TypeOf(RawPayload{})
+	bytesType    = reflect.TypeOf([]byte{})
+)
+
+func init() {
+	for t, name := range msgTypeNames {
+		enums[msgTypeType] = append(enums[msgTypeType], enumValue{name, t})
+	}
+}
+
+// protocol is the definitions of envelopes and of the types of their payloads.
+type protocol struct {
+	// payloads by type of message
+	payloads []reflect.Type
+	// named types, in the order they are first seen from the envelope
+	types []reflect.Type
+	seen  map[reflect.Type]bool
+}
+
+func newProtocol() *protocol {
+	p := &protocol{seen: make(map[reflect.Type]bool)}
+	p.visit(envelopeType)
+	for t := range msgTypeNames {
+		payload := reflect.TypeOf(newPayload(MsgType(t))).Elem()
+		p.payloads = append(p.payloads, payload)
+		p.visit(payload)
+	}
+	return p
+}
+
+// visit adds the named types t refers to.
+func (p *protocol) visit(t reflect.Type) {
+	switch t {
+	case timeType, payloadType, bytesType:
+		return
+	}
+
+	if !isNamed(t) {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array:
+			p.visit(t.Elem())
+		}
+		return
+	}
+
+	if p.seen[t] {
+		return
+	}
+	p.seen[t] = true
+	p.types = append(p.types, t)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for _, f := range fields(t) {
+			p.visit(f.typ)
+		}
+	case reflect.Slice:
+		p.visit(t.Elem())
+	}
+}
+
+// isNamed reports whether t is defined by the package, or is a UUID.
+func isNamed(t reflect.Type) bool {
+	return t == uuidType || t.Name() != "" && t.PkgPath() == envelopeType.PkgPath()
+}
+
+type field struct {
+	name string
+	typ  reflect.Type
+	// left out of the JSON when empty
+	optional bool
+}
+
+// fields returns the fields of a struct as encoded in JSON.
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fs = append(fs, field{name: name, typ: f.Type, optional: strings.Contains(opts, "omitempty")})
+	}
+	return fs
+}
+
+// JSONSchema returns the JSON Schema of envelopes, every envelope holding
+// the payload of its type. Fields that may be left out of payloads are not
+// required, but clients may leave out any field of the payloads they send.
+func JSONSchema() ([]byte, error) {
+	p := newProtocol()
+
+	defs := make(map[string]any, len(p.types))
+	for _, t := range p.types {
+		defs[t.Name()] = p.schema(t)
+	}
+
+	// the payload of an envelope follows from its type
+	envelope := defs[envelopeType.Name()].(map[string]any)
+	var cases []any
+	for t, payload := range p.payloads {
+		cases = append(cases, map[string]any{
+			"if": map[string]any{
+				"properties": map[string]any{"type": map[string]any{"const": t}},
+			},
+			"then": map[string]any{
+				"properties": map[string]any{"payload": ref(payload)},
+			},
+		})
+	}
+	envelope["allOf"] = cases
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     fmt.Sprintf("urn:rmx:msg:v%d", Version),
+		"title":   fmt.Sprintf("RMX messages, version %d", Version),
+		"$ref":    "#/$defs/" + envelopeType.Name(),
+		"$defs":   defs,
+	})
+	return buf.Bytes(), err
+}
+
+// schema returns the definition of a named type.
+func (p *protocol) schema(t reflect.Type) map[string]any {
+	if t == uuidType {
+		return map[string]any{"type": "string", "format": "uuid"}
+	}
+
+	if values, ok := enums[t]; ok {
+		var cases []any
+		for _, v := range values {
+			cases = append(cases, map[string]any{"const": v.value, "title": v.name})
+		}
+		return map[string]any{"type": "integer", "oneOf": cases}
+	}
+
+	if t.Kind() != reflect.Struct {
+		return p.inline(t)
+	}
+
+	properties := make(map[string]any)
+	required := []string{}
+	for _, f := range fields(t) {
+		s := p.ref(f.typ)
+		if !f.optional {
+			required = append(required, f.name)
+			if nullable(f.typ) {
+				s = map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+			}
+		}
+		properties[f.name] = s
+	}
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// ref returns the schema of t, referring to the definition of named types.
+func (p *protocol) ref(t reflect.Type) any {
+	switch {
+	case t == payloadType:
+		// set by the envelope from its type
+		return map[string]any{}
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == bytesType:
+		return map[string]any{"type": "string", "contentEncoding": "base64"}
+	case p.seen[t]:
+		return ref(t)
+	case t.Kind() == reflect.Pointer:
+		return p.ref(t.Elem())
+	}
+	return p.inline(t)
+}
+
+func (p *protocol) inline(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": p.ref(t.Elem())}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return map[string]any{"type": "integer", "minimum": 0, "maximum": uint64(1)<<(8*t.Size()) - 1}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return map[string]any{"type": "integer"}
+	}
+	panic("msg: no schema for " + t.String())
+}
+
+func ref(t reflect.Type) map[string]any {
+	return map[string]any{"$ref": "#/$defs/" + t.Name()}
+}
+
+// nullable reports whether the JSON of a type may be null.
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return t != payloadType
+	}
+	return false
+}
+
+// TypeScript returns the TypeScript definitions of envelopes. Envelope is
+// generic over the type of message, and AnyEnvelope is the union of every
+// type of envelope.
+func TypeScript() []byte {
+	p := newProtocol()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by rmx schema. DO NOT EDIT.\n")
+	fmt.Fprintf(&buf, "// RMX messages, version %d.\n\n", Version)
+	fmt.Fprintf(&buf, "export const VERSION = %d;\n", Version)
+
+	for _, t := range p.types {
+		buf.WriteString("\n")
+		name := t.Name()
+
+		if values, ok := enums[t]; ok {
+			fmt.Fprintf(&buf, "export enum %s {\n", name)
+			for _, v := range values {
+				fmt.Fprintf(&buf, "  %s = %d,\n", v.name, v.value)
+			}
+			buf.WriteString("}\n")
+			continue
+		}
+
+		switch {
+		case t == envelopeType:
+			fmt.Fprintf(&buf, "export interface %s<T extends %s = %s> {\n", name, msgTypeType.Name(), msgTypeType.Name())
+		case t.Kind() == reflect.Struct:
+			fmt.Fprintf(&buf, "export interface %s {\n", name)
+		case t == uuidType:
+			fmt.Fprintf(&buf, "export type %s = string;\n", name)
+			continue
+		default:
+			fmt.Fprintf(&buf, "export type %s = %s;\n", name, p.tsType(t))
+			continue
+		}
+
+		for _, f := range fields(t) {
+			typ := p.ts(f.typ)
+			switch {
+			case f.typ == msgTypeType && t == envelopeType:
+				typ = "T"
+			case f.typ == payloadType:
+				typ = "Payloads[T]"
+			case !f.optional && nullable(f.typ):
+				typ += " | null"
+			}
+
+			optional := ""
+			if f.optional {
+				optional = "?"
+			}
+			fmt.Fprintf(&buf, "  %s%s: %s;\n", f.name, optional, typ)
+		}
+		buf.WriteString("}\n")
+	}
+
+	fmt.Fprintf(&buf, "\n// Payloads are the payloads of envelopes by type of message.\n")
+	fmt.Fprintf(&buf, "export interface Payloads {\n")
+	for t, payload := range p.payloads {
+		fmt.Fprintf(&buf, "  [%s.%s]: %s;\n", msgTypeType.Name(), MsgType(t), payload.Name())
+	}
+	buf.WriteString("}\n")
+
+	fmt.Fprintf(&buf, "\nexport type AnyEnvelope = { [T in %[1]s]: %[2]s<T> }[%[1]s];\n", msgTypeType.Name(), envelopeType.Name())
+	return buf.Bytes()
+}
+
+// ts returns the TypeScript type of t, referring to named types.
+func (p *protocol) ts(t reflect.Type) string {
+	switch {
+	case t == timeType, t == bytesType:
+		return "string"
+	case t == payloadType:
+		return "unknown"
+	case p.seen[t]:
+		return t.Name()
+	case t.Kind() == reflect.Pointer:
+		return p.ts(t.Elem())
+	}
+	return p.tsType(t)
+}
+
+func (p *protocol) tsType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return p.ts(t.Elem()) + "[]"
+	case reflect.Float32, reflect.Float64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return "number"
+	}
+	panic("msg: no TypeScript type for " + t.String())
+}
@@ -0,0 +1,103 @@
+package msg_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rapidmidiex/rmx/internal/msg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchema(t *testing.T) {
+	p, err := msg.JSONSchema()
+	require.NoError(t, err)
+
+	var schema struct {
+		ID   string `json:"$id"`
+		Defs map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+			OneOf      []struct {
+				Const int    `json:"const"`
+				Title string `json:"title"`
+			} `json:"oneOf"`
+			AllOf []struct {
+				If struct {
+					Properties struct {
+						Type struct {
+							Const msg.MsgType `json:"const"`
+						} `json:"type"`
+					} `json:"properties"`
+				} `json:"if"`
+				Then struct {
+					Properties struct {
+						Payload struct {
+							Ref string `json:"$ref"`
+						} `json:"payload"`
+					} `json:"properties"`
+				} `json:"then"`
+			} `json:"allOf"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(p, &schema))
+	require.Equal(t, fmt.Sprintf("urn:rmx:msg:v%d", msg.Version), schema.ID)
+
+	types := schema.Defs["MsgType"].OneOf
+	require.Len(t, types, int(msg.SYSEX)+1, "every type of message is in the enum")
+	for i, c := range types {
+		require.Equal(t, i, c.Const)
+		require.Equal(t, msg.MsgType(i).String(), c.Title)
+	}
+
+	cases := schema.Defs["Envelope"].AllOf
+	require.Len(t, cases, len(types), "every type of message has a payload")
+	for i, c := range cases {
+		require.Equal(t, msg.MsgType(i), c.If.Properties.Type.Const)
+		name := strings.TrimPrefix(c.Then.Properties.Payload.Ref, "#/$defs/")
+		require.Contains(t, schema.Defs, name)
+	}
+	require.Equal(t, "#/$defs/SysExMsg", cases[msg.SYSEX].Then.Properties.Payload.Ref)
+
+	// the fields sent by the server are the properties of the payloads
+	payloads := map[string]any{
+		"ConnectMsg":   msg.ConnectMsg{UserID: uuid.New(), ShortID: 1, Scale: &msg.ScaleMsg{}},
+		"MIDIMsg":      msg.MIDIMsg{State: msg.NOTE_ON, Number: 60, Velocity: 90},
+		"LooperMsg":    msg.LooperMsg{},
+		"SequencerMsg": msg.SequencerMsg{Tracks: []msg.SequencerTrack{}},
+	}
+	for name, v := range payloads {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+
+		var fields map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(b, &fields))
+
+		def := schema.Defs[name]
+		for f := range fields {
+			require.Contains(t, def.Properties, f, "%s.%s", name, f)
+		}
+		for _, f := range def.Required {
+			require.Contains(t, fields, f, "%s.%s", name, f)
+		}
+	}
+}
+
+func TestTypeScript(t *testing.T) {
+	ts := string(msg.TypeScript())
+
+	require.Contains(t, ts, fmt.Sprintf("export const VERSION = %d;", msg.Version))
+	require.Contains(t, ts, "export enum MsgType {\n  TEXT = 0,\n  MIDI = 1,")
+	require.Contains(t, ts, fmt.Sprintf("  SYSEX = %d,\n}", msg.SYSEX))
+	require.Contains(t, ts, "  payload: Payloads[T];")
+	require.Contains(t, ts, "  [MsgType.SYSEX]: SysExMsg;")
+	require.Contains(t, ts, "export interface MIDIMsg {\n  state: NoteState;\n  number: number;\n  velocity: number;\n  channel?: number;")
+	require.Contains(t, ts, "  layers: LoopLayer[] | null;", "nil slices are sent as null")
+	require.Contains(t, ts, "  playback?: PlaybackMsg;")
+	require.Contains(t, ts, "export type UMPPacket = number[];")
+
+	require.Equal(t, "SYSEX", msg.SYSEX.String())
+	require.Equal(t, "MsgType(99)", msg.MsgType(99).String())
+}
@@ -0,0 +1,78 @@
+package msg
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// Manufacturer is the ID of a manufacturer starting a SysEx message: a
+// single byte, or three bytes starting with 0x00. It is written in hex,
+// such as "43" for Yamaha or "002033" for Access.
+type Manufacturer string
+
+// Universal SysEx messages are defined by the MIDI specification rather than
+// by a manufacturer.
+const (
+	NonCommercial        Manufacturer = "7d"
+	UniversalNonRealTime Manufacturer = "7e"
+	UniversalRealTime    Manufacturer = "7f"
+)
+
+// ParseManufacturer returns the manufacturer written in hex in s, case and
+// spaces between the bytes ignored.
+func ParseManufacturer(s string) (Manufacturer, bool) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		return "", false
+	}
+
+	id, ok := manufacturer(b)
+	if !ok || len(id) != len(b) {
+		return "", false
+	}
+	return Manufacturer(hex.EncodeToString(id)), true
+}
+
+// manufacturer returns the bytes of the manufacturer ID data starts with.
+func manufacturer(data []byte) ([]byte, bool) {
+	switch {
+	case len(data) == 0 || data[0] >= 0x80:
+		return nil, false
+	case data[0] != 0x00:
+		return data[:1], true
+	case len(data) < 3 || data[1] >= 0x80 || data[2] >= 0x80 || (data[1] == 0 && data[2] == 0):
+		return nil, false
+	}
+	return data[:3], true
+}
+
+// Manufacturer returns the manufacturer of the message.
+func (m SysExMsg) Manufacturer() (Manufacturer, bool) {
+	id, ok := manufacturer(m.Data)
+	if !ok {
+		return "", false
+	}
+	return Manufacturer(hex.EncodeToString(id)), true
+}
+
+// Valid reports whether the message starts with a manufacturer ID and only
+// holds data bytes, the F0 and F7 bytes framing it being left out.
+func (m SysExMsg) Valid() bool {
+	if _, ok := m.Manufacturer(); !ok {
+		return false
+	}
+	for _, b := range m.Data {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Bytes returns the message as sent to hardware, framed by F0 and F7.
+func (m SysExMsg) Bytes() []byte {
+	b := make([]byte, 0, len(m.Data)+2)
+	b = append(b, 0xF0)
+	b = append(b, m.Data...)
+	return append(b, 0xF7)
+}
@@ -0,0 +1,343 @@
+package msg
+
+// UMPPacket is a MIDI 2.0 Universal MIDI Packet, one to four 32-bit words
+// depending on its type. In JSON it is an array of the words as numbers.
+//
+// The first word of a channel voice message is laid out as
+//
+//	bits   field
+//	31-28  type, UMPMIDI1 or UMPMIDI2
+//	27-24  group
+//	23-20  status
+//	19-16  channel
+//	15-8   note number, or index of the controller
+//	7-0    velocity of a MIDI 1.0 message, or attribute type or index of the controller
+//
+// The second word of a MIDI 2.0 message holds its value: the velocity in the
+// upper 16 bits and the attribute in the lower 16 bits for notes, the 32-bit
+// value of the controller, pressure or pitch bend otherwise.
+type UMPPacket []uint32
+
+// UMPType is the message type of a packet.
+type UMPType uint8
+
+// UMPStatus is the status of a channel voice packet.
+type UMPStatus uint8
+
+const (
+	UMPUtility UMPType = 0x0
+	UMPSystem  UMPType = 0x1
+	// UMPMIDI1 packets are MIDI 1.0 channel voice messages, in 32 bits.
+	UMPMIDI1  UMPType = 0x2
+	UMPData64 UMPType = 0x3
+	// UMPMIDI2 packets are MIDI 2.0 channel voice messages, in 64 bits.
+	UMPMIDI2   UMPType = 0x4
+	UMPData128 UMPType = 0x5
+)
+
+const (
+	// MIDI 2.0 only
+	UMPRegisteredPerNoteController UMPStatus = 0x0
+	UMPAssignablePerNoteController UMPStatus = 0x1
+	UMPRegisteredController        UMPStatus = 0x2
+	UMPAssignableController        UMPStatus = 0x3
+	UMPPerNotePitchBend            UMPStatus = 0x6
+	UMPPerNoteManagement           UMPStatus = 0xF
+
+	UMPNoteOff         UMPStatus = 0x8
+	UMPNoteOn          UMPStatus = 0x9
+	UMPPolyPressure    UMPStatus = 0xA
+	UMPControlChange   UMPStatus = 0xB
+	UMPProgramChange   UMPStatus = 0xC
+	UMPChannelPressure UMPStatus = 0xD
+	UMPPitchBend       UMPStatus = 0xE
+)
+
+// UMPPitchBendCenter is the value of a MIDI 2.0 pitch bend that does not bend.
+const UMPPitchBendCenter = 0x80000000
+
+// NoteOn2 returns a MIDI 2.0 note on packet with a 16-bit velocity.
+func NoteOn2(group, channel, note uint8, velocity uint16) UMPPacket {
+	return midi2(group, UMPNoteOn, channel, note, 0, uint32(velocity)<<16)
+}
+
+// NoteOff2 returns a MIDI 2.0 note off packet with a 16-bit velocity.
+func NoteOff2(group, channel, note uint8, velocity uint16) UMPPacket {
+	return midi2(group, UMPNoteOff, channel, note, 0, uint32(velocity)<<16)
+}
+
+// ControlChange2 returns a MIDI 2.0 control change packet with a 32-bit value.
+func ControlChange2(group, channel, index uint8, value uint32) UMPPacket {
+	return midi2(group, UMPControlChange, channel, index, 0, value)
+}
+
+// PerNotePitchBend2 returns a MIDI 2.0 pitch bend packet for a single note,
+// UMPPitchBendCenter does not bend.
+func PerNotePitchBend2(group, channel, note uint8, value uint32) UMPPacket {
+	return midi2(group, UMPPerNotePitchBend, channel, note, 0, value)
+}
+
+// PerNoteController2 returns a MIDI 2.0 controller packet for a single note,
+// registered controllers have a meaning set by the MIDI 2.0 specification,
+// assignable ones are up to the instrument.
+func PerNoteController2(group, channel, note, index uint8, value uint32, registered bool) UMPPacket {
+	status := UMPAssignablePerNoteController
+	if registered {
+		status = UMPRegisteredPerNoteController
+	}
+	return midi2(group, status, channel, note, index, value)
+}
+
+func midi2(group uint8, status UMPStatus, channel, b2, b3 uint8, value uint32) UMPPacket {
+	return UMPPacket{midi1Word(UMPMIDI2, group, status, channel, b2, b3), value}
+}
+
+func midi1Word(typ UMPType, group uint8, status UMPStatus, channel, b2, b3 uint8) uint32 {
+	return uint32(typ)<<28 | uint32(group&0xF)<<24 | uint32(status)<<20 |
+		uint32(channel&0xF)<<16 | uint32(b2&0x7F)<<8 | uint32(b3)
+}
+
+// UMPFromMIDI returns the MIDI 1.0 packet of a note on or off in group.
+func UMPFromMIDI(group uint8, m MIDIMsg) UMPPacket {
+	status := UMPNoteOff
+	if m.State == NOTE_ON {
+		status = UMPNoteOn
+	}
+	return UMPPacket{midi1Word(UMPMIDI1, group, status, uint8(m.Channel), uint8(m.Number), uint8(m.Velocity)&0x7F)}
+}
+
+// Type returns the message type of the packet.
+func (p UMPPacket) Type() UMPType {
+	if len(p) == 0 {
+		return UMPUtility
+	}
+	return UMPType(p[0] >> 28)
+}
+
+// Group returns the group of the packet (0-15).
+func (p UMPPacket) Group() uint8 { return p.byte(0) & 0xF }
+
+// Status returns the status of a channel voice packet.
+func (p UMPPacket) Status() UMPStatus { return UMPStatus(p.byte(1) >> 4) }
+
+// Channel returns the channel of a channel voice packet (0-15).
+func (p UMPPacket) Channel() uint8 { return p.byte(1) & 0xF }
+
+// Note returns the note number of a channel voice packet about a single note.
+func (p UMPPacket) Note() (uint8, bool) {
+	switch p.Status() {
+	case UMPNoteOff, UMPNoteOn, UMPPolyPressure:
+		return p.byte(2), true
+	case UMPRegisteredPerNoteController, UMPAssignablePerNoteController, UMPPerNotePitchBend, UMPPerNoteManagement:
+		return p.byte(2), p.Type() == UMPMIDI2
+	}
+	return 0, false
+}
+
+// Velocity returns the velocity of a note packet, in 16 bits for MIDI 2.0
+// and 7 bits for MIDI 1.0.
+func (p UMPPacket) Velocity() uint16 {
+	if p.Type() == UMPMIDI2 {
+		return uint16(p[1] >> 16)
+	}
+	return uint16(p.byte(3) & 0x7F)
+}
+
+// Value returns the value of a MIDI 2.0 controller, pressure or pitch bend packet.
+func (p UMPPacket) Value() uint32 {
+	if p.Type() != UMPMIDI2 {
+		return 0
+	}
+	return p[1]
+}
+
+func (p UMPPacket) byte(i int) uint8 {
+	if len(p) == 0 {
+		return 0
+	}
+	return uint8(p[0] >> (24 - 8*i))
+}
+
+// Size returns the number of words of a packet of type t.
+func (t UMPType) Size() int {
+	switch t {
+	case UMPData64, UMPMIDI2:
+		return 2
+	case UMPData128, 0xD, 0xF:
+		return 4
+	case 0x6, 0x7:
+		return 1
+	case 0x8, 0x9, 0xA:
+		return 2
+	case 0xB, 0xC, 0xE:
+		return 3
+	}
+	return 1
+}
+
+// Valid reports whether the packet is a channel voice message of the right
+// size, with 7-bit note numbers and controller indexes.
+func (p UMPPacket) Valid() bool {
+	typ := p.Type()
+	if (typ != UMPMIDI1 && typ != UMPMIDI2) || len(p) != typ.Size() {
+		return false
+	}
+
+	switch status := p.Status(); {
+	case status < UMPNoteOff && typ == UMPMIDI1:
+		return false
+	case typ == UMPMIDI1:
+		return p.byte(2) < 0x80 && p.byte(3) < 0x80
+	case status == 0x4 || status == 0x5 || status == 0x7:
+		// relative controllers are not supported, 0x7 is not defined
+		return false
+	}
+	return p.byte(2) < 0x80
+}
+
+// WithChannel returns a copy of a channel voice packet on another channel.
+func (p UMPPacket) WithChannel(channel uint8) UMPPacket {
+	q := append(UMPPacket(nil), p...)
+	q[0] = q[0]&^(0xF<<16) | uint32(channel&0xF)<<16
+	return q
+}
+
+// WithNote returns a copy of a packet about a single note for another note.
+func (p UMPPacket) WithNote(note uint8) UMPPacket {
+	if _, ok := p.Note(); !ok {
+		return p
+	}
+	q := append(UMPPacket(nil), p...)
+	q[0] = q[0]&^(0xFF<<8) | uint32(note&0x7F)<<8
+	return q
+}
+
+// MIDI returns the MIDIMsg of a note, control change, channel pressure or
+// pitch bend packet, scaling the values of MIDI 2.0 packets down. The
+// velocity of a MIDI 2.0 note on never scales down to 0, which would turn it
+// into a note off.
+func (p UMPPacket) MIDI() (MIDIMsg, bool) {
+	down, ok := p.Downconvert()
+	if !ok {
+		return MIDIMsg{}, false
+	}
+
+	m := MIDIMsg{Channel: int(down.Channel())}
+	b2, b3 := int(down.byte(2)), int(down.byte(3))
+	switch down.Status() {
+	case UMPNoteOn:
+		m.State, m.Number, m.Velocity = NOTE_ON, b2, b3
+	case UMPNoteOff:
+		m.State, m.Number, m.Velocity = NOTE_OFF, b2, b3
+	case UMPControlChange:
+		m.State, m.Number, m.Value = CONTROL_CHANGE, b2, b3
+	case UMPChannelPressure:
+		m.State, m.Value = CHANNEL_PRESSURE, b2
+	case UMPPitchBend:
+		m.State, m.Value = PITCH_BEND, b3<<7|b2
+	default:
+		return MIDIMsg{}, false
+	}
+	return m, true
+}
+
+// Downconvert returns the MIDI 1.0 packet of a MIDI 2.0 channel voice packet,
+// scaling its values down to 7 or 14 bits. Messages MIDI 1.0 has no
+// equivalent of, such as per-note controllers, cannot be downconverted.
+// A packet upconverted from MIDI 1.0 downconverts back to the same packet.
+func (p UMPPacket) Downconvert() (UMPPacket, bool) {
+	if !p.Valid() {
+		return nil, false
+	}
+	if p.Type() == UMPMIDI1 {
+		return p, true
+	}
+
+	group, status, channel := p.Group(), p.Status(), p.Channel()
+	word := func(b2, b3 uint32) UMPPacket {
+		return UMPPacket{midi1Word(UMPMIDI1, group, status, channel, uint8(b2), uint8(b3))}
+	}
+
+	switch status {
+	case UMPNoteOn:
+		v := scaleDown(uint32(p.Velocity()), 16, 7)
+		if v == 0 {
+			v = 1
+		}
+		return word(uint32(p.byte(2)), v), true
+	case UMPNoteOff:
+		return word(uint32(p.byte(2)), scaleDown(uint32(p.Velocity()), 16, 7)), true
+	case UMPPolyPressure, UMPControlChange:
+		return word(uint32(p.byte(2)), scaleDown(p[1], 32, 7)), true
+	case UMPChannelPressure:
+		return word(scaleDown(p[1], 32, 7), 0), true
+	case UMPProgramChange:
+		// bank select, if any, is left out
+		return word(p[1]>>24&0x7F, 0), true
+	case UMPPitchBend:
+		v := scaleDown(p[1], 32, 14)
+		return word(v&0x7F, v>>7), true
+	}
+	return nil, false
+}
+
+// Upconvert returns the MIDI 2.0 packet of a MIDI 1.0 channel voice packet,
+// scaling its values up so that they downconvert back to the same packet.
+// Note ons with a velocity of 0 become note offs.
+func (p UMPPacket) Upconvert() (UMPPacket, bool) {
+	if !p.Valid() {
+		return nil, false
+	}
+	if p.Type() == UMPMIDI2 {
+		return p, true
+	}
+
+	group, status, channel := p.Group(), p.Status(), p.Channel()
+	b2, b3 := uint32(p.byte(2)), uint32(p.byte(3))
+
+	switch status {
+	case UMPNoteOn, UMPNoteOff:
+		// MIDI 2.0 note ons are never silent
+		if status == UMPNoteOn && b3 == 0 {
+			status = UMPNoteOff
+		}
+		return midi2(group, status, channel, uint8(b2), 0, scaleUp(b3, 7, 16)<<16), true
+	case UMPPolyPressure, UMPControlChange:
+		return midi2(group, status, channel, uint8(b2), 0, scaleUp(b3, 7, 32)), true
+	case UMPChannelPressure:
+		return midi2(group, status, channel, 0, 0, scaleUp(b2, 7, 32)), true
+	case UMPProgramChange:
+		return midi2(group, status, channel, 0, 0, b2<<24), true
+	case UMPPitchBend:
+		return midi2(group, status, channel, 0, 0, scaleUp(b3<<7|b2, 14, 32)), true
+	}
+	return nil, false
+}
+
+func scaleDown(v uint32, from, to uint) uint32 {
+	return v >> (from - to)
+}
+
+// scaleUp scales v from a resolution to a higher one with the min-center-max
+// algorithm of the MIDI 2.0 specification: the minimum, center and maximum
+// values map to the minimum, center and maximum of the higher resolution.
+func scaleUp(v uint32, from, to uint) uint32 {
+	shift := to - from
+	shifted := uint64(v) << shift
+	if v <= 1<<(from-1) {
+		return uint32(shifted)
+	}
+
+	repeatBits := from - 1
+	repeat := uint64(v) & (1<<repeatBits - 1)
+	if shift > repeatBits {
+		repeat <<= shift - repeatBits
+	} else {
+		repeat >>= repeatBits - shift
+	}
+	for repeat != 0 {
+		shifted |= repeat
+		repeat >>= repeatBits
+	}
+	return uint32(shifted)
+}
@@ -0,0 +1,296 @@
+// Package osc reads and writes Open Sound Control 1.0 packets.
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// bundleTag starts the packets holding a bundle rather than a message.
+const bundleTag = "#bundle"
+
+// maxDepth bounds how deep bundles are nested in a packet.
+const maxDepth = 8
+
+var (
+	ErrMalformed = errors.New("osc: malformed packet")
+	ErrArgType   = errors.New("osc: unsupported argument type")
+)
+
+// Message is an OSC message. Its arguments are int32, float32, string,
+// []byte (blobs), int64, float64, bool or nil.
+type Message struct {
+	Address string
+	Args    []any
+}
+
+// Bundle is a group of messages and bundles to be applied at once.
+type Bundle struct {
+	// Time tag of the bundle as an NTP timestamp, Immediately if 1.
+	Time     uint64
+	Elements []Packet
+}
+
+// Packet is a Message or a Bundle.
+type Packet interface {
+	MarshalBinary() ([]byte, error)
+}
+
+// Immediately is the time tag of bundles to apply as soon as they are received.
+const Immediately uint64 = 1
+
+// NewMessage returns a message to the address with the given arguments.
+func NewMessage(address string, args ...any) Message {
+	return Message{Address: address, Args: args}
+}
+
+// TypeTags returns the type tag string of the message arguments, without the
+// leading comma.
+func (m Message) TypeTags() (string, error) {
+	var b strings.Builder
+	for _, a := range m.Args {
+		switch a := a.(type) {
+		case int32:
+			b.WriteByte('i')
+		case float32:
+			b.WriteByte('f')
+		case string:
+			b.WriteByte('s')
+		case []byte:
+			b.WriteByte('b')
+		case int64:
+			b.WriteByte('h')
+		case float64:
+			b.WriteByte('d')
+		case bool:
+			if a {
+				b.WriteByte('T')
+			} else {
+				b.WriteByte('F')
+			}
+		case nil:
+			b.WriteByte('N')
+		default:
+			return "", fmt.Errorf("%w: %T", ErrArgType, a)
+		}
+	}
+	return b.String(), nil
+}
+
+// MarshalBinary encodes the message.
+func (m Message) MarshalBinary() ([]byte, error) {
+	if !strings.HasPrefix(m.Address, "/") {
+		return nil, fmt.Errorf("%w: address %q does not start with /", ErrMalformed, m.Address)
+	}
+
+	tags, err := m.TypeTags()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeString(&buf, m.Address)
+	writeString(&buf, ","+tags)
+	for _, a := range m.Args {
+		switch a := a.(type) {
+		case int32:
+			binary.Write(&buf, binary.BigEndian, a)
+		case float32:
+			binary.Write(&buf, binary.BigEndian, math.Float32bits(a))
+		case string:
+			writeString(&buf, a)
+		case []byte:
+			binary.Write(&buf, binary.BigEndian, int32(len(a)))
+			buf.Write(a)
+			pad(&buf)
+		case int64:
+			binary.Write(&buf, binary.BigEndian, a)
+		case float64:
+			binary.Write(&buf, binary.BigEndian, math.Float64bits(a))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalBinary encodes the bundle and its elements.
+func (b Bundle) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	writeString(&buf, bundleTag)
+	binary.Write(&buf, binary.BigEndian, b.Time)
+	for _, e := range b.Elements {
+		p, err := e.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, int32(len(p)))
+		buf.Write(p)
+	}
+	return buf.Bytes(), nil
+}
+
+// Parse decodes a packet into the messages it holds, in order. The time
+// tags of bundles are ignored.
+func Parse(p []byte) ([]Message, error) {
+	return parse(p, 0)
+}
+
+func parse(p []byte, depth int) ([]Message, error) {
+	if len(p) == 0 || len(p)%4 != 0 {
+		return nil, ErrMalformed
+	}
+
+	if p[0] == '/' {
+		m, err := parseMessage(p)
+		if err != nil {
+			return nil, err
+		}
+		return []Message{m}, nil
+	}
+
+	tag, p, err := readString(p)
+	if err != nil || tag != bundleTag || len(p) < 8 || depth == maxDepth {
+		return nil, ErrMalformed
+	}
+
+	var ms []Message
+	for p = p[8:]; len(p) > 0; {
+		if len(p) < 4 {
+			return nil, ErrMalformed
+		}
+		n := int(int32(binary.BigEndian.Uint32(p)))
+		if n < 0 || n > len(p)-4 {
+			return nil, ErrMalformed
+		}
+
+		inner, err := parse(p[4:4+n], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, inner...)
+		p = p[4+n:]
+	}
+	return ms, nil
+}
+
+func parseMessage(p []byte) (Message, error) {
+	var (
+		m    Message
+		tags string
+		err  error
+	)
+	if m.Address, p, err = readString(p); err != nil {
+		return m, err
+	}
+	// type tags were optional in early implementations
+	if len(p) == 0 {
+		return m, nil
+	}
+	if tags, p, err = readString(p); err != nil || !strings.HasPrefix(tags, ",") {
+		return m, ErrMalformed
+	}
+
+	for _, t := range tags[1:] {
+		var size int
+		switch t {
+		case 'i', 'f':
+			size = 4
+		case 'h', 'd':
+			size = 8
+		}
+		if len(p) < size {
+			return m, ErrMalformed
+		}
+
+		var a any
+		switch t {
+		case 'i':
+			a = int32(binary.BigEndian.Uint32(p))
+		case 'f':
+			a = math.Float32frombits(binary.BigEndian.Uint32(p))
+		case 'h':
+			a = int64(binary.BigEndian.Uint64(p))
+		case 'd':
+			a = math.Float64frombits(binary.BigEndian.Uint64(p))
+		case 's':
+			if a, p, err = readString(p); err != nil {
+				return m, err
+			}
+		case 'b':
+			if a, p, err = readBlob(p); err != nil {
+				return m, err
+			}
+		case 'T':
+			a = true
+		case 'F':
+			a = false
+		case 'N':
+			a = nil
+		default:
+			return m, fmt.Errorf("%w: %q", ErrArgType, t)
+		}
+		p = p[size:]
+		m.Args = append(m.Args, a)
+	}
+	return m, nil
+}
+
+// readString reads a null terminated string padded to 4 bytes.
+func readString(p []byte) (string, []byte, error) {
+	i := bytes.IndexByte(p, 0)
+	if i < 0 {
+		return "", nil, ErrMalformed
+	}
+	n := (i + 4) &^ 3
+	if n > len(p) {
+		return "", nil, ErrMalformed
+	}
+	return string(p[:i]), p[n:], nil
+}
+
+// readBlob reads a blob, its size followed by its bytes padded to 4 bytes.
+func readBlob(p []byte) ([]byte, []byte, error) {
+	if len(p) < 4 {
+		return nil, nil, ErrMalformed
+	}
+	size := int(int32(binary.BigEndian.Uint32(p)))
+	n := (size + 3) &^ 3
+	if size < 0 || n > len(p)-4 {
+		return nil, nil, ErrMalformed
+	}
+	return append([]byte(nil), p[4:4+size]...), p[4+n:], nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.WriteByte(0)
+	pad(buf)
+}
+
+func pad(buf *bytes.Buffer) {
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// Int returns the argument at i as an int, if it is a number.
+// Floats are rounded, as many controllers only send floats.
+func (m Message) Int(i int) (int, bool) {
+	if i >= len(m.Args) {
+		return 0, false
+	}
+	switch a := m.Args[i].(type) {
+	case int32:
+		return int(a), true
+	case int64:
+		return int(a), true
+	case float32:
+		return int(math.Round(float64(a))), true
+	case float64:
+		return int(math.Round(a)), true
+	}
+	return 0, false
+}
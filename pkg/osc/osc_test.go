@@ -0,0 +1,71 @@
+package osc_test
+
+import (
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/rapidmidiex/rmx/pkg/osc"
+)
+
+func TestMessage(t *testing.T) {
+	is := is.New(t)
+
+	m := osc.NewMessage("/rmx/note", int32(60), float32(0.5), "keys", []byte{1, 2, 3, 4, 5}, true, nil, int64(-1), 2.5)
+	p, err := m.MarshalBinary()
+	is.NoErr(err)         // marshal message
+	is.Equal(0, len(p)%4) // packets are 4 byte aligned
+	is.Equal("/rmx/note", string(p[:9]))
+	is.Equal(",ifsbTNhd", string(p[12:21])) // type tags
+
+	got, err := osc.Parse(p)
+	is.NoErr(err) // parse message
+	is.Equal(1, len(got))
+	is.Equal(m, got[0]) // round-trips
+
+	n, ok := got[0].Int(1)
+	is.True(ok)
+	is.Equal(1, n) // floats are rounded
+
+	_, ok = got[0].Int(2)
+	is.True(!ok) // strings are not numbers
+}
+
+func TestBundle(t *testing.T) {
+	is := is.New(t)
+
+	b := osc.Bundle{Time: osc.Immediately, Elements: []osc.Packet{
+		osc.NewMessage("/a", int32(1)),
+		osc.Bundle{Time: osc.Immediately, Elements: []osc.Packet{osc.NewMessage("/b")}},
+		osc.NewMessage("/c", "x"),
+	}}
+	p, err := b.MarshalBinary()
+	is.NoErr(err) // marshal bundle
+
+	got, err := osc.Parse(p)
+	is.NoErr(err) // parse bundle
+	is.Equal(3, len(got))
+	is.Equal("/a", got[0].Address)
+	is.Equal("/b", got[1].Address) // nested bundles are flattened
+	is.Equal([]any{"x"}, got[2].Args)
+}
+
+func TestParseMalformed(t *testing.T) {
+	is := is.New(t)
+
+	for _, p := range [][]byte{
+		nil,
+		[]byte("/abc"),                 // no terminating null
+		[]byte("/a\x00\x00,i\x00\x00"), // missing argument
+		[]byte("/a\x00\x00,b\x00\x00\x00\x00\x00\x09"), // blob past the end
+		[]byte("#bundle\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x08"),
+	} {
+		_, err := osc.Parse(p)
+		is.True(err != nil) // malformed packets are rejected
+	}
+
+	_, err := osc.Parse([]byte("/a\x00\x00,x\x00\x00"))
+	is.True(err != nil) // unknown type tags are rejected
+
+	_, err = osc.NewMessage("/a", 1).MarshalBinary()
+	is.True(err != nil) // ints must be sized
+}
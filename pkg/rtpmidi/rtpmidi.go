@@ -0,0 +1,330 @@
+// Package rtpmidi reads and writes the packets of RTP-MIDI (RFC 6295)
+// sessions, and of the AppleMIDI protocol managing them.
+//
+// An AppleMIDI session is held over a pair of UDP ports, the data port
+// following the control port. The initiator invites the listener on both,
+// then synchronizes their clocks on the data port before sending MIDI.
+package rtpmidi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Commands of AppleMIDI packets.
+const (
+	Invitation = "IN"
+	Accept     = "OK"
+	Reject     = "NO"
+	End        = "BY"
+	Sync       = "CK"
+	Feedback   = "RS"
+)
+
+// Version of the AppleMIDI protocol.
+const Version = 2
+
+// PayloadType is the RTP payload type of MIDI packets.
+const PayloadType = 0x61
+
+// ClockRate is the rate of the timestamps of AppleMIDI sessions, in ticks per second.
+const ClockRate = 10000
+
+// signature starts every AppleMIDI packet.
+const signature = 0xFFFF
+
+var (
+	ErrMalformed = errors.New("rtpmidi: malformed packet")
+	ErrCommand   = errors.New("rtpmidi: unexpected command")
+)
+
+// IsControl reports whether p is an AppleMIDI packet rather than an RTP one,
+// both being received on the data port.
+func IsControl(p []byte) bool {
+	return len(p) >= 4 && binary.BigEndian.Uint16(p) == signature
+}
+
+// Command returns the command of an AppleMIDI packet.
+func Command(p []byte) string {
+	if !IsControl(p) {
+		return ""
+	}
+	return string(p[2:4])
+}
+
+// Session is an AppleMIDI invitation, acceptance, rejection or end of session.
+type Session struct {
+	Command string
+	// Token chosen by the initiator, echoed in the answers to the invitation.
+	Token uint32
+	// Synchronization source of the sender.
+	SSRC uint32
+	// Name of the sender, left out of ends of sessions.
+	Name string
+}
+
+// MarshalBinary encodes the packet.
+func (s Session) MarshalBinary() ([]byte, error) {
+	switch s.Command {
+	case Invitation, Accept, Reject, End:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrCommand, s.Command)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint16(signature))
+	buf.WriteString(s.Command)
+	binary.Write(&buf, binary.BigEndian, [3]uint32{Version, s.Token, s.SSRC})
+	if s.Name != "" {
+		buf.WriteString(s.Name)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the packet.
+func (s *Session) UnmarshalBinary(p []byte) error {
+	switch Command(p) {
+	case Invitation, Accept, Reject, End:
+	default:
+		return ErrCommand
+	}
+	if len(p) < 16 {
+		return ErrMalformed
+	}
+
+	s.Command = string(p[2:4])
+	s.Token = binary.BigEndian.Uint32(p[8:12])
+	s.SSRC = binary.BigEndian.Uint32(p[12:16])
+	s.Name = string(bytes.TrimRight(p[16:], "\x00"))
+	return nil
+}
+
+// Clock is an AppleMIDI clock synchronization. The initiator sends its time
+// with Count 0, the listener answers with its own time and Count 1, and the
+// initiator ends with Count 2, every packet holding the times before it.
+type Clock struct {
+	SSRC  uint32
+	Count uint8
+	// Times of the three packets, in ticks of ClockRate.
+	Timestamps [3]uint64
+}
+
+// MarshalBinary encodes the packet.
+func (c Clock) MarshalBinary() ([]byte, error) {
+	p := make([]byte, 36)
+	binary.BigEndian.PutUint16(p, signature)
+	copy(p[2:], Sync)
+	binary.BigEndian.PutUint32(p[4:], c.SSRC)
+	p[8] = c.Count
+	for i, ts := range c.Timestamps {
+		binary.BigEndian.PutUint64(p[12+8*i:], ts)
+	}
+	return p, nil
+}
+
+// UnmarshalBinary decodes the packet.
+func (c *Clock) UnmarshalBinary(p []byte) error {
+	if Command(p) != Sync {
+		return ErrCommand
+	}
+	if len(p) < 36 || p[8] > 2 {
+		return ErrMalformed
+	}
+
+	c.SSRC = binary.BigEndian.Uint32(p[4:])
+	c.Count = p[8]
+	for i := range c.Timestamps {
+		c.Timestamps[i] = binary.BigEndian.Uint64(p[12+8*i:])
+	}
+	return nil
+}
+
+// Packet is an RTP MIDI packet. The recovery journal is never written and
+// is skipped when read, so that lost packets are lost.
+type Packet struct {
+	Sequence  uint16
+	Timestamp uint32
+	SSRC      uint32
+	Commands  []MIDICommand
+}
+
+// MIDICommand is a MIDI message of a packet.
+type MIDICommand struct {
+	// Ticks from the timestamp of the packet, or from the previous command.
+	Delta uint32
+	// Status and data bytes of the message, the status always included.
+	Data []byte
+}
+
+// Flags of the command section. The journal, following the command list,
+// is left unread.
+const (
+	flagLongHeader = 0x80
+	flagFirstDelta = 0x20
+)
+
+// MarshalBinary encodes the packet.
+func (p Packet) MarshalBinary() ([]byte, error) {
+	var list bytes.Buffer
+	for i, c := range p.Commands {
+		if len(c.Data) == 0 || c.Data[0] < 0x80 {
+			return nil, ErrMalformed
+		}
+		if i > 0 {
+			writeDelta(&list, c.Delta)
+		} else if c.Delta != 0 {
+			return nil, fmt.Errorf("%w: the first command has no delta time", ErrMalformed)
+		}
+		list.Write(c.Data)
+	}
+	if list.Len() > 0x0FFF {
+		return nil, fmt.Errorf("%w: command list is %d bytes long", ErrMalformed, list.Len())
+	}
+
+	b := make([]byte, 12, 14+list.Len())
+	b[0] = 0x80 // version 2
+	b[1] = PayloadType
+	binary.BigEndian.PutUint16(b[2:], p.Sequence)
+	binary.BigEndian.PutUint32(b[4:], p.Timestamp)
+	binary.BigEndian.PutUint32(b[8:], p.SSRC)
+	if n := list.Len(); n <= 0x0F {
+		b = append(b, byte(n))
+	} else {
+		b = append(b, flagLongHeader|byte(n>>8), byte(n))
+	}
+	return append(b, list.Bytes()...), nil
+}
+
+// UnmarshalBinary decodes the packet. System messages are skipped.
+func (p *Packet) UnmarshalBinary(b []byte) error {
+	if len(b) < 13 || b[0]>>6 != 2 || b[1]&0x7F != PayloadType {
+		return ErrMalformed
+	}
+	// CSRC identifiers and header extensions
+	skip := 12 + 4*int(b[0]&0x0F)
+	if b[0]&0x10 != 0 {
+		if len(b) < skip+4 {
+			return ErrMalformed
+		}
+		skip += 4 + 4*int(binary.BigEndian.Uint16(b[skip+2:]))
+	}
+	if len(b) <= skip {
+		return ErrMalformed
+	}
+
+	p.Sequence = binary.BigEndian.Uint16(b[2:])
+	p.Timestamp = binary.BigEndian.Uint32(b[4:])
+	p.SSRC = binary.BigEndian.Uint32(b[8:])
+	p.Commands = nil
+
+	flags := b[skip]
+	n := int(flags & 0x0F)
+	list := b[skip+1:]
+	if flags&flagLongHeader != 0 {
+		if len(list) < 1 {
+			return ErrMalformed
+		}
+		n = n<<8 | int(list[0])
+		list = list[1:]
+	}
+	if n > len(list) {
+		return ErrMalformed
+	}
+	list = list[:n]
+
+	var running byte
+	for i := 0; len(list) > 0; i++ {
+		var delta uint32
+		if i > 0 || flags&flagFirstDelta != 0 {
+			var err error
+			if delta, list, err = readDelta(list); err != nil {
+				return err
+			}
+		}
+		if len(list) == 0 {
+			return ErrMalformed
+		}
+
+		status := list[0]
+		if status < 0x80 {
+			// running status, or phantom status of the first command
+			if running == 0 {
+				return ErrMalformed
+			}
+			status = running
+		} else {
+			list = list[1:]
+		}
+
+		size, ok := dataSize(status, list)
+		if !ok || size > len(list) {
+			return ErrMalformed
+		}
+		data := list[:size]
+		list = list[size:]
+
+		if status >= 0xF0 {
+			// system common messages cancel the running status
+			if status < 0xF8 {
+				running = 0
+			}
+			continue
+		}
+		running = status
+		p.Commands = append(p.Commands, MIDICommand{
+			Delta: delta,
+			Data:  append([]byte{status}, data...),
+		})
+	}
+	return nil
+}
+
+// dataSize returns the number of bytes following status in list that belong
+// to its message.
+func dataSize(status byte, list []byte) (int, bool) {
+	switch {
+	case status < 0xC0, status >= 0xE0 && status < 0xF0:
+		return 2, true
+	case status < 0xE0:
+		return 1, true
+	case status == 0xF0, status == 0xF7:
+		// SysEx, or a segment of it, up to and including its end
+		for i, b := range list {
+			if b == 0xF7 || b == 0xF0 || b == 0xF4 {
+				return i + 1, true
+			}
+		}
+		return 0, false
+	case status == 0xF2:
+		return 2, true
+	case status == 0xF1, status == 0xF3:
+		return 1, true
+	}
+	return 0, true
+}
+
+// readDelta reads a delta time of 1 to 4 bytes, 7 bits each.
+func readDelta(p []byte) (uint32, []byte, error) {
+	var d uint32
+	for i := 0; i < 4 && i < len(p); i++ {
+		d = d<<7 | uint32(p[i]&0x7F)
+		if p[i]&0x80 == 0 {
+			return d, p[i+1:], nil
+		}
+	}
+	return 0, nil, ErrMalformed
+}
+
+func writeDelta(buf *bytes.Buffer, d uint32) {
+	var b [4]byte
+	i := len(b) - 1
+	b[i] = byte(d & 0x7F)
+	for d >>= 7; d > 0 && i > 0; d >>= 7 {
+		i--
+		b[i] = byte(d&0x7F) | 0x80
+	}
+	buf.Write(b[i:])
+}
@@ -0,0 +1,78 @@
+package rtpmidi_test
+
+import (
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/rapidmidiex/rmx/pkg/rtpmidi"
+)
+
+func TestSession(t *testing.T) {
+	is := is.New(t)
+
+	in := rtpmidi.Session{Command: rtpmidi.Invitation, Token: 7, SSRC: 0xCAFE, Name: "keys"}
+	p, err := in.MarshalBinary()
+	is.NoErr(err) // marshal invitation
+	is.True(rtpmidi.IsControl(p))
+	is.Equal(rtpmidi.Invitation, rtpmidi.Command(p))
+	is.Equal(21, len(p)) // name is null terminated
+
+	var got rtpmidi.Session
+	is.NoErr(got.UnmarshalBinary(p)) // unmarshal invitation
+	is.Equal(in, got)                // round-trips
+
+	_, err = rtpmidi.Session{Command: rtpmidi.Sync}.MarshalBinary()
+	is.True(err != nil) // clock syncs are not sessions
+
+	is.True(got.UnmarshalBinary(p[:12]) != nil) // truncated
+}
+
+func TestClock(t *testing.T) {
+	is := is.New(t)
+
+	ck := rtpmidi.Clock{SSRC: 1, Count: 1, Timestamps: [3]uint64{100, 200}}
+	p, err := ck.MarshalBinary()
+	is.NoErr(err) // marshal clock
+	is.Equal(36, len(p))
+	is.Equal(rtpmidi.Sync, rtpmidi.Command(p))
+
+	var got rtpmidi.Clock
+	is.NoErr(got.UnmarshalBinary(p)) // unmarshal clock
+	is.Equal(ck, got)                // round-trips
+}
+
+func TestPacket(t *testing.T) {
+	is := is.New(t)
+
+	pkt := rtpmidi.Packet{Sequence: 9, Timestamp: 1000, SSRC: 3, Commands: []rtpmidi.MIDICommand{
+		{Data: []byte{0x90, 60, 100}},
+		{Delta: 300, Data: []byte{0xB1, 7, 64}},
+		{Data: []byte{0xD0, 20}},
+	}}
+	p, err := pkt.MarshalBinary()
+	is.NoErr(err) // marshal packet
+	is.True(!rtpmidi.IsControl(p))
+
+	var got rtpmidi.Packet
+	is.NoErr(got.UnmarshalBinary(p)) // unmarshal packet
+	is.Equal(pkt, got)               // round-trips
+
+	// long header, running status, a SysEx and a timing clock in the list
+	list := []byte{0x90, 60, 100, 0x00, 62, 100, 0x00, 0xF0, 0x7E, 0x01, 0xF7, 0x00, 0xF8, 0x00, 0x80, 60, 0}
+	p = append([]byte{0x80, 0x61, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0x80, byte(len(list))}, list...)
+	is.NoErr(got.UnmarshalBinary(p)) // unmarshal packet with a long header
+	is.Equal([]rtpmidi.MIDICommand{
+		{Data: []byte{0x90, 60, 100}},
+		{Data: []byte{0x90, 62, 100}},
+		{Data: []byte{0x80, 60, 0}},
+	}, got.Commands) // system messages are skipped
+
+	for _, p := range [][]byte{
+		nil,
+		{0x80, 0x61, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0},                 // no command section
+		{0x80, 0x61, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0x03, 0x90, 60}, // list past the end
+		{0x80, 0x61, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0x02, 60, 100},  // no status
+	} {
+		is.True(got.UnmarshalBinary(p) != nil) // malformed packets are rejected
+	}
+}
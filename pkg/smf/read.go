@@ -0,0 +1,244 @@
+package smf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrNotSMF        = errors.New("smf: not a Standard MIDI File")
+	ErrSMPTE         = errors.New("smf: SMPTE time division is not supported")
+	ErrRunningStatus = errors.New("smf: data byte without a running status")
+)
+
+// maxChunkLen bounds the length of a single chunk, files are read into memory.
+const maxChunkLen = 16 << 20
+
+// ReadFile decodes a Standard MIDI File from r.
+// Unknown chunks are skipped as the specification asks.
+func ReadFile(r io.Reader) (*File, error) {
+	br := bufio.NewReader(r)
+
+	typ, hdr, err := readChunk(br)
+	if err != nil || typ != "MThd" || len(hdr) < 6 {
+		return nil, ErrNotSMF
+	}
+
+	f := &File{
+		Format:   binary.BigEndian.Uint16(hdr[0:2]),
+		Division: binary.BigEndian.Uint16(hdr[4:6]),
+	}
+	ntrks := int(binary.BigEndian.Uint16(hdr[2:4]))
+
+	if f.Division&0x8000 != 0 {
+		return nil, ErrSMPTE
+	}
+
+	for len(f.Tracks) < ntrks {
+		typ, p, err := readChunk(br)
+		if err != nil {
+			return nil, fmt.Errorf("smf: track %d: %w", len(f.Tracks), err)
+		}
+
+		if typ != "MTrk" {
+			continue
+		}
+
+		t, err := decodeTrack(p)
+		if err != nil {
+			return nil, fmt.Errorf("smf: track %d: %w", len(f.Tracks), err)
+		}
+		f.Tracks = append(f.Tracks, t)
+	}
+
+	return f, nil
+}
+
+func readChunk(r io.Reader) (typ string, p []byte, err error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", nil, err
+	}
+
+	n := binary.BigEndian.Uint32(hdr[4:])
+	if n > maxChunkLen {
+		return "", nil, fmt.Errorf("chunk of %d bytes is too long", n)
+	}
+
+	p = make([]byte, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return "", nil, err
+	}
+
+	return string(hdr[:4]), p, nil
+}
+
+// decodeTrack decodes the events of a track chunk with absolute ticks.
+// The end of track event is kept so the length of the track is known.
+func decodeTrack(p []byte) (Track, error) {
+	var (
+		t       Track
+		tick    uint32
+		running byte
+	)
+
+	d := decoder{p: p}
+	for d.len() > 0 {
+		delta, err := d.varLen()
+		if err != nil {
+			return t, err
+		}
+		tick += delta
+
+		status, err := d.byte()
+		if err != nil {
+			return t, err
+		}
+
+		e := Event{Tick: tick, Status: status}
+		switch {
+		case status == MetaEvent:
+			if e.Meta, err = d.byte(); err != nil {
+				return t, err
+			}
+			if e.Data, err = d.lenBytes(); err != nil {
+				return t, err
+			}
+			// running status is cancelled by meta and system exclusive events
+			running = 0
+		case status == SysExEvent || status == 0xF7:
+			e.Status = SysExEvent
+			if e.Data, err = d.lenBytes(); err != nil {
+				return t, err
+			}
+			running = 0
+		case status > 0xF0:
+			return t, fmt.Errorf("unexpected system message %#x", status)
+		case status < 0x80:
+			if running == 0 {
+				return t, ErrRunningStatus
+			}
+			// the byte read is the first data byte
+			d.i--
+			e.Status = running
+			fallthrough
+		default:
+			n := dataLen(e.Status)
+			if e.Data, err = d.bytes(n); err != nil {
+				return t, err
+			}
+			running = e.Status
+		}
+
+		t = append(t, e)
+		if e.Status == MetaEvent && e.Meta == MetaEndOfTrack {
+			break
+		}
+	}
+
+	return t, nil
+}
+
+// dataLen returns the number of data bytes following a channel message status.
+func dataLen(status byte) int {
+	switch status & 0xF0 {
+	case 0xC0, 0xD0:
+		return 1
+	}
+	return 2
+}
+
+type decoder struct {
+	p []byte
+	i int
+}
+
+func (d *decoder) len() int { return len(d.p) - d.i }
+
+func (d *decoder) byte() (byte, error) {
+	if d.len() < 1 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := d.p[d.i]
+	d.i++
+	return b, nil
+}
+
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if d.len() < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.p[d.i : d.i+n : d.i+n]
+	d.i += n
+	return b, nil
+}
+
+// lenBytes reads bytes prefixed by their length as a variable-length quantity.
+func (d *decoder) lenBytes() ([]byte, error) {
+	n, err := d.varLen()
+	if err != nil {
+		return nil, err
+	}
+	return d.bytes(int(n))
+}
+
+// varLen reads a variable-length quantity of at most 4 bytes.
+func (d *decoder) varLen() (uint32, error) {
+	var v uint32
+	for i := 0; i < 4; i++ {
+		b, err := d.byte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("variable-length quantity is too long")
+}
+
+// BPM returns the tempo set by a tempo meta event.
+func (e Event) BPM() (float64, bool) {
+	if e.Status != MetaEvent || e.Meta != MetaTempo || len(e.Data) != 3 {
+		return 0, false
+	}
+
+	us := uint32(e.Data[0])<<16 | uint32(e.Data[1])<<8 | uint32(e.Data[2])
+	if us == 0 {
+		return 0, false
+	}
+	return 60_000_000 / float64(us), true
+}
+
+// Channel returns the channel of a channel message.
+func (e Event) Channel() (uint8, bool) {
+	if e.Status < 0x80 || e.Status >= 0xF0 {
+		return 0, false
+	}
+	return e.Status & 0x0F, true
+}
+
+// Name returns the name of a track, set by its first track name event.
+func (t Track) Name() string {
+	for _, e := range t {
+		if e.Status == MetaEvent && e.Meta == MetaTrackName {
+			return string(e.Data)
+		}
+	}
+	return ""
+}
+
+// End returns the tick of the end of the track.
+func (t Track) End() uint32 {
+	var end uint32
+	for _, e := range t {
+		if e.Tick > end {
+			end = e.Tick
+		}
+	}
+	return end
+}
@@ -0,0 +1,230 @@
+// Package smf reads and writes Standard MIDI Files.
+package smf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// Formats of a Standard MIDI File.
+const (
+	// SingleTrack files hold a single multi-channel track.
+	SingleTrack uint16 = iota
+	// MultiTrack files hold simultaneous tracks, the first one usually
+	// holding the tempo map.
+	MultiTrack
+	// Sequential files hold independent single-track patterns.
+	Sequential
+)
+
+// DefaultDivision is the number of ticks per quarter note used when none is set.
+const DefaultDivision = 480
+
+const (
+	// MetaEvent is the status of meta events.
+	MetaEvent byte = 0xFF
+	// SysExEvent is the status of system exclusive events.
+	SysExEvent byte = 0xF0
+)
+
+// Meta event types.
+const (
+	MetaTrackName  byte = 0x03
+	MetaMarker     byte = 0x06
+	MetaEndOfTrack byte = 0x2F
+	MetaTempo      byte = 0x51
+)
+
+// Channel message statuses, without the channel.
+const (
+	NoteOff         byte = 0x80
+	NoteOn          byte = 0x90
+	ControlChange   byte = 0xB0
+	ChannelPressure byte = 0xD0
+	PitchBend       byte = 0xE0
+)
+
+var ErrTooManyTracks = errors.New("smf: a single track file must have exactly one track")
+
+// File is a Standard MIDI File.
+type File struct {
+	Format uint16
+	// Ticks per quarter note.
+	Division uint16
+	Tracks   []Track
+}
+
+// Track is a list of events. Events do not need to be sorted, they are
+// written in the order of their ticks. End of track events are added when
+// the track is written.
+type Track []Event
+
+// Event is a MIDI, meta or system exclusive event.
+type Event struct {
+	// Absolute time of the event from the start of its track, in ticks.
+	Tick uint32
+	// Status byte of a channel message including its channel, or one of
+	// MetaEvent and SysExEvent.
+	Status byte
+	// Type of a meta event.
+	Meta byte
+	// Data bytes following the status byte of a channel message, or the
+	// payload of meta and system exclusive events without their length.
+	Data []byte
+}
+
+// NewNoteOn returns a note on event. ch is the channel, from 0 to 15.
+func NewNoteOn(tick uint32, ch, key, velocity uint8) Event {
+	return Event{Tick: tick, Status: NoteOn | ch&0x0F, Data: []byte{key & 0x7F, velocity & 0x7F}}
+}
+
+// NewNoteOff returns a note off event. ch is the channel, from 0 to 15.
+func NewNoteOff(tick uint32, ch, key, velocity uint8) Event {
+	return Event{Tick: tick, Status: NoteOff | ch&0x0F, Data: []byte{key & 0x7F, velocity & 0x7F}}
+}
+
+// NewControlChange returns a control change event. ch is the channel, from 0 to 15.
+func NewControlChange(tick uint32, ch, controller, value uint8) Event {
+	return Event{Tick: tick, Status: ControlChange | ch&0x0F, Data: []byte{controller & 0x7F, value & 0x7F}}
+}
+
+// NewChannelPressure returns a channel pressure event. ch is the channel, from 0 to 15.
+func NewChannelPressure(tick uint32, ch, pressure uint8) Event {
+	return Event{Tick: tick, Status: ChannelPressure | ch&0x0F, Data: []byte{pressure & 0x7F}}
+}
+
+// NewPitchBend returns a pitch bend event with a 14-bit value, 8192 not
+// bending. ch is the channel, from 0 to 15.
+func NewPitchBend(tick uint32, ch uint8, value uint16) Event {
+	return Event{Tick: tick, Status: PitchBend | ch&0x0F, Data: []byte{byte(value & 0x7F), byte(value>>7) & 0x7F}}
+}
+
+// NewTempo returns a tempo change to the given beats per minute.
+func NewTempo(tick uint32, bpm float64) Event {
+	us := uint32(60_000_000 / bpm)
+	return Event{Tick: tick, Status: MetaEvent, Meta: MetaTempo, Data: []byte{byte(us >> 16), byte(us >> 8), byte(us)}}
+}
+
+// NewTrackName returns a track name meta event.
+func NewTrackName(name string) Event {
+	return Event{Status: MetaEvent, Meta: MetaTrackName, Data: []byte(name)}
+}
+
+// NewMarker returns a meta event labelling a point of the sequence, such as a section or a chord.
+func NewMarker(tick uint32, text string) Event {
+	return Event{Tick: tick, Status: MetaEvent, Meta: MetaMarker, Data: []byte(text)}
+}
+
+// WriteTo encodes the file into w.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	if f.Format == SingleTrack && len(f.Tracks) != 1 {
+		return 0, ErrTooManyTracks
+	}
+
+	division := f.Division
+	if division == 0 {
+		division = DefaultDivision
+	}
+
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+
+	hdr := make([]byte, 0, 14)
+	hdr = append(hdr, "MThd"...)
+	hdr = binary.BigEndian.AppendUint32(hdr, 6)
+	hdr = binary.BigEndian.AppendUint16(hdr, f.Format)
+	hdr = binary.BigEndian.AppendUint16(hdr, uint16(len(f.Tracks)))
+	hdr = binary.BigEndian.AppendUint16(hdr, division)
+	cw.write(hdr)
+
+	for _, t := range f.Tracks {
+		p := t.encode()
+
+		chunk := make([]byte, 0, 8)
+		chunk = append(chunk, "MTrk"...)
+		chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(p)))
+		cw.write(chunk)
+		cw.write(p)
+	}
+
+	if cw.err == nil {
+		cw.err = bw.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+// encode returns the events of the track, in order and with delta times,
+// followed by an end of track event.
+func (t Track) encode() []byte {
+	es := make([]Event, 0, len(t))
+	var end uint32
+	for _, e := range t {
+		if e.Status == MetaEvent && e.Meta == MetaEndOfTrack {
+			if e.Tick > end {
+				end = e.Tick
+			}
+			continue
+		}
+		es = append(es, e)
+	}
+
+	sort.SliceStable(es, func(i, j int) bool { return es[i].Tick < es[j].Tick })
+
+	var p []byte
+	var tick uint32
+	for _, e := range es {
+		p = appendVarLen(p, e.Tick-tick)
+		tick = e.Tick
+
+		switch e.Status {
+		case MetaEvent:
+			p = append(p, MetaEvent, e.Meta)
+			p = appendVarLen(p, uint32(len(e.Data)))
+		case SysExEvent:
+			p = append(p, SysExEvent)
+			p = appendVarLen(p, uint32(len(e.Data)))
+		default:
+			p = append(p, e.Status)
+		}
+		p = append(p, e.Data...)
+	}
+
+	if end < tick {
+		end = tick
+	}
+
+	p = appendVarLen(p, end-tick)
+	return append(p, MetaEvent, MetaEndOfTrack, 0)
+}
+
+// appendVarLen appends v as a variable-length quantity.
+func appendVarLen(p []byte, v uint32) []byte {
+	var buf [5]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7F)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7F) | 0x80
+	}
+	return append(p, buf[i:]...)
+}
+
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) write(p []byte) {
+	if cw.err != nil {
+		return
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+}
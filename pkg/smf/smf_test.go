@@ -0,0 +1,124 @@
+package smf_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/rapidmidiex/rmx/pkg/smf"
+)
+
+func TestWriteTo(t *testing.T) {
+	is := is.New(t)
+
+	f := smf.File{
+		Format:   smf.MultiTrack,
+		Division: 96,
+		Tracks: []smf.Track{
+			{smf.NewTempo(0, 120)},
+			{
+				// out of order on purpose
+				smf.NewNoteOff(200, 1, 60, 0),
+				smf.NewTrackName("keys"),
+				smf.NewNoteOn(0, 1, 60, 100),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	is.NoErr(err)                      // write file
+	is.Equal(int64(buf.Len()), n)      // every byte is counted
+	is.Equal("MThd", buf.String()[:4]) // header chunk
+
+	want := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, 2, 0, 96,
+		'M', 'T', 'r', 'k', 0, 0, 0, 11,
+		0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // 500000µs per quarter note
+		0x00, 0xFF, 0x2F, 0x00,
+		'M', 'T', 'r', 'k', 0, 0, 0, 21,
+		0x00, 0xFF, 0x03, 0x04, 'k', 'e', 'y', 's',
+		0x00, 0x91, 60, 100,
+		0x81, 0x48, 0x81, 60, 0, // 200 ticks as a variable-length quantity
+		0x00, 0xFF, 0x2F, 0x00,
+	}
+	is.Equal(want, buf.Bytes()) // encoded file
+}
+
+func TestWriteToSingleTrack(t *testing.T) {
+	is := is.New(t)
+
+	f := smf.File{Format: smf.SingleTrack, Tracks: []smf.Track{{}, {}}}
+
+	_, err := f.WriteTo(&bytes.Buffer{})
+	is.Equal(smf.ErrTooManyTracks, err) // format 0 files have a single track
+}
+
+func TestReadFile(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		is := is.New(t)
+
+		in := smf.File{
+			Format:   smf.MultiTrack,
+			Division: 96,
+			Tracks: []smf.Track{
+				{smf.NewTempo(0, 120)},
+				{smf.NewTrackName("bass"), smf.NewNoteOn(0, 2, 40, 90), smf.NewNoteOff(384, 2, 40, 0)},
+			},
+		}
+
+		var buf bytes.Buffer
+		_, err := in.WriteTo(&buf)
+		is.NoErr(err) // write file
+
+		out, err := smf.ReadFile(&buf)
+		is.NoErr(err)                       // read file
+		is.Equal(in.Format, out.Format)     // format
+		is.Equal(in.Division, out.Division) // division
+		is.Equal(2, len(out.Tracks))        // tracks
+
+		bpm, ok := out.Tracks[0][0].BPM()
+		is.True(ok)          // tempo event
+		is.Equal(120.0, bpm) // tempo
+
+		bass := out.Tracks[1]
+		is.Equal("bass", bass.Name())     // track name
+		is.Equal(uint32(384), bass.End()) // end of track
+		is.Equal(4, len(bass))            // name, note on, note off, end of track
+
+		ch, ok := bass[1].Channel()
+		is.True(ok)            // channel message
+		is.Equal(uint8(2), ch) // channel
+		is.Equal(smf.NoteOn|2, bass[1].Status)
+		is.Equal([]byte{40, 90}, bass[1].Data)
+	})
+
+	t.Run("running status", func(t *testing.T) {
+		is := is.New(t)
+
+		p := []byte{
+			'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96,
+			'M', 'T', 'r', 'k', 0, 0, 0, 11,
+			0x00, 0x90, 60, 100,
+			0x60, 60, 0, // note on with a velocity of 0, 96 ticks later
+			0x00, 0xFF, 0x2F, 0x00,
+		}
+
+		f, err := smf.ReadFile(bytes.NewReader(p))
+		is.NoErr(err) // read file
+
+		track := f.Tracks[0]
+		is.Equal(3, len(track))                // note on, note on, end of track
+		is.Equal(smf.NoteOn, track[1].Status)  // running status is applied
+		is.Equal(uint32(96), track[1].Tick)    // ticks are absolute
+		is.Equal([]byte{60, 0}, track[1].Data) // data bytes
+	})
+
+	t.Run("not a midi file", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := smf.ReadFile(strings.NewReader("RIFF...."))
+		is.Equal(smf.ErrNotSMF, err) // wrong header
+	})
+}
@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// statusTryAgainLater is the IANA registered close code telling a client
+// to reconnect later. gobwas/ws does not define it.
+const statusTryAgainLater ws.StatusCode = 1013
+
+// Capacity returns the maximum number of seated connections, 0 means unlimited.
+func (cli *Client) Capacity() uint {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	return cli.capacity
+}
+
+// SetCapacity changes the maximum number of seated connections at runtime.
+//
+// Raising it seats waitlisted connections. Lowering it below the number of
+// seated connections takes the seats of the most recently seated ones: they
+// go back to the front of the waitlist, or are disconnected if the client
+// has no waitlist.
+func (cli *Client) SetCapacity(n uint) {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+
+	cli.capacity = n
+	cli.trim()
+	cli.promote()
+}
+
+// Reserve holds a seat for a participant who does not connect through the
+// client, such as a peer bridged over another transport, until Release is
+// called. It reports false if the client is full.
+func (cli *Client) Reserve() bool {
+	return cli.reserve()
+}
+
+// Release gives back a seat held with Reserve to the next in line.
+func (cli *Client) Release() {
+	cli.release()
+}
+
+// reserve holds a seat for a connection that has yet to register.
+// It reports false if the client is full.
+func (cli *Client) reserve() bool {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+
+	if cli.isFull() {
+		return false
+	}
+
+	cli.pending++
+	return true
+}
+
+// release gives back a seat held with reserve to the next in line.
+func (cli *Client) release() {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	cli.pending--
+	cli.promote()
+}
+
+// sit gives the connection a seat. It must be called with the lock held.
+func (cli *Client) sit(conn *connHandler) {
+	cli.seats++
+	conn.seat = cli.seats
+	cli.connections[conn] = true
+}
+
+// trim takes seats from the most recently seated connections until the
+// client is within capacity. It reports whether connections were moved to
+// the waitlist. It must be called with the lock held.
+func (cli *Client) trim() (waitlisted bool) {
+	if cli.capacity == 0 {
+		return false
+	}
+
+	for cli.seated()+cli.pending > int(cli.capacity) {
+		conn := cli.newest()
+		if conn == nil {
+			return waitlisted
+		}
+
+		if cli.handleQueue != nil {
+			cli.connections[conn] = false
+			cli.waitlist = append([]*connHandler{conn}, cli.waitlist...)
+			waitlisted = true
+			continue
+		}
+
+		select {
+		case conn.send <- &wsutil.Message{
+			OpCode:  ws.OpClose,
+			Payload: ws.NewCloseFrameBody(statusTryAgainLater, "jam capacity reduced"),
+		}:
+		default:
+		}
+		cli.remove(conn)
+	}
+	return waitlisted
+}
+
+// newest returns the most recently seated connection.
+// It must be called with the lock held.
+func (cli *Client) newest() *connHandler {
+	var newest *connHandler
+	for conn, seated := range cli.connections {
+		if seated && (newest == nil || conn.seat > newest.seat) {
+			newest = conn
+		}
+	}
+	return newest
+}
@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gobwas/httphead"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// DefaultCompressionThreshold is the size, in bytes, under which messages are
+// not compressed if Compression.Threshold is zero. Single notes stay under it.
+const DefaultCompressionThreshold = 256
+
+var ErrCompressionLevel = errors.New("compression level must be between -2 and 9, 0 being the default level")
+
+// deflateTail ends every flushed deflate block, RFC 7692 removes it from the
+// compressed payload.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// Compression configures the permessage-deflate extension (RFC 7692).
+type Compression struct {
+	// Level of compress/flate. Zero is not flate.NoCompression but stands
+	// for flate.DefaultCompression: messages that should not be compressed
+	// are sent without negotiating compression at all.
+	Level int
+	// ContextTakeover keeps the compression context of the server from one
+	// message to the next, which compresses better but holds on to memory
+	// for each connection. Clients are always asked not to keep theirs.
+	ContextTakeover bool
+	// Threshold is the size, in bytes, of the smallest message compressed,
+	// DefaultCompressionThreshold if zero.
+	Threshold int
+}
+
+// Validate reports whether the level of c is one of compress/flate.
+func (c Compression) Validate() error {
+	if c.Level < flate.HuffmanOnly || c.Level > flate.BestCompression {
+		return ErrCompressionLevel
+	}
+	return nil
+}
+
+// WithCompression negotiates permessage-deflate with the connections offering it.
+func WithCompression(c Compression) Option {
+	return func(cli *Client) {
+		cli.compression = &c
+	}
+}
+
+// SetCompression changes the compression negotiated with new connections,
+// connections already open keep the one they negotiated.
+func (cli *Client) SetCompression(c Compression) {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	cli.compression = &c
+}
+
+// negotiator returns an upgrader negotiating the compression of the client,
+// and a func reporting the parameters accepted once the upgrade is done.
+// It returns the upgrader of the client if compression is disabled.
+func (cli *Client) negotiator() (*ws.HTTPUpgrader, func() (wsflate.Parameters, bool)) {
+	cli.lock.Lock()
+	c := cli.compression
+	cli.lock.Unlock()
+
+	if c == nil {
+		return cli.upgrader, func() (wsflate.Parameters, bool) { return wsflate.Parameters{}, false }
+	}
+
+	var (
+		accepted wsflate.Parameters
+		ok       bool
+	)
+	u := *cli.upgrader
+	u.Negotiate = func(opt httphead.Option) (httphead.Option, error) {
+		// offers are made in order of preference, the first valid one wins
+		if ok || !bytes.Equal(opt.Name, wsflate.ExtensionNameBytes) {
+			return httphead.Option{}, nil
+		}
+
+		var offer wsflate.Parameters
+		if err := offer.Parse(opt); err != nil {
+			return httphead.Option{}, nil
+		}
+		// compress/flate always uses the largest window
+		if offer.ServerMaxWindowBits.Defined() && offer.ServerMaxWindowBits.Bytes() < wsflate.MaxLZ77WindowSize {
+			return httphead.Option{}, nil
+		}
+
+		accepted = wsflate.Parameters{
+			ServerNoContextTakeover: offer.ServerNoContextTakeover || !c.ContextTakeover,
+			ClientNoContextTakeover: true,
+		}
+		ok = true
+		return accepted.Option(), nil
+	}
+
+	return &u, func() (wsflate.Parameters, bool) { return accepted, ok }
+}
+
+// deflater compresses the messages written to a connection.
+type deflater struct {
+	level, threshold int
+	takeover         bool
+
+	buf bytes.Buffer
+	fw  *flate.Writer
+}
+
+func newDeflater(c Compression, p wsflate.Parameters) *deflater {
+	d := &deflater{
+		level:     c.Level,
+		threshold: c.Threshold,
+		takeover:  !p.ServerNoContextTakeover,
+	}
+	if d.level == 0 {
+		d.level = flate.DefaultCompression
+	}
+	if d.threshold == 0 {
+		d.threshold = DefaultCompressionThreshold
+	}
+	return d
+}
+
+// compress returns the frame of a data message, compressed if it is large enough.
+func (d *deflater) compress(m *wsutil.Message) (ws.Frame, error) {
+	frame := ws.NewFrame(m.OpCode, true, m.Payload)
+	if len(m.Payload) < d.threshold {
+		return frame, nil
+	}
+
+	d.buf.Reset()
+	switch {
+	case d.fw == nil:
+		fw, err := flate.NewWriter(&d.buf, d.level)
+		if err != nil {
+			return frame, fmt.Errorf("flate writer: %w", err)
+		}
+		d.fw = fw
+	case !d.takeover:
+		d.fw.Reset(&d.buf)
+	}
+
+	if _, err := d.fw.Write(m.Payload); err != nil {
+		return frame, fmt.Errorf("deflate: %w", err)
+	}
+	if err := d.fw.Flush(); err != nil {
+		return frame, fmt.Errorf("deflate flush: %w", err)
+	}
+
+	frame = ws.NewFrame(m.OpCode, true, bytes.TrimSuffix(d.buf.Bytes(), deflateTail))
+	return frame, setCompressed(&frame.Header)
+}
+
+func setCompressed(h *ws.Header) (err error) {
+	*h, err = wsflate.SetBit(*h)
+	return err
+}
+
+// inflate decompresses the payload of a message. Clients do not keep their
+// compression context so every message is decompressed on its own.
+func inflate(p []byte) ([]byte, error) {
+	r := wsflate.NewReader(bytes.NewReader(p), func(r io.Reader) wsflate.Decompressor {
+		return flate.NewReader(r)
+	})
+	defer r.Close()
+
+	p, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("inflate: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ProtocolHandler returns the options of the connection identified by id,
+// once it negotiated a subprotocol.
+type ProtocolHandler func(id uuid.UUID, protocol string) []ConnOption
+
+// WithProtocols negotiates one of the given subprotocols with every
+// connection, in the order the client offered them, through the
+// Sec-WebSocket-Protocol header. Clients offering none of them are
+// rejected; clients offering no subprotocol at all are still accepted.
+// h is called with the negotiated subprotocol, it may be nil.
+func WithProtocols(h ProtocolHandler, protocols ...string) Option {
+	return func(cli *Client) {
+		cli.protocols = protocols
+		cli.handleProtocol = h
+	}
+}
+
+// supports reports whether protocol is one of the subprotocols of the client.
+func (cli *Client) supports(protocol string) bool {
+	for _, p := range cli.protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProtocols returns an error naming the supported subprotocols if the
+// request offers subprotocols, none of which the client supports.
+func (cli *Client) checkProtocols(r *http.Request) error {
+	offered := offeredProtocols(r)
+	if len(cli.protocols) == 0 || len(offered) == 0 {
+		return nil
+	}
+
+	for _, p := range offered {
+		if cli.supports(p) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported subprotocol %s, the server supports: %s",
+		strings.Join(offered, ", "), strings.Join(cli.protocols, ", "))
+}
+
+// offeredProtocols returns the subprotocols offered by a request, in order.
+func offeredProtocols(r *http.Request) []string {
+	var ps []string
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				ps = append(ps, p)
+			}
+		}
+	}
+	return ps
+}
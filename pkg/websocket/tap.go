@@ -0,0 +1,35 @@
+package websocket
+
+import "github.com/gobwas/ws/wsutil"
+
+// Tap receives every message broadcast to the connections of a client, such
+// as to mirror the room to something that is not a websocket. It is called
+// from the goroutine broadcasting the messages and must not block.
+type Tap func(m *wsutil.Message)
+
+// Tap calls f with every data message broadcast from now on, until the
+// returned func is called.
+func (cli *Client) Tap(f Tap) (untap func()) {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+
+	cli.lastTap++
+	id := cli.lastTap
+	cli.taps[id] = f
+
+	return func() {
+		cli.lock.Lock()
+		defer cli.lock.Unlock()
+		delete(cli.taps, id)
+	}
+}
+
+// tap must be called with the lock held.
+func (cli *Client) tap(m *wsutil.Message) {
+	if !m.OpCode.IsData() {
+		return
+	}
+	for _, f := range cli.taps {
+		f(m)
+	}
+}
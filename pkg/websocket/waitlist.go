@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
+)
+
+// QueueHandler returns the message telling the connection identified by id
+// its position in the waitlist. Position 0 means the connection was given a
+// seat. A nil message is not sent.
+type QueueHandler func(id uuid.UUID, position int) *wsutil.Message
+
+// WithWaitlist makes connections beyond capacity wait in line instead of being
+// rejected. They are given a seat in the order they arrived as seats free up,
+// and are sent their position whenever it changes.
+func WithWaitlist(h QueueHandler) Option {
+	return func(cli *Client) {
+		cli.handleQueue = h
+	}
+}
+
+// AsListener lets a waitlisted connection receive the room's messages while it
+// waits. It has no effect once the connection has a seat.
+func AsListener() ConnOption {
+	return func(c *connHandler) {
+		c.listener = true
+	}
+}
+
+// Waiting returns the number of waitlisted connections.
+func (cli *Client) Waiting() int {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	return len(cli.waitlist)
+}
+
+func (cli *Client) isSeated(conn *connHandler) bool {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	return cli.connections[conn]
+}
+
+// seated must be called with the lock held.
+func (cli *Client) seated() int {
+	var n int
+	for _, seated := range cli.connections {
+		if seated {
+			n++
+		}
+	}
+	return n
+}
+
+// isFull must be called with the lock held.
+func (cli *Client) isFull() bool {
+	return cli.capacity > 0 && cli.seated()+cli.pending >= int(cli.capacity)
+}
+
+// enqueue must be called with the lock held.
+func (cli *Client) enqueue(conn *connHandler) {
+	cli.connections[conn] = false
+	cli.waitlist = append(cli.waitlist, conn)
+	cli.notify(conn, len(cli.waitlist))
+}
+
+// remove drops the connection and gives its seat to the next in line.
+// It must be called with the lock held.
+func (cli *Client) remove(conn *connHandler) {
+	delete(cli.connections, conn)
+	close(conn.send)
+
+	if cli.handleLeave != nil && !cli.connected(conn.id) {
+		go cli.handleLeave(conn.id)
+	}
+
+	for i, c := range cli.waitlist {
+		if c == conn {
+			cli.waitlist = append(cli.waitlist[:i], cli.waitlist[i+1:]...)
+			break
+		}
+	}
+
+	cli.promote()
+}
+
+// promote seats waitlisted connections while there is room and tells the
+// remaining ones their new position. It must be called with the lock held.
+func (cli *Client) promote() {
+	if len(cli.waitlist) == 0 {
+		return
+	}
+
+	for len(cli.waitlist) > 0 && !cli.isFull() {
+		conn := cli.waitlist[0]
+		cli.waitlist = cli.waitlist[1:]
+		cli.sit(conn)
+		cli.notify(conn, 0)
+	}
+
+	for i, conn := range cli.waitlist {
+		cli.notify(conn, i+1)
+	}
+}
+
+// notify must be called with the lock held.
+func (cli *Client) notify(conn *connHandler, position int) {
+	if cli.handleQueue == nil {
+		return
+	}
+
+	m := cli.handleQueue(conn.id, position)
+	if m == nil {
+		return
+	}
+
+	select {
+	case conn.send <- m:
+	default:
+		conn.debug("conn.send channel buffer possible full\n")
+	}
+}
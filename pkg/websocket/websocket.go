@@ -13,7 +13,9 @@ import (
 	"time"
 
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
 	"github.com/rapidmidiex/rmx/internal/msg"
 )
 
@@ -48,13 +50,39 @@ func read(conn *connHandler, cli *Client) {
 			break
 		}
 
+		if conn.decode != nil {
+			if wsMsg, err = conn.decode(wsMsg); err != nil {
+				conn.logF("decode: %v\n", err)
+				continue
+			}
+		}
+
 		// TODO: add a way use custom read validation here unsure how yet
 		var envelope msg.Envelope
 		log.Printf("read msg: OpCode: %v\n\n", wsMsg.OpCode)
-		if err := json.Unmarshal(wsMsg.Payload, &envelope); err != nil {
-			log.Printf("wsMsg unmarshal: %v", err)
-		} else {
-			log.Printf("read msg:\nType: %d\nID: %s\nUserID: %s\n\n", envelope.Typ, envelope.ID, envelope.UserID)
+		// binary frames are left to the message handler to decode
+		if wsMsg.OpCode == ws.OpText {
+			if err := json.Unmarshal(wsMsg.Payload, &envelope); err != nil {
+				log.Printf("wsMsg unmarshal: %v", err)
+			} else {
+				log.Printf("read msg:\nType: %d\nID: %s\nUserID: %s\n\n", envelope.Typ, envelope.ID, envelope.UserID)
+			}
+		}
+
+		// waiting connections may listen but not play
+		if !cli.isSeated(conn) {
+			continue
+		}
+
+		if cli.handleMessage != nil {
+			if wsMsg, err = cli.handleMessage(conn.id, wsMsg); err != nil {
+				conn.logF("handle message: %v\n", err)
+				continue
+			}
+			// handler chose to drop the message
+			if wsMsg == nil {
+				continue
+			}
 		}
 
 		cli.broadcast <- wsMsg
@@ -81,10 +109,16 @@ func write(conn *connHandler) {
 				return
 			}
 
-			if err := conn.write(msg); err != nil {
+			if err := conn.writeEncoded(msg); err != nil {
 				conn.logF("msg err: %v\n", err)
 				return
 			}
+
+			// a close frame sent to a single connection (see Client.Kick)
+			// ends the session for that connection only
+			if msg.OpCode == ws.OpClose {
+				return
+			}
 		case <-ticker.C:
 			_ = conn.setWriteDeadLine(writeWait)
 			if err := conn.write(&wsutil.Message{OpCode: ws.OpPing, Payload: nil}); err != nil {
@@ -95,23 +129,175 @@ func write(conn *connHandler) {
 	}
 }
 
+// MessageHandler is called for every data message read from a connection,
+// before it is broadcast. The returned message is broadcast in place of the
+// original one; a nil message is dropped. id identifies the sending connection.
+type MessageHandler func(id uuid.UUID, m *wsutil.Message) (*wsutil.Message, error)
+
+type ConnOption func(*connHandler)
+
+// Encoder rewrites a data message into the messages written to a single
+// connection, such as an encoding the connection negotiated. Nothing is
+// written if it returns no message. It is only called from the goroutine
+// writing to that connection.
+type Encoder func(m *wsutil.Message) []*wsutil.Message
+
+// WithEncoder rewrites every data message written to the connection with enc.
+func WithEncoder(enc Encoder) ConnOption {
+	return func(c *connHandler) {
+		c.encode = enc
+	}
+}
+
+// Decoder rewrites a data message read from a single connection, before it
+// goes to the message handler. It undoes what the Encoder of the connection does.
+type Decoder func(m *wsutil.Message) (*wsutil.Message, error)
+
+// WithDecoder rewrites every data message read from the connection with dec.
+func WithDecoder(dec Decoder) ConnOption {
+	return func(c *connHandler) {
+		c.decode = dec
+	}
+}
+
+// WithAdmission admits the connection only if admit succeeds once the
+// handshake is done, so that what it uses up, such as an invite, is not
+// spent on failed handshakes. Otherwise the connection is closed with the
+// error as reason.
+func WithAdmission(admit func() error) ConnOption {
+	return func(c *connHandler) {
+		c.admit = admit
+	}
+}
+
+// JoinHandler returns the first message sent to the connection identified by
+// id, before any broadcast. A nil message is not sent.
+type JoinHandler func(id uuid.UUID) *wsutil.Message
+
+// LeaveHandler is called once the last connection identified by id is gone.
+// It is called on its own goroutine so that it may broadcast, by which time
+// a new connection may have been made under id, see Connected.
+type LeaveHandler func(id uuid.UUID)
+
 type Client struct {
 	register, unregister chan *connHandler
 	broadcast            chan *wsutil.Message
 	lock                 *sync.Mutex
-	connections          map[*connHandler]bool
-	upgrader             *ws.HTTPUpgrader
+	// the value is true if the connection has a seat, false if it is waitlisted
+	connections map[*connHandler]bool
+	waitlist    []*connHandler
+	upgrader    *ws.HTTPUpgrader
+
+	handleMessage  MessageHandler
+	handleQueue    QueueHandler
+	handleJoin     JoinHandler
+	handleLeave    LeaveHandler
+	handleProtocol ProtocolHandler
+
+	// subprotocols negotiated with connections, see WithProtocols
+	protocols []string
+	// permessage-deflate offered to new connections, nil if disabled.
+	// Guarded by lock, see SetCompression.
+	compression *Compression
+
+	// Maximum number of seated connections, 0 means unlimited.
+	// Guarded by lock, see SetCapacity.
+	capacity uint
+	// seats reserved for connections in the middle of their handshake
+	pending int
+	// incremented every time a connection is given a seat
+	seats uint64
+
+	// taps of the broadcast messages, by id. Guarded by lock, see Tap.
+	taps    map[int]Tap
+	lastTap int
+}
+
+type Option func(*Client)
+
+// WithMessageHandler sets the handler every incoming data message goes
+// through before being broadcast.
+func WithMessageHandler(h MessageHandler) Option {
+	return func(cli *Client) {
+		cli.handleMessage = h
+	}
+}
 
-	// Capacity of the send channel.
-	// If capacity is 0, the send channel is unbuffered.
-	Capacity uint
+// WithJoinHandler sets the handler greeting new connections.
+func WithJoinHandler(h JoinHandler) Option {
+	return func(cli *Client) {
+		cli.handleJoin = h
+	}
 }
 
-// Len returns the number of connections.
+// WithLeaveHandler sets the handler told when connections are gone.
+func WithLeaveHandler(h LeaveHandler) Option {
+	return func(cli *Client) {
+		cli.handleLeave = h
+	}
+}
+
+// Connected reports whether a connection is registered under id, seated or not.
+func (cli *Client) Connected(id uuid.UUID) bool {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+	return cli.connected(id)
+}
+
+// connected must be called with the lock held.
+func (cli *Client) connected(id uuid.UUID) bool {
+	for conn := range cli.connections {
+		if conn.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of connections holding a seat.
 func (cli *Client) Len() int {
 	cli.lock.Lock()
 	defer cli.lock.Unlock()
-	return len(cli.connections)
+	return cli.seated()
+}
+
+// Send sends a message to every connection identified by id.
+// It reports whether at least one connection received the message.
+func (cli *Client) Send(id uuid.UUID, m *wsutil.Message) bool {
+	cli.lock.Lock()
+	defer cli.lock.Unlock()
+
+	var sent bool
+	for conn := range cli.connections {
+		if conn.id != id {
+			continue
+		}
+
+		select {
+		case conn.send <- m:
+			sent = true
+		default:
+			conn.debug("conn.send channel buffer possible full\n")
+		}
+	}
+
+	return sent
+}
+
+// Broadcast sends a message to every seated connection and to waitlisted listeners,
+// as if it had been read from a connection.
+func (cli *Client) Broadcast(m *wsutil.Message) {
+	cli.broadcast <- m
+}
+
+// Kick closes every connection identified by id, sending a policy violation
+// close frame with the given reason.
+// It reports whether a connection was found.
+func (cli *Client) Kick(id uuid.UUID, reason string) bool {
+	return cli.Send(id, &wsutil.Message{
+		OpCode:  ws.OpClose,
+		Payload: ws.NewCloseFrameBody(ws.StatusPolicyViolation, reason),
+	})
 }
 
 // TODO -- should be able to close all connections via their own channels
@@ -131,19 +317,26 @@ func (cli *Client) Close() error {
 /*
 NewClient instantiates a new websocket client.
 
-NOTE: these may be useful to set: Capacity, ReadBufferSize, ReadTimeout, WriteTimeout
+NOTE: these may be useful to set: ReadBufferSize, ReadTimeout, WriteTimeout
 */
-func NewClient(cap uint) *Client {
+func NewClient(cap uint, opts ...Option) *Client {
 	cli := &Client{
 		register:    make(chan *connHandler),
 		unregister:  make(chan *connHandler),
 		broadcast:   make(chan *wsutil.Message),
 		lock:        &sync.Mutex{},
 		connections: make(map[*connHandler]bool),
-		upgrader:    &ws.HTTPUpgrader{
-			// TODO: may be fields here that worth setting
-		},
-		Capacity: cap,
+		taps:        make(map[int]Tap),
+		upgrader:    &ws.HTTPUpgrader{},
+		capacity:    cap,
+	}
+
+	for _, o := range opts {
+		o(cli)
+	}
+
+	if len(cli.protocols) > 0 {
+		cli.upgrader.Protocol = cli.supports
 	}
 
 	go cli.listen()
@@ -155,14 +348,37 @@ func (cli *Client) listen() {
 		select {
 		case conn := <-cli.register:
 			cli.lock.Lock()
-			cli.connections[conn] = true
+			switch {
+			case conn.reserved:
+				cli.pending--
+				cli.sit(conn)
+				// capacity may have been lowered during the handshake,
+				// the waitlist is told its new positions
+				if cli.trim() {
+					cli.promote()
+				}
+			case cli.isFull():
+				cli.enqueue(conn)
+			default:
+				cli.sit(conn)
+			}
 			cli.lock.Unlock()
 		case conn := <-cli.unregister:
 			conn.debug("unregister channel handler")
-			delete(cli.connections, conn)
-			close(conn.send)
+			cli.lock.Lock()
+			// the connection may already have been dropped by broadcast
+			if _, ok := cli.connections[conn]; ok {
+				cli.remove(conn)
+			}
+			cli.lock.Unlock()
 		case msg := <-cli.broadcast:
-			for conn := range cli.connections {
+			cli.lock.Lock()
+			cli.tap(msg)
+			for conn, seated := range cli.connections {
+				if !seated && !conn.listener {
+					continue
+				}
+
 				select {
 				case conn.send <- msg:
 				default:
@@ -171,23 +387,42 @@ func (cli *Client) listen() {
 					// If the client’s send buffer is full, then the hub assumes that the client is dead or stuck. In this case, the hub unregisters the client and closes the websocket
 					conn.debug("conn.send channel buffer possible full\n")
 					conn.debugF("broadcast channel handler: default case:\nopCode: %d\npayload: %+v\n", msg.OpCode, msg.Payload)
-					close(conn.send)
-					delete(cli.connections, conn)
+					cli.remove(conn)
 				}
 			}
+			cli.lock.Unlock()
 		}
 	}
 }
 
+// ServeHTTP upgrades the request and registers it under a new random id.
 func (cli *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// TODO check capacity
-	if cli.Capacity > 0 && cli.Len() >= int(cli.Capacity) {
+	cli.Serve(w, r, uuid.New())
+}
+
+// Serve upgrades the request and registers the connection under id.
+// The same id may be used to address the connection with Send and Kick.
+func (cli *Client) Serve(w http.ResponseWriter, r *http.Request, id uuid.UUID, opts ...ConnOption) {
+	if err := cli.checkProtocols(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// a seat is held for the connection before the handshake so concurrent
+	// requests cannot go over capacity. Without one it is waitlisted, or
+	// rejected if there is no waitlist.
+	reserved := cli.reserve()
+	if !reserved && cli.handleQueue == nil {
 		http.Error(w, "too many connections", http.StatusServiceUnavailable)
 		return
 	}
 
-	rwc, _, _, err := cli.upgrader.Upgrade(r, w)
+	upgrader, accepted := cli.negotiator()
+	rwc, _, hs, err := upgrader.Upgrade(r, w)
 	if err != nil {
+		if reserved {
+			cli.release()
+		}
 		// TODO log that there was an error
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -196,10 +431,12 @@ func (cli *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	isDebug, _ := strconv.ParseBool(os.Getenv("DEBUG"))
 
 	conn := &connHandler{
-		rwc:  rwc,
-		send: make(chan *wsutil.Message, 256),
-		log:  log.Println,
-		logF: log.Printf,
+		id:       id,
+		rwc:      rwc,
+		reserved: reserved,
+		send:     make(chan *wsutil.Message, 256),
+		log:      log.Println,
+		logF:     log.Printf,
 		debug: func(v ...any) {
 			if !isDebug {
 				return
@@ -214,6 +451,41 @@ func (cli *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	if params, ok := accepted(); ok {
+		cli.lock.Lock()
+		conn.deflate = newDeflater(*cli.compression, params)
+		cli.lock.Unlock()
+	}
+
+	for _, o := range opts {
+		o(conn)
+	}
+
+	// the negotiated subprotocol has the last word
+	if hs.Protocol != "" && cli.handleProtocol != nil {
+		for _, o := range cli.handleProtocol(id, hs.Protocol) {
+			o(conn)
+		}
+	}
+
+	if conn.admit != nil {
+		if err := conn.admit(); err != nil {
+			if reserved {
+				cli.release()
+			}
+			_ = wsutil.WriteServerMessage(rwc, ws.OpClose, ws.NewCloseFrameBody(ws.StatusPolicyViolation, err.Error()))
+			_ = rwc.Close()
+			return
+		}
+	}
+
+	// the connection is not registered yet so nothing can be queued before it
+	if cli.handleJoin != nil {
+		if m := cli.handleJoin(id); m != nil {
+			conn.send <- m
+		}
+	}
+
 	cli.register <- conn
 
 	go read(conn, cli)
@@ -221,9 +493,24 @@ func (cli *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type connHandler struct {
+	id  uuid.UUID
 	rwc net.Conn
 
+	// listener connections receive broadcasts while waitlisted
+	listener bool
+	// a seat was reserved for the connection before the handshake
+	reserved bool
+	// order in which the connection was given its seat
+	seat uint64
+
 	send chan *wsutil.Message
+	// rewrite data messages before they are written and after they are read, if set
+	encode Encoder
+	decode Decoder
+	// compresses data messages if permessage-deflate was negotiated
+	deflate *deflater
+	// checked once the connection is upgraded, see WithAdmission
+	admit func() error
 
 	logF func(format string, v ...any)
 	log  func(v ...any)
@@ -241,7 +528,11 @@ func (c *connHandler) setReadDeadLine(d time.Duration) error {
 }
 
 func (c *connHandler) read() (*wsutil.Message, error) {
-	r := wsutil.NewReader(c.rwc, ws.StateServerSide)
+	state := ws.StateServerSide
+	if c.deflate != nil {
+		state |= ws.StateExtended
+	}
+	r := wsutil.NewReader(c.rwc, state)
 
 	for {
 		h, err := r.NextFrame()
@@ -287,15 +578,48 @@ func (c *connHandler) read() (*wsutil.Message, error) {
 		if err != nil {
 			return nil, fmt.Errorf("read all: %w", err)
 		}
+
+		if c.deflate != nil {
+			compressed, err := wsflate.IsCompressed(h)
+			if err != nil {
+				return nil, fmt.Errorf("compression bit: %w", err)
+			}
+			if compressed {
+				if p, err = inflate(p); err != nil {
+					return nil, err
+				}
+			}
+		}
 		return &wsutil.Message{OpCode: h.OpCode, Payload: p}, nil
 	}
 }
 
 func (c *connHandler) write(msg *wsutil.Message) error {
-	frame := ws.NewFrame(msg.OpCode, true, msg.Payload)
+	if c.deflate == nil || !msg.OpCode.IsData() {
+		return ws.WriteFrame(c.rwc, ws.NewFrame(msg.OpCode, true, msg.Payload))
+	}
+
+	frame, err := c.deflate.compress(msg)
+	if err != nil {
+		return err
+	}
 	return ws.WriteFrame(c.rwc, frame)
 }
 
+// writeEncoded writes a message through the encoder of the connection, if any.
+func (c *connHandler) writeEncoded(msg *wsutil.Message) error {
+	if c.encode == nil || !msg.OpCode.IsData() {
+		return c.write(msg)
+	}
+
+	for _, m := range c.encode(msg) {
+		if err := c.write(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *connHandler) controlHandler(h ws.Header, r io.Reader) error {
 	switch op := h.OpCode; op {
 	case ws.OpPing:
@@ -1,16 +1,25 @@
 package websocket_test
 
 import (
+	"compress/flate"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rapidmidiex/rmx/pkg/websocket"
 
+	"github.com/gobwas/httphead"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
+	gorilla "github.com/gorilla/websocket"
 	"github.com/hyphengolang/prelude/testing/is"
 )
 
@@ -54,3 +63,405 @@ func TestSubscriber(t *testing.T) {
 		is.Equal(payload, response) // check if message is correct
 	})
 }
+
+func TestWaitlist(t *testing.T) {
+	is := is.New(t)
+
+	cli := websocket.NewClient(1, websocket.WithWaitlist(func(id uuid.UUID, position int) *wsutil.Message {
+		return &wsutil.Message{OpCode: ws.OpText, Payload: []byte(strconv.Itoa(position))}
+	}))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts []websocket.ConnOption
+		if r.URL.Query().Has("listen") {
+			opts = append(opts, websocket.AsListener())
+		}
+		cli.Serve(w, r, uuid.New(), opts...)
+	}))
+	t.Cleanup(func() { srv.Close() })
+
+	wsPath := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// gorilla buffers messages sent right after the handshake for us
+	dial := func(url string) *gorilla.Conn {
+		conn, _, err := gorilla.DefaultDialer.Dial(url, nil)
+		is.NoErr(err) // connect to server
+		return conn
+	}
+
+	read := func(conn *gorilla.Conn) string {
+		_, p, err := conn.ReadMessage()
+		is.NoErr(err) // read message from server
+		return string(p)
+	}
+
+	cli1 := dial(wsPath)
+
+	// connections are registered after the handshake completes
+	for i := 0; i < 100 && cli.Len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.Equal(1, cli.Len()) // cli1 has a seat
+
+	cli2 := dial(wsPath + "?listen")
+	defer cli2.Close()
+	is.Equal("1", read(cli2)) // cli2 is first in line
+
+	cli3 := dial(wsPath)
+	defer cli3.Close()
+	is.Equal("2", read(cli3))  // cli3 is second in line
+	is.Equal(1, cli.Len())     // only cli1 has a seat
+	is.Equal(2, cli.Waiting()) // cli2 and cli3 are waiting
+
+	err := cli1.WriteMessage(gorilla.TextMessage, []byte("Hello World!"))
+	is.NoErr(err) // send message to server
+
+	is.Equal("Hello World!", read(cli2)) // listeners hear the room while waiting
+
+	err = cli1.Close()
+	is.NoErr(err) // cli1 leaves the room
+
+	is.Equal("0", read(cli2)) // cli2 was given the seat
+	is.Equal("1", read(cli3)) // cli3 moved up the line
+}
+
+func TestWaitlistHandshake(t *testing.T) {
+	is := is.New(t)
+
+	cli := websocket.NewClient(1, websocket.WithWaitlist(func(id uuid.UUID, position int) *wsutil.Message {
+		return &wsutil.Message{OpCode: ws.OpText, Payload: []byte(strconv.Itoa(position))}
+	}))
+
+	// connections named by the request are held in their handshake until
+	// they are let through
+	var mu sync.Mutex
+	held := make(map[string]chan struct{})
+	hold := func(name string) chan struct{} {
+		mu.Lock()
+		defer mu.Unlock()
+		if held[name] == nil {
+			held[name] = make(chan struct{})
+		}
+		return held[name]
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("hold")
+		cli.Serve(w, r, uuid.New(), websocket.WithAdmission(func() error {
+			if name != "" {
+				<-hold(name)
+			}
+			return nil
+		}))
+	}))
+	t.Cleanup(func() { srv.Close() })
+
+	wsPath := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	dial := func(url string) *gorilla.Conn {
+		conn, _, err := gorilla.DefaultDialer.Dial(url, nil)
+		is.NoErr(err) // connect to server
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	read := func(conn *gorilla.Conn) string {
+		_, p, err := conn.ReadMessage()
+		is.NoErr(err) // read message from server
+		return string(p)
+	}
+
+	slow := dial(wsPath + "?hold=slow")
+	fast := dial(wsPath)
+	is.Equal("1", read(fast)) // the seat is held for the connection in its handshake
+
+	close(hold("slow"))
+	for i := 0; i < 100 && cli.Len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.Equal(1, cli.Len())     // only slow has a seat
+	is.Equal(1, cli.Waiting()) // fast is still waiting
+
+	slow.Close()
+	is.Equal("0", read(fast)) // fast was given the seat
+
+	cli.SetCapacity(3)
+	a := dial(wsPath + "?hold=a")
+	dial(wsPath + "?hold=b")
+	cli.SetCapacity(1)
+	is.Equal("1", read(fast)) // the seats held for a and b are kept
+
+	close(hold("a"))
+	is.Equal("1", read(a))    // capacity was lowered during the handshake
+	is.Equal("2", read(fast)) // fast is told it moved down the line
+
+	close(hold("b"))
+	for i := 0; i < 100 && cli.Len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.Equal(1, cli.Len())     // b has the seat held for it
+	is.Equal(2, cli.Waiting()) // a and fast are waiting
+}
+
+func TestSetCapacity(t *testing.T) {
+	is := is.New(t)
+
+	cli := websocket.NewClient(2)
+
+	srv := httptest.NewServer(cli)
+	t.Cleanup(func() { srv.Close() })
+
+	wsPath := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	cli1, _, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err) // connect cli1 to server
+	defer cli1.Close()
+
+	cli2, _, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err) // connect cli2 to server
+	defer cli2.Close()
+
+	_, _, err = gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.True(err != nil) // jam is full
+
+	for i := 0; i < 100 && cli.Len() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cli.SetCapacity(1)
+	is.Equal(uint(1), cli.Capacity()) // capacity was lowered
+
+	_, _, err = cli2.ReadMessage()
+	is.True(gorilla.IsCloseError(err, gorilla.CloseTryAgainLater)) // newest connection lost its seat
+	is.Equal(1, cli.Len())                                         // cli1 kept its seat
+
+	cli.SetCapacity(2)
+
+	cli3, _, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err) // there is room again
+	defer cli3.Close()
+}
+
+func TestProtocols(t *testing.T) {
+	is := is.New(t)
+
+	negotiated := make(chan string, 1)
+	cli := websocket.NewClient(0, websocket.WithProtocols(func(id uuid.UUID, protocol string) []websocket.ConnOption {
+		negotiated <- protocol
+		return nil
+	}, "chat.v1", "chat.v2"))
+
+	srv := httptest.NewServer(cli)
+	t.Cleanup(func() { srv.Close() })
+
+	wsPath := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	dialer := gorilla.Dialer{Subprotocols: []string{"chat.v3"}}
+	_, resp, err := dialer.Dial(wsPath, nil)
+	is.True(err != nil)                              // chat.v3 is not supported
+	is.Equal(http.StatusBadRequest, resp.StatusCode) // rejected before the handshake
+
+	dialer.Subprotocols = []string{"chat.v3", "chat.v2", "chat.v1"}
+	conn, _, err := dialer.Dial(wsPath, nil)
+	is.NoErr(err) // one of the offered subprotocols is supported
+	defer conn.Close()
+	is.Equal("chat.v2", conn.Subprotocol()) // first supported subprotocol offered
+	is.Equal("chat.v2", <-negotiated)       // handler is told
+
+	legacy, _, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err) // clients offering no subprotocol are accepted
+	defer legacy.Close()
+	is.Equal("", legacy.Subprotocol())
+}
+
+func TestAdmission(t *testing.T) {
+	is := is.New(t)
+
+	cli := websocket.NewClient(1)
+	admitted := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cli.Serve(w, r, uuid.New(), websocket.WithAdmission(func() error {
+			if !admitted {
+				admitted = true
+				return errors.New("not yet")
+			}
+			return nil
+		}))
+	}))
+	t.Cleanup(func() { srv.Close() })
+
+	wsPath := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	rejected, resp, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err)                                            // admitted after the handshake
+	is.Equal(http.StatusSwitchingProtocols, resp.StatusCode) // upgraded
+	defer rejected.Close()
+
+	_, _, err = rejected.ReadMessage()
+	is.True(gorilla.IsCloseError(err, gorilla.ClosePolicyViolation)) // closed with the error
+	is.True(strings.Contains(err.Error(), "not yet"))
+
+	conn, _, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err) // the seat of the rejected connection was given back
+	defer conn.Close()
+}
+
+func TestLeave(t *testing.T) {
+	is := is.New(t)
+
+	left := make(chan uuid.UUID, 1)
+	cli := websocket.NewClient(0, websocket.WithLeaveHandler(func(id uuid.UUID) {
+		left <- id
+	}))
+
+	id := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cli.Serve(w, r, id)
+	}))
+	t.Cleanup(func() { srv.Close() })
+
+	wsPath := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	phone, _, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err) // connect the phone
+	laptop, _, err := gorilla.DefaultDialer.Dial(wsPath, nil)
+	is.NoErr(err) // connect the laptop
+
+	for i := 0; i < 100 && cli.Len() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.True(cli.Connected(id))
+
+	phone.Close()
+	for i := 0; i < 100 && cli.Len() > 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-left:
+		t.Fatal("left while the laptop is connected")
+	default:
+	}
+
+	laptop.Close()
+	select {
+	case got := <-left:
+		is.Equal(id, got) // the last connection is gone
+	case <-time.After(time.Second):
+		t.Fatal("never left")
+	}
+	is.True(!cli.Connected(id))
+}
+
+func TestCompressionLevel(t *testing.T) {
+	is := is.New(t)
+
+	for _, level := range []int{flate.HuffmanOnly, flate.DefaultCompression, 0, flate.BestSpeed, flate.BestCompression} {
+		is.NoErr(websocket.Compression{Level: level}.Validate()) // level of compress/flate
+	}
+	for _, level := range []int{-3, 10} {
+		is.True(errors.Is(websocket.Compression{Level: level}.Validate(), websocket.ErrCompressionLevel)) // not a level of compress/flate
+	}
+}
+
+func TestCompression(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	cli := websocket.NewClient(0, websocket.WithCompression(websocket.Compression{
+		Level:           flate.BestSpeed,
+		ContextTakeover: true,
+		Threshold:       64,
+	}))
+
+	srv := httptest.NewServer(cli)
+	t.Cleanup(func() { srv.Close() })
+
+	wsPath := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// gorilla only supports compression without context takeover
+	sender, resp, err := (&gorilla.Dialer{EnableCompression: true}).Dial(wsPath, nil)
+	is.NoErr(err) // connect sender to server
+	defer sender.Close()
+	is.True(strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")) // compression was negotiated
+
+	dialer := ws.Dialer{Extensions: []httphead.Option{wsflate.Parameters{}.Option()}}
+	receiver, _, hs, err := dialer.Dial(ctx, wsPath)
+	is.NoErr(err) // connect receiver to server
+	defer receiver.Close()
+	is.Equal(1, len(hs.Extensions)) // compression was negotiated
+
+	for i := 0; i < 100 && cli.Len() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	short := []byte("C4")
+	long := []byte(strings.Repeat("the band is playing Am7, ", 20))
+
+	for _, p := range [][]byte{short, long, long} {
+		err := sender.WriteMessage(gorilla.TextMessage, p)
+		is.NoErr(err) // send message to server
+	}
+
+	frame, err := ws.ReadFrame(receiver)
+	is.NoErr(err) // read short message
+	compressed, err := wsflate.IsCompressed(frame.Header)
+	is.NoErr(err)
+	is.True(!compressed)           // short messages are sent as is
+	is.Equal(short, frame.Payload) // message is intact
+
+	frame, err = ws.ReadFrame(receiver)
+	is.NoErr(err) // read long message
+	compressed, err = wsflate.IsCompressed(frame.Header)
+	is.NoErr(err)
+	is.True(compressed)                       // long messages are compressed
+	is.True(len(frame.Payload) < len(long)/2) // and smaller
+	first := len(frame.Payload)
+
+	frame, err = wsflate.DecompressFrame(frame)
+	is.NoErr(err)                 // decompress long message
+	is.Equal(long, frame.Payload) // message is intact
+
+	frame, err = ws.ReadFrame(receiver)
+	is.NoErr(err)                       // read long message again
+	is.True(len(frame.Payload) < first) // the context was kept from the previous message
+
+	for _, want := range [][]byte{short, long, long} {
+		_, p, err := sender.ReadMessage()
+		is.NoErr(err)     // gorilla decompresses what the server sent it
+		is.Equal(want, p) // message is intact
+	}
+}
+
+func TestTap(t *testing.T) {
+	is := is.New(t)
+
+	cli := websocket.NewClient(0)
+	srv := httptest.NewServer(cli)
+	t.Cleanup(func() { srv.Close() })
+
+	tapped := make(chan string, 2)
+	untap := cli.Tap(func(m *wsutil.Message) { tapped <- string(m.Payload) })
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	is.NoErr(err) // connect to the client
+	defer conn.Close()
+
+	is.NoErr(conn.WriteMessage(gorilla.TextMessage, []byte("from a connection")))
+	is.Equal("from a connection", <-tapped) // messages read from connections are tapped
+
+	cli.Broadcast(&wsutil.Message{OpCode: ws.OpText, Payload: []byte("from the server")})
+	is.Equal("from the server", <-tapped) // and so are broadcasts
+
+	untap()
+	cli.Broadcast(&wsutil.Message{OpCode: ws.OpText, Payload: []byte("unheard")})
+
+	_, p, err := conn.ReadMessage()
+	is.NoErr(err)
+	is.Equal("from a connection", string(p))
+	_, _, err = conn.ReadMessage()
+	is.NoErr(err)
+	_, p, err = conn.ReadMessage()
+	is.NoErr(err)
+	is.Equal("unheard", string(p)) // still broadcast
+	is.Equal(0, len(tapped))       // but no longer tapped
+}